@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"interpreter/token"
+	"strconv"
 	"strings"
 )
 
@@ -21,6 +22,12 @@ type Expression interface {
 	expressionNode()
 }
 
+// CustomExpression is embedded by expression nodes defined outside this
+// package, such as those built by parse functions registered with the parser.
+type CustomExpression struct{}
+
+func (CustomExpression) expressionNode() {}
+
 type Program struct {
 	Statements []Statement
 }
@@ -47,6 +54,8 @@ func (p *Program) String() string {
 type LetStatement struct {
 	Token token.Token
 	Name  *Identifier
+	// Type is nil unless annotated
+	Type  Type
 	Value Expression
 }
 
@@ -57,6 +66,9 @@ func (ls *LetStatement) String() string {
 
 	out.WriteString(ls.TokenLexeme() + " ")
 	out.WriteString(ls.Name.String())
+	if ls.Type != nil {
+		out.WriteString(": " + ls.Type.String())
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -104,6 +116,162 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+/**		STRUCT STATEMENTS		**/
+// struct Point { x, y } or type Point { x, y; func add(self, other) { ... } },
+// every method is a named FunctionLiteral taking the instance as its first parameter
+type StructStatement struct {
+	// STRUCT or TYPE token
+	Token   token.Token
+	Name    *Identifier
+	Fields  []*Identifier
+	Methods []*FunctionLiteral
+}
+
+func (ss *StructStatement) TokenLexeme() string { return ss.Token.Lexeme }
+func (ss *StructStatement) statementNode()      {}
+func (ss *StructStatement) String() string {
+	var out bytes.Buffer
+
+	fields := []string{}
+	for _, f := range ss.Fields {
+		fields = append(fields, f.String())
+	}
+
+	out.WriteString(ss.TokenLexeme() + " ")
+	out.WriteString(ss.Name.String())
+	out.WriteString(" { ")
+	out.WriteString(strings.Join(fields, ", "))
+	for _, m := range ss.Methods {
+		out.WriteString("; ")
+		out.WriteString(m.String())
+	}
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+/**		ENUM STATEMENTS		**/
+// enum Shape { Circle(r), Rect(w, h), Empty }
+type EnumStatement struct {
+	// ENUM token
+	Token    token.Token
+	Name     *Identifier
+	Variants []*EnumVariant
+}
+
+// Fields is nil for a variant written without parentheses, which is a value
+// rather than a constructor
+type EnumVariant struct {
+	Name   *Identifier
+	Fields []*Identifier
+}
+
+func (ev *EnumVariant) String() string {
+	if ev.Fields == nil {
+		return ev.Name.String()
+	}
+
+	fields := []string{}
+	for _, f := range ev.Fields {
+		fields = append(fields, f.String())
+	}
+	return ev.Name.String() + "(" + strings.Join(fields, ", ") + ")"
+}
+
+func (es *EnumStatement) TokenLexeme() string { return es.Token.Lexeme }
+func (es *EnumStatement) statementNode()      {}
+func (es *EnumStatement) String() string {
+	var out bytes.Buffer
+
+	variants := []string{}
+	for _, v := range es.Variants {
+		variants = append(variants, v.String())
+	}
+
+	out.WriteString(es.TokenLexeme() + " ")
+	out.WriteString(es.Name.String())
+	out.WriteString(" { ")
+	out.WriteString(strings.Join(variants, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+/**		IMPORT STATEMENTS		**/
+// import "path/to/file" as name, Alias is nil when the file name is used
+type ImportStatement struct {
+	// IMPORT token
+	Token token.Token
+	Path  *StringLiteral
+	Alias *Identifier
+}
+
+func (is *ImportStatement) TokenLexeme() string { return is.Token.Lexeme }
+func (is *ImportStatement) statementNode()      {}
+func (is *ImportStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(is.TokenLexeme() + " ")
+	out.WriteString(`"` + is.Path.Value + `"`)
+	if is.Alias != nil {
+		out.WriteString(" as " + is.Alias.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
+/**		EXPORT STATEMENTS		**/
+// export let, struct, type or enum, the declared name becomes visible to importers
+type ExportStatement struct {
+	// EXPORT token
+	Token     token.Token
+	Statement Statement
+}
+
+func (es *ExportStatement) TokenLexeme() string { return es.Token.Lexeme }
+func (es *ExportStatement) statementNode()      {}
+func (es *ExportStatement) String() string {
+	return es.TokenLexeme() + " " + es.Statement.String()
+}
+
+// Name is the name the exported declaration binds
+func (es *ExportStatement) Name() string {
+	switch stmt := es.Statement.(type) {
+	case *LetStatement:
+		return stmt.Name.Value
+	case *StructStatement:
+		return stmt.Name.Value
+	case *EnumStatement:
+		return stmt.Name.Value
+	}
+	return ""
+}
+
+/**		THROW STATEMENTS		**/
+type ThrowStatement struct {
+	// THROW token
+	Token token.Token
+	// Error or message being thrown
+	Value Expression
+}
+
+func (ts *ThrowStatement) TokenLexeme() string { return ts.Token.Lexeme }
+func (ts *ThrowStatement) statementNode()      {}
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ts.TokenLexeme() + " ")
+
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
 /**  	EXPRESSION STATEMENTS 	**/
 type ExpressionStatement struct {
 	Token      token.Token
@@ -211,6 +379,8 @@ func (ie *IfExpression) String() string {
 type StatementBlock struct {
 	Token      token.Token
 	Statements []Statement
+	// the closing brace, unset for blocks the parser makes up
+	Rbrace token.Token
 }
 
 func (bs *StatementBlock) statementNode()      {}
@@ -224,9 +394,16 @@ func (bs *StatementBlock) String() string {
 }
 
 type FunctionLiteral struct {
-	Token      token.Token
+	Token token.Token
+	// Name is only set for methods
+	Name       string
 	Parameters []*Identifier
-	Body       *StatementBlock
+	// ParameterTypes is nil when no parameter is annotated, otherwise it has
+	// the annotation of each parameter or nil
+	ParameterTypes []Type
+	// Result is nil unless annotated
+	Result Type
+	Body   *StatementBlock
 }
 
 func (fl *FunctionLiteral) expressionNode()     {}
@@ -235,23 +412,90 @@ func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+	for i, p := range fl.Parameters {
+		if i < len(fl.ParameterTypes) && fl.ParameterTypes[i] != nil {
+			params = append(params, p.String()+": "+fl.ParameterTypes[i].String())
+		} else {
+			params = append(params, p.String())
+		}
 	}
 
 	out.WriteString(fl.TokenLexeme())
+	if fl.Name != "" {
+		out.WriteString(" " + fl.Name)
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") ")
+	out.WriteString(")")
+	if fl.Result != nil {
+		out.WriteString(": " + fl.Result.String())
+	}
+	out.WriteString(" ")
 	out.WriteString(fl.Body.String())
 
 	return out.String()
 }
 
+// infixl 6 <+> = func(a, b) { ... }, Token is infixl or infixr
+type OperatorStatement struct {
+	Token      token.Token
+	Precedence int64
+	Operator   string
+	Function   Expression
+}
+
+func (os *OperatorStatement) statementNode()      {}
+func (os *OperatorStatement) TokenLexeme() string { return os.Token.Lexeme }
+func (os *OperatorStatement) RightAssociative() bool {
+	return os.Token.Type == token.INFIXR
+}
+func (os *OperatorStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(os.TokenLexeme() + " ")
+	out.WriteString(strconv.FormatInt(os.Precedence, 10) + " ")
+	out.WriteString(os.Operator + " = ")
+	if os.Function != nil {
+		out.WriteString(os.Function.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// macro(a, b) { quote(...) }, the arguments are passed as quoted AST nodes
+type MacroLiteral struct {
+	Token      token.Token
+	Parameters []*Identifier
+	Body       *StatementBlock
+}
+
+func (ml *MacroLiteral) expressionNode()     {}
+func (ml *MacroLiteral) TokenLexeme() string { return ml.Token.Lexeme }
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(ml.TokenLexeme())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+
+	return out.String()
+}
+
+// f?.(x) sets Optional, the arguments and the rest of the chain are skipped and
+// NULL returned when Function is NULL
 type CallExpression struct {
 	Token     token.Token
 	Function  Expression
 	Arguments []Expression
+	Optional  bool
 }
 
 func (ce *CallExpression) expressionNode()     {}
@@ -263,8 +507,314 @@ func (ce *CallExpression) String() string {
 		args = append(args, a.String())
 	}
 	out.WriteString(ce.Function.String())
+	if ce.Optional {
+		out.WriteString("?.")
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(args, ", "))
 	out.WriteString(")")
 	return out.String()
 }
+
+type ArrayLiteral struct {
+	Token    token.Token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode()     {}
+func (al *ArrayLiteral) TokenLexeme() string { return al.Token.Lexeme }
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// a?.[i] sets Optional, the index and the rest of the chain are skipped and NULL
+// returned when Left is NULL
+type IndexExpression struct {
+	Token    token.Token
+	Left     Expression
+	Index    Expression
+	Optional bool
+}
+
+func (ie *IndexExpression) expressionNode()     {}
+func (ie *IndexExpression) TokenLexeme() string { return ie.Token.Lexeme }
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	if ie.Optional {
+		out.WriteString("?.")
+	}
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+	return out.String()
+}
+
+// SLICE EXPRESSIONS //
+// Start and End are optional, arr[:2] and arr[1:] leave one of them nil
+type SliceExpression struct {
+	Token    token.Token
+	Left     Expression
+	Start    Expression
+	End      Expression
+	Optional bool
+}
+
+func (se *SliceExpression) expressionNode()     {}
+func (se *SliceExpression) TokenLexeme() string { return se.Token.Lexeme }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	if se.Optional {
+		out.WriteString("?.")
+	}
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	out.WriteString("])")
+	return out.String()
+}
+
+// RANGE EXPRESSIONS //
+// 1..10 excludes the end, 1..=10 includes it
+type RangeExpression struct {
+	Token     token.Token
+	Start     Expression
+	End       Expression
+	Inclusive bool
+}
+
+func (re *RangeExpression) expressionNode()     {}
+func (re *RangeExpression) TokenLexeme() string { return re.Token.Lexeme }
+func (re *RangeExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(re.Start.String())
+	out.WriteString(re.Token.Lexeme)
+	out.WriteString(re.End.String())
+	out.WriteString(")")
+	return out.String()
+}
+
+// TRY EXPRESSIONS //
+// Catch and Finally are optional but at least one of them is present,
+// CatchParam is nil for a bare catch { }
+type TryExpression struct {
+	Token      token.Token
+	Block      *StatementBlock
+	CatchParam *Identifier
+	Catch      *StatementBlock
+	Finally    *StatementBlock
+}
+
+func (te *TryExpression) expressionNode()     {}
+func (te *TryExpression) TokenLexeme() string { return te.Token.Lexeme }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+	if te.Catch != nil {
+		out.WriteString("catch")
+		if te.CatchParam != nil {
+			out.WriteString("(" + te.CatchParam.String() + ")")
+		}
+		out.WriteString(" ")
+		out.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		out.WriteString("finally ")
+		out.WriteString(te.Finally.String())
+	}
+	return out.String()
+}
+
+// STRUCT LITERALS //
+// Point{x: 1, y: 2}, Fields and Values are in source order.
+// Name is an Identifier, or a MemberExpression for a struct from another module.
+type StructLiteral struct {
+	Token  token.Token
+	Name   Expression
+	Fields []*Identifier
+	Values []Expression
+}
+
+func (sl *StructLiteral) expressionNode()     {}
+func (sl *StructLiteral) TokenLexeme() string { return sl.Token.Lexeme }
+func (sl *StructLiteral) String() string {
+	var out bytes.Buffer
+
+	fields := []string{}
+	for i, f := range sl.Fields {
+		fields = append(fields, f.String()+": "+sl.Values[i].String())
+	}
+
+	out.WriteString(sl.Name.String())
+	out.WriteString("{")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// MEMBER EXPRESSIONS //
+// p.x, or p?.x which gives NULL when Object is NULL, skipping the rest of the
+// chain like the .y of p?.x.y
+type MemberExpression struct {
+	Token    token.Token
+	Object   Expression
+	Member   *Identifier
+	Optional bool
+}
+
+func (me *MemberExpression) expressionNode()     {}
+func (me *MemberExpression) TokenLexeme() string { return me.Token.Lexeme }
+func (me *MemberExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(me.Object.String())
+	if me.Optional {
+		out.WriteString("?.")
+	} else {
+		out.WriteString(".")
+	}
+	out.WriteString(me.Member.String())
+	out.WriteString(")")
+	return out.String()
+}
+
+// ASSIGN EXPRESSIONS //
+// p.x = 3, only members can be assigned to, variables are bound with let
+type AssignExpression struct {
+	Token  token.Token
+	Target Expression
+	Value  Expression
+}
+
+func (ae *AssignExpression) expressionNode()     {}
+func (ae *AssignExpression) TokenLexeme() string { return ae.Token.Lexeme }
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" = ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+	return out.String()
+}
+
+// MATCH EXPRESSIONS //
+// match (shape) { Circle(r) => r * r, Rect(w, h) => { w * h }, _ => 0 }
+type MatchExpression struct {
+	Token   token.Token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+// Variant is _ for the wildcard arm, an expression body is wrapped in a block
+type MatchArm struct {
+	Variant  *Identifier
+	Bindings []*Identifier
+	Body     *StatementBlock
+}
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+	out.WriteString(ma.Variant.String())
+	if ma.Bindings != nil {
+		bindings := []string{}
+		for _, b := range ma.Bindings {
+			bindings = append(bindings, b.String())
+		}
+		out.WriteString("(" + strings.Join(bindings, ", ") + ")")
+	}
+	out.WriteString(" => ")
+	out.WriteString(ma.Body.String())
+	return out.String()
+}
+
+func (me *MatchExpression) expressionNode()     {}
+func (me *MatchExpression) TokenLexeme() string { return me.Token.Lexeme }
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, a := range me.Arms {
+		arms = append(arms, a.String())
+	}
+
+	out.WriteString("match")
+	out.WriteString(me.Subject.String())
+	out.WriteString(" { ")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// TYPE ANNOTATIONS //
+// let x: int = 1 or func(a: string, b: [int]): bool { ... }, annotations are
+// optional and the evaluator ignores them
+type Type interface {
+	Node
+	typeNode()
+}
+
+// int, string, bool, any or the name of a struct or enum
+type TypeName struct {
+	Token token.Token
+	Name  string
+}
+
+func (tn *TypeName) typeNode()           {}
+func (tn *TypeName) TokenLexeme() string { return tn.Token.Lexeme }
+func (tn *TypeName) String() string      { return tn.Name }
+
+// [int]
+type ArrayType struct {
+	// [ token
+	Token   token.Token
+	Element Type
+}
+
+func (at *ArrayType) typeNode()           {}
+func (at *ArrayType) TokenLexeme() string { return at.Token.Lexeme }
+func (at *ArrayType) String() string      { return "[" + at.Element.String() + "]" }
+
+// func(int, string): bool, Result is nil when the result isn't annotated
+type FunctionType struct {
+	Token      token.Token
+	Parameters []Type
+	Result     Type
+}
+
+func (ft *FunctionType) typeNode()           {}
+func (ft *FunctionType) TokenLexeme() string { return ft.Token.Lexeme }
+func (ft *FunctionType) String() string {
+	params := []string{}
+	for _, p := range ft.Parameters {
+		params = append(params, p.String())
+	}
+	out := "func(" + strings.Join(params, ", ") + ")"
+	if ft.Result != nil {
+		out += ": " + ft.Result.String()
+	}
+	return out
+}
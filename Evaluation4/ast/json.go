@@ -0,0 +1,241 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"interpreter/token"
+	"reflect"
+	"strconv"
+	"unicode"
+)
+
+// The JSON form of a node is an object with its "kind", the Go type name, and
+// one key per field named like the field with a lower case first letter. Tokens
+// are {"type", "lexeme", "line", "column"} objects, child nodes nest the same
+// way, lists of nodes are arrays and missing children are null. Keys are
+// sorted, so the output for a given tree is always the same.
+
+// every kind that can appear in the JSON form
+var jsonKinds = map[string]reflect.Type{}
+
+func init() {
+	for _, node := range []interface{}{
+		&Program{}, &LetStatement{}, &Identifier{}, &ReturnStatement{},
+		&StructStatement{}, &EnumStatement{}, &EnumVariant{}, &ImportStatement{},
+		&ExportStatement{}, &ThrowStatement{}, &ExpressionStatement{},
+		&IntegerLiteral{}, &StringLiteral{}, &PrefixExpression{}, &InfixExpression{},
+		&BooleanExpression{}, &IfExpression{}, &StatementBlock{}, &FunctionLiteral{},
+		&OperatorStatement{}, &MacroLiteral{}, &CallExpression{}, &ArrayLiteral{},
+		&IndexExpression{}, &SliceExpression{}, &RangeExpression{}, &TryExpression{},
+		&StructLiteral{}, &MemberExpression{}, &AssignExpression{},
+		&MatchExpression{}, &MatchArm{}, &TypeName{}, &ArrayType{}, &FunctionType{},
+	} {
+		t := reflect.TypeOf(node).Elem()
+		jsonKinds[t.Name()] = t
+	}
+}
+
+var tokenType = reflect.TypeOf(token.Token{})
+
+// ToJSON encodes node and everything below it.
+func ToJSON(node Node) ([]byte, error) {
+	v, err := encodeNode(reflect.ValueOf(node))
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(v, "", "  ")
+}
+
+// FromJSON decodes a node written by ToJSON.
+func FromJSON(data []byte) (Node, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var raw interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	v, err := decodeNode(raw, reflect.TypeOf((*Node)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	if v.IsNil() {
+		return nil, fmt.Errorf("no node in input")
+	}
+	return v.Interface().(Node), nil
+}
+
+func encodeNode(v reflect.Value) (interface{}, error) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.IsNil() {
+		return nil, nil
+	}
+	t := v.Elem().Type()
+	if jsonKinds[t.Name()] != t {
+		return nil, fmt.Errorf("cannot encode node of type %s", v.Type())
+	}
+
+	out := map[string]interface{}{"kind": t.Name()}
+	for i := 0; i < t.NumField(); i++ {
+		val, err := encodeField(v.Elem().Field(i))
+		if err != nil {
+			return nil, err
+		}
+		out[jsonName(t.Field(i).Name)] = val
+	}
+	return out, nil
+}
+
+func encodeField(v reflect.Value) (interface{}, error) {
+	switch {
+	case v.Type() == tokenType:
+		tok := v.Interface().(token.Token)
+		return map[string]interface{}{
+			"type":   string(tok.Type),
+			"lexeme": tok.Lexeme,
+			"line":   tok.Line,
+			"column": tok.Column,
+		}, nil
+	case v.Kind() == reflect.String, v.Kind() == reflect.Int64, v.Kind() == reflect.Bool:
+		return v.Interface(), nil
+	case v.Kind() == reflect.Interface, v.Kind() == reflect.Ptr:
+		return encodeNode(v)
+	case v.Kind() == reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			el, err := encodeNode(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = el
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("cannot encode field of type %s", v.Type())
+}
+
+// decodeNode returns a value of type want, an interface or node pointer type
+func decodeNode(raw interface{}, want reflect.Type) (reflect.Value, error) {
+	if raw == nil {
+		return reflect.Zero(want), nil
+	}
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("expected a node, got %v", raw)
+	}
+	kind, _ := obj["kind"].(string)
+	t, ok := jsonKinds[kind]
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("unknown node kind %q", kind)
+	}
+	node := reflect.New(t)
+	if !node.Type().AssignableTo(want) {
+		return reflect.Value{}, fmt.Errorf("%s is not a valid %s", kind, want)
+	}
+
+	fields := map[string]int{}
+	for i := 0; i < t.NumField(); i++ {
+		fields[jsonName(t.Field(i).Name)] = i
+	}
+	for key, val := range obj {
+		if key == "kind" {
+			continue
+		}
+		i, ok := fields[key]
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("unknown field %q in %s", key, kind)
+		}
+		if err := decodeField(val, node.Elem().Field(i)); err != nil {
+			return reflect.Value{}, fmt.Errorf("%s.%s: %w", kind, key, err)
+		}
+	}
+	return node, nil
+}
+
+func decodeField(raw interface{}, field reflect.Value) error {
+	t := field.Type()
+	switch {
+	case t == tokenType:
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected a token, got %v", raw)
+		}
+		typ, _ := obj["type"].(string)
+		lexeme, _ := obj["lexeme"].(string)
+		line, err := decodeInt(obj["line"])
+		if err != nil {
+			return err
+		}
+		column, err := decodeInt(obj["column"])
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(token.Token{
+			Type: token.TokenType(typ), Lexeme: lexeme, Line: int(line), Column: int(column),
+		}))
+	case t.Kind() == reflect.String:
+		s, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %v", raw)
+		}
+		field.SetString(s)
+	case t.Kind() == reflect.Int64:
+		n, err := decodeInt(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case t.Kind() == reflect.Bool:
+		b, ok := raw.(bool)
+		if !ok {
+			return fmt.Errorf("expected a boolean, got %v", raw)
+		}
+		field.SetBool(b)
+	case t.Kind() == reflect.Interface, t.Kind() == reflect.Ptr:
+		node, err := decodeNode(raw, t)
+		if err != nil {
+			return err
+		}
+		field.Set(node)
+	case t.Kind() == reflect.Slice:
+		if raw == nil {
+			return nil
+		}
+		list, ok := raw.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected a list, got %v", raw)
+		}
+		slice := reflect.MakeSlice(t, len(list), len(list))
+		for i, el := range list {
+			node, err := decodeNode(el, t.Elem())
+			if err != nil {
+				return err
+			}
+			slice.Index(i).Set(node)
+		}
+		field.Set(slice)
+	default:
+		return fmt.Errorf("cannot decode field of type %s", t)
+	}
+	return nil
+}
+
+func decodeInt(raw interface{}) (int64, error) {
+	n, ok := raw.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("expected a number, got %v", raw)
+	}
+	return strconv.ParseInt(n.String(), 10, 64)
+}
+
+func jsonName(field string) string {
+	r := []rune(field)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
@@ -0,0 +1,116 @@
+package ast_test
+
+import (
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	inputs := []string{
+		`let x = 5; return -x * (2 + 3) / 4 != 1;`,
+		`if (a < b) { a } else { b }; if (!c) { "yes" }`,
+		`let add = func(a, b) { a + b }; add(1, add(2, 3))`,
+		`[1, 2, 3][0]; xs[1:]; xs[:-1]; xs?.[0]; 1..10; 1..=10; a ?? b`,
+		`try { throw error("x") } catch (e) { e } finally { 1 }; try { 1 } finally { 2 }`,
+		`struct Point { x, y; func len(self) { self.x + self.y } } Point{x: 1, y: 2}.len(); p.x = 3; p?.x?.(1)`,
+		`type T { a }`,
+		`enum Shape { Circle(r), Square(s), Empty } match (s) { Circle(r) => r, Empty => { 0 }, _ => 1 }`,
+		`import "lib/util" as u; export let z = u.f(); export struct S { a }`,
+		`let m = macro(a, b) { quote(unquote(a) + unquote(b)) }; m(1, 2)`,
+		`infixr 6 <+> = func(a, b) { a }; 1 <+> 2 <+> 3`,
+		`let big = 9223372036854775807; true == false`,
+		`let f: func(int, [string]): bool = func(a: int, b, c: [string]): bool { true }`,
+	}
+
+	for _, input := range inputs {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", input, p.Errors())
+		}
+
+		data, err := ast.ToJSON(program)
+		if err != nil {
+			t.Fatalf("ToJSON(%q) failed: %v", input, err)
+		}
+		node, err := ast.FromJSON(data)
+		if err != nil {
+			t.Fatalf("FromJSON failed for %q: %v", input, err)
+		}
+		if !reflect.DeepEqual(node, program) {
+			t.Errorf("round trip changed %q. got=%q", input, node.String())
+		}
+
+		again, err := ast.ToJSON(node)
+		if err != nil || string(again) != string(data) {
+			t.Errorf("second encoding of %q differs", input)
+		}
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	p := parser.New(lexer.New("x +\n  1"))
+	program := p.ParseProgram()
+
+	data, err := ast.ToJSON(program.Statements[0].(*ast.ExpressionStatement).Expression)
+	if err != nil {
+		t.Fatalf("ToJSON failed: %v", err)
+	}
+	expected := `{
+  "kind": "InfixExpression",
+  "left": {
+    "kind": "Identifier",
+    "token": {
+      "column": 1,
+      "lexeme": "x",
+      "line": 1,
+      "type": "ID"
+    },
+    "value": "x"
+  },
+  "op": "+",
+  "right": {
+    "kind": "IntegerLiteral",
+    "token": {
+      "column": 3,
+      "lexeme": "1",
+      "line": 2,
+      "type": "DIGIT"
+    },
+    "value": 1
+  },
+  "token": {
+    "column": 3,
+    "lexeme": "+",
+    "line": 1,
+    "type": "+"
+  }
+}`
+	if string(data) != expected {
+		t.Errorf("wrong JSON. got=\n%s", data)
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind": "Nope"}`, `unknown node kind "Nope"`},
+		{`{"kind": "Identifier", "name": "x"}`, `unknown field "name" in Identifier`},
+		{`{"kind": "LetStatement", "value": {"kind": "LetStatement"}}`, "LetStatement is not a valid ast.Expression"},
+		{`{"kind": "IntegerLiteral", "value": "1"}`, "IntegerLiteral.value: expected a number, got 1"},
+		{`null`, "no node in input"},
+	}
+
+	for _, tt := range tests {
+		_, err := ast.FromJSON([]byte(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected error %q, got=%v", tt.expected, err)
+		}
+	}
+}
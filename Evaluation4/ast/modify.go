@@ -0,0 +1,13 @@
+package ast
+
+// ModifierFunc replaces a node, returning the node unchanged keeps it
+type ModifierFunc func(Node) Node
+
+// Modify rewrites the children of node depth first and then node itself with
+// modifier. It reaches the same nodes as Walk.
+func Modify(node Node, modifier ModifierFunc) Node {
+	rewrite(node, func(child Node) Node {
+		return Modify(child, modifier)
+	})
+	return modifier(node)
+}
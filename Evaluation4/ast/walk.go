@@ -0,0 +1,193 @@
+package ast
+
+// A Visitor's Visit is called for each node Walk reaches. When it returns a
+// visitor w, Walk visits the children of the node with w and then calls
+// w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk visits node and everything below it depth first, children in the order
+// they appear in the source. Nodes defined outside this package have no
+// children as far as Walk knows.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	rewrite(node, func(child Node) Node {
+		Walk(v, child)
+		return child
+	})
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect calls f for node and everything below it like Walk, skipping the
+// children of nodes f returns false for. After the children of a node f is
+// called with nil.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// rewrite calls f with every child of node in source order and puts what it
+// returns in the child's place. A child replaced by a node of the wrong type
+// becomes nil, a child f returns unchanged is never written.
+func rewrite(node Node, f func(Node) Node) {
+	switch node := node.(type) {
+	case *Program:
+		visitAll(node.Statements, f)
+
+	case *ExpressionStatement:
+		visit(&node.Expression, f)
+
+	case *LetStatement:
+		visit(&node.Name, f)
+		visit(&node.Type, f)
+		visit(&node.Value, f)
+
+	case *ReturnStatement:
+		visit(&node.Value, f)
+
+	case *OperatorStatement:
+		visit(&node.Function, f)
+
+	case *ThrowStatement:
+		visit(&node.Value, f)
+
+	case *ExportStatement:
+		visit(&node.Statement, f)
+
+	case *ImportStatement:
+		visit(&node.Path, f)
+		visit(&node.Alias, f)
+
+	case *StructStatement:
+		visit(&node.Name, f)
+		visitAll(node.Fields, f)
+		visitAll(node.Methods, f)
+
+	case *EnumStatement:
+		visit(&node.Name, f)
+		for _, variant := range node.Variants {
+			visit(&variant.Name, f)
+			visitAll(variant.Fields, f)
+		}
+
+	case *StatementBlock:
+		visitAll(node.Statements, f)
+
+	case *PrefixExpression:
+		visit(&node.Value, f)
+
+	case *InfixExpression:
+		visit(&node.Left, f)
+		visit(&node.Right, f)
+
+	case *IfExpression:
+		visit(&node.Condition, f)
+		visit(&node.Consequence, f)
+		visit(&node.Alternative, f)
+
+	case *FunctionLiteral:
+		for i := range node.Parameters {
+			visit(&node.Parameters[i], f)
+			if i < len(node.ParameterTypes) {
+				visit(&node.ParameterTypes[i], f)
+			}
+		}
+		visit(&node.Result, f)
+		visit(&node.Body, f)
+
+	case *MacroLiteral:
+		visitAll(node.Parameters, f)
+		visit(&node.Body, f)
+
+	case *CallExpression:
+		visit(&node.Function, f)
+		visitAll(node.Arguments, f)
+
+	case *ArrayLiteral:
+		visitAll(node.Elements, f)
+
+	case *IndexExpression:
+		visit(&node.Left, f)
+		visit(&node.Index, f)
+
+	case *SliceExpression:
+		visit(&node.Left, f)
+		visit(&node.Start, f)
+		visit(&node.End, f)
+
+	case *RangeExpression:
+		visit(&node.Start, f)
+		visit(&node.End, f)
+
+	case *TryExpression:
+		visit(&node.Block, f)
+		visit(&node.CatchParam, f)
+		visit(&node.Catch, f)
+		visit(&node.Finally, f)
+
+	case *StructLiteral:
+		visit(&node.Name, f)
+		for i := range node.Fields {
+			visit(&node.Fields[i], f)
+			if i < len(node.Values) {
+				visit(&node.Values[i], f)
+			}
+		}
+
+	case *MemberExpression:
+		visit(&node.Object, f)
+		visit(&node.Member, f)
+
+	case *AssignExpression:
+		visit(&node.Target, f)
+		visit(&node.Value, f)
+
+	case *MatchExpression:
+		visit(&node.Subject, f)
+		for _, arm := range node.Arms {
+			visit(&arm.Variant, f)
+			visitAll(arm.Bindings, f)
+			visit(&arm.Body, f)
+		}
+
+	case *ArrayType:
+		visit(&node.Element, f)
+
+	case *FunctionType:
+		visitAll(node.Parameters, f)
+		visit(&node.Result, f)
+	}
+}
+
+func visit[T interface {
+	comparable
+	Node
+}](child *T, f func(Node) Node) {
+	var none T
+	if *child == none {
+		return
+	}
+	if next := f(*child); next != Node(*child) {
+		*child, _ = next.(T)
+	}
+}
+
+func visitAll[T interface {
+	comparable
+	Node
+}](children []T, f func(Node) Node) {
+	for i := range children {
+		visit(&children[i], f)
+	}
+}
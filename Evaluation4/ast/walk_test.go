@@ -0,0 +1,182 @@
+package ast_test
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// uses every kind of node, with x in every place an identifier can be
+const everyKind = `let x = 5; return -x * (2 + 3);
+if (x < 1) { x } else { x };
+let f: func([int]): bool = func(x: [int]) { x(x)[x] };
+xs[x:x]; x..x; x ?? x; x.x = x;
+try { throw x } catch (x) { x } finally { x };
+struct x { x; func m(x) { x } }
+x{x: x};
+enum x { x(x), y }
+match (x) { x(x) => x, _ => { x } };
+import "x" as x;
+export let y = macro(x) { x };
+infixl 6 <+> = x; x <+> true`
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestInspectVisitsEveryKind(t *testing.T) {
+	expected := []string{
+		"ArrayLiteral", "ArrayType", "AssignExpression", "BooleanExpression", "CallExpression",
+		"EnumStatement", "ExportStatement", "ExpressionStatement", "FunctionLiteral", "FunctionType",
+		"Identifier", "IfExpression", "ImportStatement", "IndexExpression",
+		"InfixExpression", "IntegerLiteral", "LetStatement", "MacroLiteral",
+		"MatchExpression", "MemberExpression", "OperatorStatement", "PrefixExpression",
+		"Program", "RangeExpression", "ReturnStatement", "SliceExpression",
+		"StatementBlock", "StringLiteral", "StructLiteral", "StructStatement",
+		"ThrowStatement", "TryExpression", "TypeName",
+	}
+
+	program := parse(t, everyKind+"; [x]")
+	seen := map[string]bool{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node != nil {
+			seen[reflect.TypeOf(node).Elem().Name()] = true
+		}
+		return true
+	})
+
+	var kinds []string
+	for kind := range seen {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	if strings.Join(kinds, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong kinds visited.\nexpected=%v\ngot=%v", expected, kinds)
+	}
+}
+
+// renaming every x through Modify must reach each one, the same ones Inspect
+// sees
+func TestModifyReachesEveryIdentifier(t *testing.T) {
+	program := parse(t, everyKind)
+
+	inspected := 0
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok && ident.Value == "x" {
+			inspected++
+		}
+		return true
+	})
+
+	modified := 0
+	ast.Modify(program, func(node ast.Node) ast.Node {
+		if ident, ok := node.(*ast.Identifier); ok && ident.Value == "x" {
+			modified++
+			return &ast.Identifier{Token: ident.Token, Value: "z"}
+		}
+		if str, ok := node.(*ast.StringLiteral); ok {
+			return &ast.StringLiteral{Token: str.Token, Value: "z"}
+		}
+		return node
+	})
+
+	x := regexp.MustCompile(`\bx\b`)
+	if want := len(x.FindAllString(everyKind, -1)) - 1; inspected != want || modified != want {
+		t.Errorf("expected every x but the import path once, inspected=%d modified=%d want=%d", inspected, modified, want)
+	}
+	if s := program.String(); x.MatchString(s) {
+		t.Errorf("an x was not renamed: %s", s)
+	}
+}
+
+type recorder struct {
+	out   *[]string
+	depth int
+}
+
+func (r recorder) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		*r.out = append(*r.out, strings.Repeat(" ", r.depth-1)+"end")
+		return nil
+	}
+	*r.out = append(*r.out, strings.Repeat(" ", r.depth)+fmt.Sprintf("%T %s", node, node))
+	if _, ok := node.(*ast.FunctionLiteral); ok {
+		return nil
+	}
+	return recorder{r.out, r.depth + 1}
+}
+
+func TestWalk(t *testing.T) {
+	program := parse(t, "if (a) { f(b)[c] } else { func(d) { d } }")
+
+	var out []string
+	ast.Walk(recorder{out: &out}, program)
+
+	expected := []string{
+		"*ast.Program ifa (f(b)[c])else func(d) d",
+		" *ast.ExpressionStatement ifa (f(b)[c])else func(d) d",
+		"  *ast.IfExpression ifa (f(b)[c])else func(d) d",
+		"   *ast.Identifier a",
+		"   end",
+		"   *ast.StatementBlock (f(b)[c])",
+		"    *ast.ExpressionStatement (f(b)[c])",
+		"     *ast.IndexExpression (f(b)[c])",
+		"      *ast.CallExpression f(b)",
+		"       *ast.Identifier f",
+		"       end",
+		"       *ast.Identifier b",
+		"       end",
+		"      end",
+		"      *ast.Identifier c",
+		"      end",
+		"     end",
+		"    end",
+		"   end",
+		"   *ast.StatementBlock func(d) d",
+		"    *ast.ExpressionStatement func(d) d",
+		"     *ast.FunctionLiteral func(d) d",
+		"    end",
+		"   end",
+		"  end",
+		" end",
+		"end",
+	}
+	if strings.Join(out, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong walk.\nexpected=\n%s\ngot=\n%s", strings.Join(expected, "\n"), strings.Join(out, "\n"))
+	}
+}
+
+func TestModifyTypes(t *testing.T) {
+	program := parse(t, "let a = b; if (c) { d }")
+
+	// an expression cannot take the place of a block, the block is dropped
+	ast.Modify(program, func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			return &ast.IntegerLiteral{Token: node.Token, Value: 1}
+		case *ast.StatementBlock:
+			return &ast.Identifier{Value: "e"}
+		}
+		return node
+	})
+
+	let := program.Statements[0].(*ast.LetStatement)
+	if _, ok := let.Value.(*ast.IntegerLiteral); !ok || let.Name != nil {
+		t.Errorf("expected the let name dropped and its value replaced, got name=%v value=%T", let.Name, let.Value)
+	}
+	ifExpr := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if _, ok := ifExpr.Condition.(*ast.IntegerLiteral); !ok || ifExpr.Consequence != nil {
+		t.Errorf("expected the condition replaced and the block dropped, got %T and %v", ifExpr.Condition, ifExpr.Consequence)
+	}
+}
@@ -0,0 +1,109 @@
+// Command monkeyfmt formats Monkey source files.
+//
+//	monkeyfmt [--write | --check] [--width n] [path ...]
+//
+// Without paths it formats standard input to standard output. Directories are
+// searched for .monkey files. By default the formatted files are printed,
+// --write rewrites them in place and --check lists the files that are not
+// formatted and exits with status 1 if there are any.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"interpreter/evaluator"
+	"interpreter/format"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var (
+	write = flag.Bool("write", false, "rewrite files in place")
+	check = flag.Bool("check", false, "list files whose formatting differs and fail if there are any")
+	width = flag.Int("width", format.DefaultWidth, "line width to stay within")
+)
+
+func main() {
+	flag.Parse()
+	if *write && *check {
+		fmt.Fprintln(os.Stderr, "monkeyfmt: --write and --check can't be used together")
+		os.Exit(2)
+	}
+	config := format.Config{Width: *width}
+
+	if flag.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err == nil {
+			var out []byte
+			out, err = format.Source(src, config)
+			if err == nil {
+				if *check && !bytes.Equal(src, out) {
+					fmt.Println("<stdin>")
+					os.Exit(1)
+				}
+				if !*check {
+					os.Stdout.Write(out)
+				}
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		return
+	}
+
+	status := 0
+	for _, path := range flag.Args() {
+		err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() || file != path && filepath.Ext(file) != evaluator.FileExtension {
+				return nil
+			}
+			changed, err := formatFile(file, config)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+				status = 2
+			} else if changed && *check {
+				fmt.Println(file)
+				if status == 0 {
+					status = 1
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 2
+		}
+	}
+	os.Exit(status)
+}
+
+// formatFile reports whether formatting changes file
+func formatFile(file string, config format.Config) (bool, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return false, err
+	}
+	out, err := format.Source(src, config)
+	if err != nil {
+		return false, err
+	}
+	changed := !bytes.Equal(src, out)
+
+	switch {
+	case *write:
+		if changed {
+			return true, os.WriteFile(file, out, 0644)
+		}
+	case !*check:
+		_, err = os.Stdout.Write(out)
+	}
+	return changed, err
+}
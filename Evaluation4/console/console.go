@@ -2,19 +2,63 @@ package console
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"interpreter/ast"
+	"interpreter/dot"
 	"interpreter/evaluator"
 	"interpreter/lexer"
+	"interpreter/lint"
+	"interpreter/manifest"
 	"interpreter/object"
+	"interpreter/optimizer"
 	"interpreter/parser"
+	"interpreter/resolver"
+	"interpreter/types"
 	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
 const PROMPT = ">> "
 
-func Go(in io.Reader, out io.Writer) {
+// commands look at the rest of the line they start instead of running it
+var commands = map[string]func(source string, out io.Writer){
+	// :dot shows the syntax tree as a Graphviz graph
+	":dot": func(source string, out io.Writer) {
+		p := parser.New(lexer.New(source))
+		program := p.ParseProgram()
+		for _, element := range p.Errors() {
+			fmt.Fprintln(out, element)
+		}
+		if len(p.Errors()) == 0 {
+			io.WriteString(out, dot.Graph(program))
+		}
+	},
+	// :trace shows how the expressions were parsed
+	":trace": func(source string, out io.Writer) {
+		p := parser.New(lexer.New(source), parser.WithTrace())
+		p.ParseProgram()
+		io.WriteString(out, parser.FormatTrace(p.Trace()))
+		for _, element := range p.Errors() {
+			fmt.Fprintln(out, element)
+		}
+	},
+}
+
+// Go runs the console. In strict mode, or once a line holds the strict
+// pragma, lines are only evaluated if their types can be inferred. With
+// options.Optimize each line is optimized before it runs.
+func Go(in io.Reader, out io.Writer, options Options) {
+	strict := options.Strict
+	evaluator.Output = out
 	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	env := newMainEnvironment()
+	macroEnv := object.NewEnvironment()
+	// the types of the names defined by earlier lines
+	typeEnv := types.NewEnv()
 
 	for {
 		fmt.Printf(PROMPT)
@@ -23,18 +67,322 @@ func Go(in io.Reader, out io.Writer) {
 			return
 		}
 		line := scanner.Text()
+
+		if name, source, ok := strings.Cut(line, " "); ok && commands[name] != nil {
+			commands[name](source, out)
+			continue
+		}
+		// :type shows the inferred type of an expression without running it
+		if strings.TrimSpace(line) == ":type" {
+			fmt.Fprintln(out, "usage: :type <expression>")
+			continue
+		}
+		if source, ok := strings.CutPrefix(line, ":type "); ok {
+			showType(source, env, macroEnv, typeEnv.Clone(), out)
+			continue
+		}
+
 		l := lexer.New(line)
 		p := parser.New(l)
 
 		program := p.ParseProgram()
-		for _, element := range p.Errors() {
-			fmt.Println(element)
+		if len(p.Errors()) != 0 {
+			for _, element := range p.Errors() {
+				fmt.Println(element)
+			}
+			continue
+		}
+
+		evaluator.DefineMacros(program, macroEnv)
+		expanded, err := evaluator.ExpandMacros(program, macroEnv)
+		if err != nil {
+			fmt.Println(err)
+			continue
 		}
 
-		evaluated := evaluator.Eval(program, env)
+		strict = strict || types.HasPragma(l.Comments())
+		table := resolveLine(expanded, env)
+		msgs := table.Errors
+		if len(msgs) == 0 {
+			// outside strict mode inference only keeps the types for :type
+			inferred := typeEnv.Infer(expanded, table).Errors
+			if strict {
+				msgs = inferred
+			} else {
+				info := types.Check(expanded, table)
+				for _, msg := range info.Warnings {
+					fmt.Fprintln(out, "warning:", msg)
+				}
+				msgs = info.Errors
+			}
+		}
+		if len(msgs) != 0 {
+			for _, msg := range msgs {
+				fmt.Println(msg)
+			}
+			continue
+		}
+
+		if options.Optimize != nil {
+			expanded = evaluator.Optimize(expanded, table, *options.Optimize)
+		}
+		evaluated := evaluator.Eval(expanded, env)
 		if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
 		}
 	}
 }
+
+// names defined by earlier lines are globals of this one
+func resolveLine(program ast.Node, env *object.Environment) *resolver.Table {
+	return resolver.Resolve(program, evaluator.IsBuiltin, func(name string) bool {
+		_, ok := env.Get(name)
+		return ok
+	})
+}
+
+// showType writes the type typeEnv infers for the last expression of source
+func showType(source string, env, macroEnv *object.Environment, typeEnv *types.Env, out io.Writer) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	msgs := p.Errors()
+	var expanded ast.Node
+	if len(msgs) == 0 {
+		var err error
+		expanded, err = evaluator.ExpandMacros(program, macroEnv)
+		if err != nil {
+			msgs = []string{err.Error()}
+		}
+	}
+	var info *types.Info
+	if len(msgs) == 0 {
+		table := resolveLine(expanded, env)
+		msgs = table.Errors
+		if len(msgs) == 0 {
+			info = typeEnv.Infer(expanded, table)
+			msgs = info.Errors
+		}
+	}
+	if len(msgs) != 0 {
+		for _, msg := range msgs {
+			fmt.Fprintln(out, msg)
+		}
+		return
+	}
+
+	statements := expanded.(*ast.Program).Statements
+	if len(statements) == 0 {
+		return
+	}
+	last, ok := statements[len(statements)-1].(*ast.ExpressionStatement)
+	if !ok {
+		fmt.Fprintln(out, "expected an expression")
+		return
+	}
+	fmt.Fprintln(out, types.Describe(info.Types[last.Expression]))
+}
+
+// Options change how Run checks and evaluates modules, and Go the lines.
+type Options struct {
+	// Strict infers the types of every module as if it had the strict pragma
+	Strict bool
+	// Optimize, when set, runs the optimizer over every module
+	Optimize *optimizer.Config
+}
+
+// Run evaluates a file as the main module and writes its result if it failed.
+// Inside a package, dependencies are checked against the lock file first.
+func Run(path string, options Options, out io.Writer) bool {
+	evaluator.Output = out
+	loader := evaluator.NewModuleLoader(searchPath()...)
+	loader.Strict = options.Strict
+	loader.Optimize = options.Optimize
+	loader.Warnings = out
+
+	resolver, err := packageResolver(filepath.Dir(path))
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return false
+	}
+	if resolver != nil {
+		loader.Packages = resolver
+	}
+
+	_, result := loader.EvalFile(path)
+	if result != nil && result.Type() == object.ERROR_OBJ {
+		io.WriteString(out, result.Inspect())
+		io.WriteString(out, "\n")
+		return false
+	}
+	return true
+}
+
+// imports typed into the console are resolved from the working directory
+func newMainEnvironment() *object.Environment {
+	dir, err := os.Getwd()
+	if err != nil {
+		dir = "."
+	}
+	loader := evaluator.NewModuleLoader(searchPath()...)
+	return loader.NewMainModule(dir).Env
+}
+
+// MONKEYPATH lists extra directories to import modules from
+func searchPath() []string {
+	return filepath.SplitList(os.Getenv("MONKEYPATH"))
+}
+
+// Lock writes the lock file for the package holding dir
+func Lock(dir string, out io.Writer) bool {
+	m, err := manifest.Find(dir)
+	if err == nil && m == nil {
+		err = fmt.Errorf("no %s in %s or its parents", manifest.FileName, dir)
+	}
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return false
+	}
+
+	resolver, err := manifest.NewResolver(m)
+	if err == nil {
+		var lock *manifest.Lockfile
+		lock, err = resolver.Lock()
+		if err == nil {
+			err = lock.Write(m.Dir)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return false
+	}
+	return true
+}
+
+// packageResolver is nil outside of a package
+func packageResolver(dir string) (*manifest.Resolver, error) {
+	m, err := manifest.Find(dir)
+	if err != nil || m == nil {
+		return nil, err
+	}
+
+	resolver, err := manifest.NewResolver(m)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Dependencies) == 0 {
+		return resolver, nil
+	}
+
+	lock, err := manifest.ReadLockfile(m.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s has dependencies but no %s, run lock first", m.Name, manifest.LockFileName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := resolver.Verify(lock); err != nil {
+		return nil, err
+	}
+	return resolver, nil
+}
+
+// DumpAST writes the JSON form of a file's syntax tree, or its parse errors.
+func DumpAST(path string, out io.Writer) bool {
+	program, ok := parseFile(path, out)
+	if !ok {
+		return false
+	}
+
+	data, err := ast.ToJSON(program)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return false
+	}
+	out.Write(data)
+	io.WriteString(out, "\n")
+	return true
+}
+
+// DumpDot writes a file's syntax tree as a Graphviz graph, or its parse errors.
+func DumpDot(path string, out io.Writer) bool {
+	program, ok := parseFile(path, out)
+	if !ok {
+		return false
+	}
+
+	io.WriteString(out, dot.Graph(program))
+	return true
+}
+
+// parseFile writes the errors if path cannot be read or parsed
+func parseFile(path string, out io.Writer) (*ast.Program, bool) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return nil, false
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintln(out, msg)
+		}
+		return nil, false
+	}
+	return program, true
+}
+
+// Lint writes the lint findings for the .monkey files in paths, searching
+// directories except vendored dependencies. Each file follows the [lint] table
+// of the manifest of its package. It returns false if anything was found.
+func Lint(paths []string, out io.Writer) bool {
+	var files []string
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			switch {
+			case err != nil:
+				return err
+			case entry.IsDir() && file != path && entry.Name() == manifest.VendorDir:
+				return filepath.SkipDir
+			case !entry.IsDir() && (file == path || filepath.Ext(file) == ".monkey"):
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return false
+		}
+	}
+
+	clean := true
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		var config lint.Config
+		if err == nil {
+			var m *manifest.Manifest
+			if m, err = manifest.Find(filepath.Dir(file)); m != nil {
+				config = m.Lint
+			}
+		}
+		var diagnostics []lint.Diagnostic
+		if err == nil {
+			diagnostics, err = lint.Check(string(source), config)
+		}
+		if err != nil {
+			for _, msg := range strings.Split(err.Error(), "\n") {
+				fmt.Fprintf(out, "%s: %s\n", file, msg)
+			}
+			clean = false
+			continue
+		}
+
+		for _, d := range diagnostics {
+			fmt.Fprintf(out, "%s:%s\n", file, d)
+		}
+		clean = clean && len(diagnostics) == 0
+	}
+	return clean
+}
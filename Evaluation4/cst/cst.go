@@ -0,0 +1,270 @@
+// Package cst is a concrete syntax tree: it keeps every token of the source
+// along with the whitespace and comments in front of it, so printing a tree
+// gives back the source it was parsed from byte for byte.
+package cst
+
+import (
+	"errors"
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"interpreter/token"
+	"reflect"
+	"strings"
+)
+
+// Element is a *Node or a *Token.
+type Element interface {
+	String() string
+	element()
+}
+
+// Token is a token as written in the source.
+type Token struct {
+	token.Token
+
+	// Trivia is the whitespace and comments between the previous token and
+	// this one
+	Trivia string
+
+	// Raw is the token's text, strings keep their quotes
+	Raw string
+}
+
+func (t *Token) element() {}
+
+func (t *Token) String() string { return t.Trivia + t.Raw }
+
+// Node is the part of the source an ast.Node was parsed from. Children holds
+// its tokens and the nodes of its children in source order. Lists like enum
+// variants and match arms have no node of their own, their parts belong to
+// the enclosing node.
+type Node struct {
+	AST      ast.Node
+	Children []Element
+	Parent   *Node
+}
+
+func (n *Node) element() {}
+
+func (n *Node) String() string {
+	var out strings.Builder
+	for _, child := range n.Children {
+		out.WriteString(child.String())
+	}
+	return out.String()
+}
+
+// Tokens returns the tokens under n in source order.
+func (n *Node) Tokens() []*Token {
+	var tokens []*Token
+	n.Walk(func(el Element) bool {
+		if tok, ok := el.(*Token); ok {
+			tokens = append(tokens, tok)
+		}
+		return true
+	})
+	return tokens
+}
+
+// Walk calls fn for n and everything under it in source order, skipping the
+// children of elements fn returns false for.
+func (n *Node) Walk(fn func(Element) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, child := range n.Children {
+		if node, ok := child.(*Node); ok {
+			node.Walk(fn)
+		} else {
+			fn(child)
+		}
+	}
+}
+
+// Tree is a parsed source file. The root node is the program and its last
+// token is EOF, whose trivia is whatever follows the last statement.
+type Tree struct {
+	Root *Node
+
+	source string
+}
+
+// Parse builds the tree for src, or returns the parse errors.
+func Parse(src string) (*Tree, error) {
+	p := parser.New(lexer.New(src), parser.WithSpans())
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	b := &builder{spans: p.Spans(), positions: map[[2]int]int{}}
+	b.lex(src)
+	root := b.build(program, parser.Span{Start: 0, End: len(b.tokens) - 1})
+	return &Tree{Root: root, source: src}, nil
+}
+
+// String prints the tree, which is the source it was parsed from until it is
+// edited.
+func (t *Tree) String() string {
+	return t.Root.String()
+}
+
+// AST parses the tree as it is now. Until the tree is edited this is the same
+// as Root.AST.
+func (t *Tree) AST() (*ast.Program, error) {
+	p := parser.New(lexer.New(t.String()))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+	return program, nil
+}
+
+// Find returns the nodes fn returns true for, outermost first.
+func (t *Tree) Find(fn func(*Node) bool) []*Node {
+	var found []*Node
+	t.Root.Walk(func(el Element) bool {
+		if node, ok := el.(*Node); ok && fn(node) {
+			found = append(found, node)
+		}
+		return true
+	})
+	return found
+}
+
+type builder struct {
+	tokens []*Token
+	spans  map[ast.Node]parser.Span
+
+	// index of the token at each line and column
+	positions map[[2]int]int
+}
+
+// lex splits src into tokens the same way the parser saw it, every byte
+// between two tokens being trivia of the second
+func (b *builder) lex(src string) {
+	lineStarts := []int{0}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+
+	l := lexer.New(src)
+	end := 0
+	for {
+		tok := l.GetToken()
+		if tok.Type == token.EOF {
+			b.tokens = append(b.tokens, &Token{Token: tok, Trivia: src[end:]})
+			return
+		}
+		start := lineStarts[tok.Line-1] + tok.Column - 1
+		b.positions[[2]int{tok.Line, tok.Column}] = len(b.tokens)
+		b.tokens = append(b.tokens, &Token{Token: tok, Trivia: src[end:start], Raw: src[start:l.Offset()]})
+		end = l.Offset()
+	}
+}
+
+type spanned struct {
+	node ast.Node
+	span parser.Span
+}
+
+func (b *builder) build(node ast.Node, span parser.Span) *Node {
+	n := &Node{AST: node}
+
+	i := span.Start
+	for _, child := range b.children(reflect.ValueOf(node)) {
+		if child.span.Start < i || child.span.End > span.End {
+			continue
+		}
+		for ; i < child.span.Start; i++ {
+			n.Children = append(n.Children, b.tokens[i])
+		}
+		c := b.build(child.node, child.span)
+		c.Parent = n
+		n.Children = append(n.Children, c)
+		i = child.span.End + 1
+	}
+	for ; i <= span.End; i++ {
+		n.Children = append(n.Children, b.tokens[i])
+	}
+	return n
+}
+
+// children returns the nodes directly below v sorted by where they start.
+// A node without a span, like the block of a match arm written without
+// braces, is skipped over to the nodes below it.
+func (b *builder) children(v reflect.Value) []spanned {
+	var found []spanned
+
+	var visit func(v reflect.Value)
+	visit = func(v reflect.Value) {
+		if v.Kind() == reflect.Interface {
+			v = v.Elem()
+		}
+		if !v.IsValid() || v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+			return
+		}
+		if node, ok := v.Interface().(ast.Node); ok {
+			if span, ok := b.span(node); ok {
+				found = append(found, spanned{node, span})
+				return
+			}
+		}
+		b.fields(v, visit)
+	}
+	b.fields(v, visit)
+
+	for i := 1; i < len(found); i++ {
+		for j := i; j > 0 && found[j].span.Start < found[j-1].span.Start; j-- {
+			found[j], found[j-1] = found[j-1], found[j]
+		}
+	}
+	return found
+}
+
+// fields calls visit for every pointer, interface and element of a slice
+// among the fields of the struct v points to
+func (b *builder) fields(v reflect.Value, visit func(reflect.Value)) {
+	s := v.Elem()
+	for i := 0; i < s.NumField(); i++ {
+		field := s.Field(i)
+		if !s.Type().Field(i).IsExported() {
+			continue
+		}
+		switch field.Kind() {
+		case reflect.Interface, reflect.Ptr:
+			visit(field)
+		case reflect.Slice:
+			for j := 0; j < field.Len(); j++ {
+				visit(field.Index(j))
+			}
+		}
+	}
+}
+
+// span is the recorded span of node, or for a single token node the parser
+// made without parsing an expression, like the name in a let, its token
+func (b *builder) span(node ast.Node) (parser.Span, bool) {
+	if span, ok := b.spans[node]; ok {
+		return span, true
+	}
+
+	var tok token.Token
+	switch node := node.(type) {
+	case *ast.Identifier:
+		tok = node.Token
+	case *ast.StringLiteral:
+		tok = node.Token
+	case *ast.IntegerLiteral:
+		tok = node.Token
+	case *ast.BooleanExpression:
+		tok = node.Token
+	default:
+		return parser.Span{}, false
+	}
+	i, ok := b.positions[[2]int{tok.Line, tok.Column}]
+	return parser.Span{Start: i, End: i}, ok
+}
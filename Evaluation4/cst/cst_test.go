@@ -0,0 +1,267 @@
+package cst
+
+import (
+	"interpreter/ast"
+	"strings"
+	"testing"
+)
+
+var inputs = []string{
+	"",
+	"  \n// only a comment\n",
+	"let  x=1+2*3",
+	"let x = (1 + ( 2 )) * 3 ;  // three\n-(a + b);!(!a)\n\n\n",
+	"\tstruct P { x, y; func f(self) { self.x } }\ntype Q {}\nP{x: 1, y: \"s\"}",
+	"enum E { A(x, y), B, }\nmatch (s) { A(x) => x, B => { 1 } }",
+	"import \"a/b\" as c;\nexport let d = [1, 2][0:1];\nexport struct R {}",
+	"let f = func(a,b){ // add\n  a+b\n}\r\nf(1, 2)?.(3)",
+	"try { a } catch (e) { b } finally { c }; if (a) { b } else { c }",
+	"infixl 6 <+> = func(a, b) { a + b }; 1 <+> 2 <+> 3",
+	"let m = macro(a) { quote(unquote(a)) }; p.x = q.y = a ?? b; 1..=3",
+	"\"unicode ✓\" // ✓\n",
+	"let f:func( int ):[ int ] = func(a : int, b) : [int] { [a] }",
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, input := range inputs {
+		tree, err := Parse(input)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", input, err)
+		}
+		if tree.String() != input {
+			t.Errorf("tree does not print its source.\nexpected=%q\ngot=%q", input, tree.String())
+		}
+		if tree.Diff() != "" {
+			t.Errorf("unedited tree has a diff:\n%s", tree.Diff())
+		}
+
+		program, err := tree.AST()
+		if err != nil {
+			t.Fatalf("AST of %q failed: %v", input, err)
+		}
+		if program.String() != tree.Root.AST.String() {
+			t.Errorf("AST of %q differs.\nexpected=%s\ngot=%s", input, tree.Root.AST, program)
+		}
+	}
+}
+
+// every node starts at its AST node's token, or at the parenthesis or left
+// operand in front of it, and an expression's text parses back to it
+func TestNodeText(t *testing.T) {
+	for _, input := range inputs {
+		if strings.Contains(input, "infixl") {
+			// declared operators mean nothing outside the program
+			continue
+		}
+		tree, err := Parse(input)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", input, err)
+		}
+		for _, node := range tree.Find(func(*Node) bool { return true }) {
+			if node.Parent == nil {
+				continue
+			}
+			tokens := node.Tokens()
+			if len(tokens) == 0 {
+				t.Errorf("%T node in %q has no tokens", node.AST, input)
+				continue
+			}
+			if _, ok := node.AST.(ast.Expression); !ok {
+				if tokens[0].Lexeme != node.AST.TokenLexeme() {
+					t.Errorf("%T node in %q starts at %q", node.AST, input, tokens[0].Raw)
+				}
+				continue
+			}
+			text := strings.TrimPrefix(node.String(), tokens[0].Trivia)
+			if _, ok := node.Parent.AST.(*ast.StructStatement); ok {
+				continue
+			}
+			sub, err := Parse(text)
+			if err != nil {
+				t.Errorf("text %q of %T node in %q does not parse: %v", text, node.AST, input, err)
+				continue
+			}
+			if sub.Root.AST.String() != node.AST.String() {
+				t.Errorf("text %q of %T node in %q parses as %s, expected %s", text, node.AST, input, sub.Root.AST, node.AST)
+			}
+		}
+	}
+}
+
+func TestStructure(t *testing.T) {
+	tree, err := Parse("let x = (1 + 2) * y; // c\nf(x)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var kinds []string
+	var describe func(n *Node, depth int)
+	describe = func(n *Node, depth int) {
+		var parts []string
+		for _, el := range n.Children {
+			switch el := el.(type) {
+			case *Token:
+				parts = append(parts, el.Raw)
+			case *Node:
+				parts = append(parts, "_")
+				describe(el, depth+1)
+			}
+		}
+		kinds = append(kinds, strings.Repeat(" ", depth)+typeName(n.AST)+" "+strings.Join(parts, " "))
+	}
+	describe(tree.Root, 0)
+
+	expected := []string{
+		"  Identifier x",
+		"    IntegerLiteral 1",
+		"    IntegerLiteral 2",
+		"   InfixExpression ( _ + _ )",
+		"   Identifier y",
+		"  InfixExpression _ * _",
+		" LetStatement let _ = _ ;",
+		"   Identifier f",
+		"   Identifier x",
+		"  CallExpression _ ( _ )",
+		" ExpressionStatement _",
+		"Program _ _ ",
+	}
+	if strings.Join(kinds, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong structure.\nexpected=\n%s\ngot=\n%s", strings.Join(expected, "\n"), strings.Join(kinds, "\n"))
+	}
+
+	eof := tree.Root.Children[len(tree.Root.Children)-1].(*Token)
+	if eof.Trivia != "" {
+		t.Errorf("expected no trailing trivia, got %q", eof.Trivia)
+	}
+	call := tree.Root.Children[1].(*Node).Children[0].(*Node)
+	if call.Children[0].(*Node).Children[0].(*Token).Trivia != " // c\n" {
+		t.Errorf("comment is not trivia of the next token: %q", call.Tokens()[0].Trivia)
+	}
+}
+
+func typeName(node ast.Node) string {
+	switch node.(type) {
+	case *ast.Program:
+		return "Program"
+	case *ast.LetStatement:
+		return "LetStatement"
+	case *ast.ExpressionStatement:
+		return "ExpressionStatement"
+	case *ast.Identifier:
+		return "Identifier"
+	case *ast.IntegerLiteral:
+		return "IntegerLiteral"
+	case *ast.InfixExpression:
+		return "InfixExpression"
+	case *ast.CallExpression:
+		return "CallExpression"
+	}
+	return "?"
+}
+
+func TestEdits(t *testing.T) {
+	input := "let total = 0; // sum\nlet unused = 1;\nlet f = func(a, b) {\n    a + b\n};\nf(total, 2)\n"
+	tree, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rename total
+	for _, tok := range tree.Root.Tokens() {
+		if tok.Raw == "total" {
+			tok.Raw = "sum"
+		}
+	}
+	// drop the unused let
+	unused := tree.Find(func(n *Node) bool {
+		let, ok := n.AST.(*ast.LetStatement)
+		return ok && let.Name.Value == "unused"
+	})
+	if err := unused[0].Remove(); err != nil {
+		t.Fatal(err)
+	}
+	// swap the body of f and log after defining it
+	body := tree.Find(func(n *Node) bool {
+		infix, ok := n.AST.(*ast.InfixExpression)
+		return ok && infix.Op == "+"
+	})
+	if err := body[0].Replace("a * (b + 1)"); err != nil {
+		t.Fatal(err)
+	}
+	let := tree.Find(func(n *Node) bool {
+		let, ok := n.AST.(*ast.LetStatement)
+		return ok && let.Name.Value == "f"
+	})
+	if err := let[0].InsertAfter("\nputs(f);"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "let sum = 0; // sum\nlet f = func(a, b) {\n    a * (b + 1)\n};\nputs(f);\nf(sum, 2)\n"
+	if tree.String() != expected {
+		t.Fatalf("wrong edit.\nexpected=%q\ngot=%q", expected, tree.String())
+	}
+	if _, err := tree.AST(); err != nil {
+		t.Errorf("edited tree does not parse: %v", err)
+	}
+
+	diff := `@@ -1,6 +1,6 @@
+-let total = 0; // sum
+-let unused = 1;
++let sum = 0; // sum
+ let f = func(a, b) {
+-    a + b
++    a * (b + 1)
+ };
+-f(total, 2)
++puts(f);
++f(sum, 2)
+`
+	if tree.Diff() != diff {
+		t.Errorf("wrong diff.\nexpected=\n%s\ngot=\n%s", diff, tree.Diff())
+	}
+}
+
+func TestEditErrors(t *testing.T) {
+	tree, err := Parse("let x = 1; x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	let := tree.Root.Children[0].(*Node)
+	value := let.Children[3].(*Node)
+
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{value.Replace("let y = 2;"), "expected an expression"},
+		{value.Replace("1; 2"), "expected a single statement"},
+		{value.Replace("1 +"), "no prefix parse function"},
+		{tree.Root.Remove(), "cannot remove the root"},
+		{value.InsertAfter("1"), "can only insert after a statement"},
+	}
+	for _, tt := range tests {
+		if tt.err == nil || !strings.Contains(tt.err.Error(), tt.expected) {
+			t.Errorf("expected error containing %q, got=%v", tt.expected, tt.err)
+		}
+	}
+	if tree.String() != "let x = 1; x" {
+		t.Errorf("failed edits changed the tree: %q", tree.String())
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		before, after string
+		expected      string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{"a\nb\nc\n", "a\nx\nc\n", "@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{"a\n", "", "@@ -1 +0,0 @@\n-a\n"},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n", "@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -7,4 +8,3 @@\n 7\n 8\n 9\n-10\n"},
+	}
+	for _, tt := range tests {
+		if got := Diff(tt.before, tt.after); got != tt.expected {
+			t.Errorf("wrong diff of %q and %q.\nexpected=\n%s\ngot=\n%s", tt.before, tt.after, tt.expected, got)
+		}
+	}
+}
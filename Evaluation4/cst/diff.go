@@ -0,0 +1,120 @@
+package cst
+
+import (
+	"fmt"
+	"strings"
+)
+
+// context is how many unchanged lines a hunk shows around a change
+const context = 3
+
+// Diff returns the changes made to t since it was parsed as a unified diff,
+// or "" if the text is unchanged.
+func (t *Tree) Diff() string {
+	return Diff(t.source, t.String())
+}
+
+// Diff compares before and after line by line and returns the fewest lines
+// removed and added that turn one into the other, as a unified diff.
+func Diff(before, after string) string {
+	if before == after {
+		return ""
+	}
+	a, b := splitLines(before), splitLines(after)
+
+	// common[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	type edit struct {
+		op   byte
+		line string
+		// line numbers in before and after, counting from 0
+		i, j int
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i], i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || common[i+1][j] >= common[i][j+1]):
+			edits = append(edits, edit{'-', a[i], i, j})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	var out strings.Builder
+	for start := 0; start < len(edits); {
+		if edits[start].op == ' ' {
+			start++
+			continue
+		}
+
+		// a hunk runs from context lines before the first change to context
+		// lines after the last change that is not followed by more than
+		// 2*context unchanged lines
+		from := max(start-context, 0)
+		end := start
+		for k := start; k < len(edits); k++ {
+			if edits[k].op != ' ' {
+				end = k + 1
+			} else if k-end >= 2*context {
+				break
+			}
+		}
+		to := min(end+context, len(edits))
+
+		removed, added := 0, 0
+		for _, e := range edits[from:to] {
+			if e.op != '+' {
+				removed++
+			}
+			if e.op != '-' {
+				added++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(edits[from].i, removed), hunkRange(edits[from].j, added))
+		for _, e := range edits[from:to] {
+			fmt.Fprintf(&out, "%c%s\n", e.op, e.line)
+		}
+		start = to
+	}
+	return out.String()
+}
+
+// hunkRange writes where a hunk starts and how many lines it covers the way
+// diff does, an empty range starting at the line before it
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,137 @@
+package cst
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"strings"
+)
+
+// Edits change the tree in place. Only the text changes: the AST field of the
+// nodes involved keeps describing the source as parsed, Tree.AST parses the
+// edited text again.
+
+// Replace swaps n for src parsed as the same kind of node, an expression for
+// an expression and a statement for a statement. The trivia in front of n is
+// kept, so the replacement lands where n was.
+func (n *Node) Replace(src string) error {
+	if n.Parent == nil {
+		return fmt.Errorf("cannot replace the root of a tree")
+	}
+
+	replacement, err := parseAs(src, n.AST)
+	if err != nil {
+		return err
+	}
+	if first, old := replacement.first(), n.first(); first != nil && old != nil {
+		first.Trivia = old.Trivia
+	}
+
+	replacement.Parent = n.Parent
+	n.Parent.Children[n.index()] = replacement
+	n.Parent = nil
+	return nil
+}
+
+// Remove takes n and the trivia in front of it out of the tree, except for a
+// comment at the end of the line before n, which belongs to that line.
+func (n *Node) Remove() error {
+	if n.Parent == nil {
+		return fmt.Errorf("cannot remove the root of a tree")
+	}
+
+	var kept []Element
+	if first := n.first(); first != nil {
+		end, _, _ := strings.Cut(first.Trivia, "\n")
+		if strings.TrimSpace(end) != "" {
+			kept = append(kept, &Token{Trivia: end})
+		}
+	}
+
+	i := n.index()
+	children := append([]Element{}, n.Parent.Children[:i]...)
+	children = append(children, kept...)
+	n.Parent.Children = append(children, n.Parent.Children[i+1:]...)
+	n.Parent = nil
+	return nil
+}
+
+// InsertAfter parses src as statements and puts them right after the
+// statement n. src is inserted as written, so it usually starts with a
+// newline.
+func (n *Node) InsertAfter(src string) error {
+	if _, ok := n.AST.(ast.Statement); !ok || n.Parent == nil {
+		return fmt.Errorf("can only insert after a statement, not %T", n.AST)
+	}
+
+	tree, err := Parse(src)
+	if err != nil {
+		return err
+	}
+	inserted := tree.Root.Children[:len(tree.Root.Children)-1]
+	for _, el := range inserted {
+		if node, ok := el.(*Node); ok {
+			node.Parent = n.Parent
+		}
+	}
+	// whatever followed the last statement in src goes in front of the
+	// statement after the insertion
+	eof := tree.Root.Children[len(tree.Root.Children)-1].(*Token)
+	if eof.Trivia != "" {
+		inserted = append(inserted, &Token{Trivia: eof.Trivia})
+	}
+
+	i := n.index() + 1
+	children := append([]Element{}, n.Parent.Children[:i]...)
+	children = append(children, inserted...)
+	n.Parent.Children = append(children, n.Parent.Children[i:]...)
+	return nil
+}
+
+func (n *Node) index() int {
+	for i, child := range n.Parent.Children {
+		if child == n {
+			return i
+		}
+	}
+	panic("cst: node is not a child of its parent")
+}
+
+func (n *Node) first() *Token {
+	tokens := n.Tokens()
+	if len(tokens) == 0 {
+		return nil
+	}
+	return tokens[0]
+}
+
+// parseAs parses src as a single node of the same kind as like
+func parseAs(src string, like ast.Node) (*Node, error) {
+	tree, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var stmt *Node
+	for _, el := range tree.Root.Children {
+		if node, ok := el.(*Node); ok {
+			if stmt != nil {
+				return nil, fmt.Errorf("expected a single statement in %q", src)
+			}
+			stmt = node
+		}
+	}
+	if stmt == nil {
+		return nil, fmt.Errorf("expected a single statement in %q", src)
+	}
+
+	switch like.(type) {
+	case ast.Statement:
+		return stmt, nil
+	case ast.Expression:
+		if _, ok := stmt.AST.(*ast.ExpressionStatement); !ok || len(stmt.Children) != 1 {
+			return nil, fmt.Errorf("expected an expression, got %q", src)
+		}
+		return stmt.Children[0].(*Node), nil
+	}
+	return nil, fmt.Errorf("cannot replace %T", like)
+}
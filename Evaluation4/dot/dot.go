@@ -0,0 +1,115 @@
+// Package dot renders syntax trees as Graphviz graphs, to see how a program
+// was grouped without reading parenthesized String() output.
+package dot
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/token"
+	"reflect"
+	"strings"
+)
+
+// Graph returns node and everything below it as a DOT digraph. Each node is a
+// box labelled with its kind and values, like an identifier's name or an
+// infix expression's operator, and each edge is labelled with the field that
+// holds the child, like Left or Arguments[1]. Missing children have no edge.
+func Graph(node ast.Node) string {
+	g := &graph{}
+	g.out.WriteString("digraph AST {\n")
+	g.out.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+	g.node(reflect.ValueOf(node))
+	g.out.WriteString("}\n")
+	return g.out.String()
+}
+
+type graph struct {
+	out   strings.Builder
+	nodes int
+}
+
+var tokenType = reflect.TypeOf(token.Token{})
+
+// node writes v, a pointer to a node or to a part of one like a match arm,
+// and returns its id
+func (g *graph) node(v reflect.Value) string {
+	id := fmt.Sprintf("n%d", g.nodes)
+	g.nodes++
+
+	s := v.Elem()
+	label := []string{s.Type().Name()}
+	type edge struct {
+		name  string
+		child reflect.Value
+	}
+	var edges []edge
+
+	for i := 0; i < s.NumField(); i++ {
+		field, f := s.Type().Field(i), s.Field(i)
+		if !field.IsExported() || field.Type == tokenType {
+			continue
+		}
+		switch f.Kind() {
+		case reflect.String, reflect.Int64, reflect.Bool:
+			if l := scalar(field.Name, f); l != "" {
+				label = append(label, l)
+			}
+		case reflect.Interface, reflect.Ptr:
+			if child, ok := deref(f); ok {
+				edges = append(edges, edge{field.Name, child})
+			}
+		case reflect.Slice:
+			for j := 0; j < f.Len(); j++ {
+				if child, ok := deref(f.Index(j)); ok {
+					edges = append(edges, edge{fmt.Sprintf("%s[%d]", field.Name, j), child})
+				}
+			}
+		}
+	}
+
+	fmt.Fprintf(&g.out, "\t%s [label=\"%s\"];\n", id, strings.Join(label, "\\n"))
+	for _, e := range edges {
+		child := g.node(e.child)
+		fmt.Fprintf(&g.out, "\t%s -> %s [label=\"%s\"];\n", id, child, e.name)
+	}
+	return id
+}
+
+// scalar is the label line for a field holding a value. Values and operators
+// stand on their own, other strings and numbers are named and flags only
+// show when set.
+func scalar(name string, v reflect.Value) string {
+	switch {
+	case name == "Value" || name == "Op" || name == "Operator":
+		return escape(fmt.Sprint(v.Interface()))
+	case v.Kind() == reflect.Bool:
+		if v.Bool() {
+			return name
+		}
+	case v.Kind() == reflect.String:
+		if v.String() != "" {
+			return name + ": " + escape(v.String())
+		}
+	default:
+		return fmt.Sprintf("%s: %d", name, v.Int())
+	}
+	return ""
+}
+
+// deref is the struct pointer held by v, if there is one
+func deref(v reflect.Value) (reflect.Value, bool) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	return v, true
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "", "\t", " ")
+
+// escape makes s safe inside a quoted DOT string
+func escape(s string) string {
+	return escaper.Replace(s)
+}
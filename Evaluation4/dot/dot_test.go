@@ -0,0 +1,80 @@
+package dot
+
+import (
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestGraph(t *testing.T) {
+	expected := `digraph AST {
+	node [shape=box, fontname="monospace"];
+	n0 [label="Program"];
+	n1 [label="ExpressionStatement"];
+	n2 [label="InfixExpression\n+"];
+	n3 [label="InfixExpression\n*"];
+	n4 [label="PrefixExpression\n-"];
+	n5 [label="Identifier\na"];
+	n4 -> n5 [label="Value"];
+	n3 -> n4 [label="Left"];
+	n6 [label="Identifier\nb"];
+	n3 -> n6 [label="Right"];
+	n2 -> n3 [label="Left"];
+	n7 [label="CallExpression"];
+	n8 [label="Identifier\nb"];
+	n7 -> n8 [label="Function"];
+	n9 [label="IntegerLiteral\n1"];
+	n7 -> n9 [label="Arguments[0]"];
+	n10 [label="StringLiteral\nsay \"hi\\"];
+	n7 -> n10 [label="Arguments[1]"];
+	n2 -> n7 [label="Right"];
+	n1 -> n2 [label="Expression"];
+	n0 -> n1 [label="Statements[0]"];
+}
+`
+	program := parse(t, `-a * b + b(1, "s")`)
+	program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression).
+		Right.(*ast.CallExpression).Arguments[1].(*ast.StringLiteral).Value = `say "hi\`
+
+	if got := Graph(program); got != expected {
+		t.Errorf("wrong graph.\nexpected=\n%s\ngot=\n%s", expected, got)
+	}
+}
+
+func TestGraphLabels(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"if (x) { 1 }", []string{`"IfExpression"`, `[label="Condition"]`, `[label="Consequence"]`, `"StatementBlock"`}},
+		{"if (x) { 1 } else { 2 }", []string{`[label="Alternative"]`}},
+		{"f?.(1); xs?.[0]; 1..=3; false", []string{`"CallExpression\nOptional"`, `"IndexExpression\nOptional"`, `"RangeExpression\nInclusive"`, `"BooleanExpression\nfalse"`}},
+		{"struct P { x; func len(self) { 0 } }", []string{`"FunctionLiteral\nName: len"`, `[label="Methods[0]"]`, `[label="Fields[0]"]`}},
+		{"match (s) { A(x) => x }", []string{`"MatchArm"`, `[label="Arms[0]"]`, `[label="Bindings[0]"]`}},
+		{"infixr 7 <*> = f", []string{`"OperatorStatement\nPrecedence: 7\n<*>"`}},
+	}
+
+	for _, tt := range tests {
+		got := Graph(parse(t, tt.input))
+		for _, want := range tt.expected {
+			if !strings.Contains(got, want) {
+				t.Errorf("graph of %q has no %s:\n%s", tt.input, want, got)
+			}
+		}
+	}
+
+	if got := Graph(parse(t, "if (x) { 1 }")); strings.Contains(got, "Alternative") {
+		t.Errorf("missing else has an edge:\n%s", got)
+	}
+}
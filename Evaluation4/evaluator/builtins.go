@@ -0,0 +1,225 @@
+package evaluator
+
+import (
+	"fmt"
+	"interpreter/object"
+	"io"
+	"os"
+)
+
+// Output is where puts writes
+var Output io.Writer = os.Stdout
+
+// builtins is filled in init, builtins calling back into applyFunction would
+// otherwise be an initialization cycle through Eval
+var builtins map[string]*object.Builtin
+
+func init() {
+	builtins = map[string]*object.Builtin{
+		"len": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *object.String:
+					return &object.Integer{Value: int64(len([]rune(arg.Value)))}
+				case *object.Array:
+					return &object.Integer{Value: int64(len(arg.Elements))}
+				case *object.Range:
+					return &object.Integer{Value: arg.Len()}
+				case *object.Instance:
+					method, ok := arg.Struct.Methods["__len__"]
+					if !ok {
+						break
+					}
+					length := applyFunction(&object.BoundMethod{Receiver: arg, Method: method}, nil)
+					if isError(length) {
+						return length
+					}
+					if length.Type() != object.INTEGER_OBJ {
+						return newError("__len__ must return INTEGER, got %s", length.Type())
+					}
+					return length
+				}
+				return newError("argument to `len` not supported, got %s", args[0].Type())
+			},
+		},
+		// list collects the elements of an array, string, range or an instance with __iter__
+		"list": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				elements, err := iterate(args[0])
+				if err != nil {
+					return err
+				}
+				return &object.Array{Elements: elements}
+			},
+		},
+		// puts writes each argument on a line of Output, statements without a
+		// value are written as null
+		"puts": {
+			Fn: func(args ...object.Object) object.Object {
+				for _, arg := range args {
+					if arg == nil {
+						arg = NULL
+					}
+					if str := instanceStr(arg); str != nil {
+						if isError(str) {
+							return str
+						}
+						arg = str
+					}
+					fmt.Fprintln(Output, arg.Inspect())
+				}
+				return NULL
+			},
+		},
+		// str uses Inspect, or the __str__ method of an instance
+		"str": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				if str, ok := args[0].(*object.String); ok {
+					return str
+				}
+				if str := instanceStr(args[0]); str != nil {
+					return str
+				}
+				return &object.String{Value: args[0].Inspect()}
+			},
+		},
+		// error(message) or error(message, kind) creates an error value without throwing it
+		"error": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 && len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+				}
+				message, ok := args[0].(*object.String)
+				if !ok {
+					return newError("argument to `error` must be STRING, got %s", args[0].Type())
+				}
+				kind := "Error"
+				if len(args) == 2 {
+					k, ok := args[1].(*object.String)
+					if !ok {
+						return newError("kind passed to `error` must be STRING, got %s", args[1].Type())
+					}
+					kind = k.Value
+				}
+				return &object.ErrorValue{Error: &object.Error{Message: message.Value, Kind: kind}}
+			},
+		},
+		// error_message, error_kind and error_stack inspect an error value, like
+		// its members message, kind and stack
+		"error_message": {
+			Fn: func(args ...object.Object) object.Object {
+				errVal, errObj := errorValueArgument("error_message", args)
+				if errObj != nil {
+					return errObj
+				}
+				return errorMember(errVal.Error, "message")
+			},
+		},
+		"error_kind": {
+			Fn: func(args ...object.Object) object.Object {
+				errVal, errObj := errorValueArgument("error_kind", args)
+				if errObj != nil {
+					return errObj
+				}
+				return errorMember(errVal.Error, "kind")
+			},
+		},
+		"error_stack": {
+			Fn: func(args ...object.Object) object.Object {
+				errVal, errObj := errorValueArgument("error_stack", args)
+				if errObj != nil {
+					return errObj
+				}
+				return errorMember(errVal.Error, "stack")
+			},
+		},
+		"callcc": callcc,
+	}
+}
+
+// IsBuiltin reports whether name is a builtin function, available to every
+// program without being declared.
+func IsBuiltin(name string) bool {
+	_, ok := builtins[name]
+	return ok
+}
+
+func errorValueArgument(name string, args []object.Object) (*object.ErrorValue, *object.Error) {
+	if len(args) != 1 {
+		return nil, newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	errVal, ok := args[0].(*object.ErrorValue)
+	if !ok {
+		return nil, newError("argument to `%s` must be ERROR_VALUE, got %s", name, args[0].Type())
+	}
+	return errVal, nil
+}
+
+// instanceStr is the result of the __str__ method of an instance, nil for
+// other values and instances without one
+func instanceStr(obj object.Object) object.Object {
+	if instance, ok := obj.(*object.Instance); ok {
+		if str := instance.Str(); str != nil {
+			return str
+		}
+	}
+	return nil
+}
+
+// iterate lists the elements of a value which can be looped over. An instance
+// is iterable when its __iter__ method returns an array, string, range or
+// another iterable instance.
+func iterate(obj object.Object) ([]object.Object, object.Object) {
+	return iterateFrom(obj, map[*object.Instance]bool{})
+}
+
+// iterateFrom fails on an instance whose __iter__ was already called for the
+// same value, which would go on forever
+func iterateFrom(obj object.Object, seen map[*object.Instance]bool) ([]object.Object, object.Object) {
+	switch obj := obj.(type) {
+	case *object.Array:
+		elements := make([]object.Object, len(obj.Elements))
+		copy(elements, obj.Elements)
+		return elements, nil
+	case *object.String:
+		elements := []object.Object{}
+		for _, r := range obj.Value {
+			elements = append(elements, &object.String{Value: string(r)})
+		}
+		return elements, nil
+	case *object.Range:
+		elements := make([]object.Object, obj.Len())
+		for i := range elements {
+			elements[i] = &object.Integer{Value: obj.Start + int64(i)}
+		}
+		return elements, nil
+	case *object.Instance:
+		method, ok := obj.Struct.Methods["__iter__"]
+		if !ok {
+			break
+		}
+		seen[obj] = true
+		iterable := applyFunction(&object.BoundMethod{Receiver: obj, Method: method}, nil)
+		if isError(iterable) {
+			return nil, iterable
+		}
+		if iterable == obj {
+			return nil, newError("__iter__ of %s returned the instance itself", obj.Struct.Name)
+		}
+		if next, ok := iterable.(*object.Instance); ok && seen[next] {
+			return nil, newError("__iter__ of %s returned an instance of %s which was already iterated", obj.Struct.Name, next.Struct.Name)
+		}
+		return iterateFrom(iterable, seen)
+	}
+	return nil, newError("%s is not iterable", obj.Type())
+}
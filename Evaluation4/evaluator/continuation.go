@@ -0,0 +1,85 @@
+package evaluator
+
+import "interpreter/object"
+
+// callcc(f) calls f with the continuation of the call to callcc, a function of
+// one argument which makes callcc return that argument, however often and from
+// wherever it is called. Calling it from inside f returns early, calling it
+// after callcc returned goes back in time, which gives generators and
+// backtracking. The finally blocks of the code a continuation leaves don't
+// run.
+//
+// Continuations are the stack of a Machine, so callcc needs UseMachine. A
+// continuation can be called while the evaluation that captured it runs, from
+// a builtin calling back into a function too, not after it finished.
+
+const continuationObj = "CONTINUATION"
+
+type continuation struct {
+	machine *Machine
+	stack   []*frame
+}
+
+func (k *continuation) Type() object.ObjectType { return continuationObj }
+func (k *continuation) Inspect() string         { return "continuation" }
+
+// callcc is the builtin the machine calls with its continuation, called
+// recursively there is no stack to capture
+var callcc = &object.Builtin{
+	Fn: func(args ...object.Object) object.Object {
+		return newError("callcc needs the machine evaluator, run with --machine")
+	},
+}
+
+// escape carries a continuation called by a machine evaluating a builtin's
+// call back to the machine it was captured by, unwinding the Go stack
+// between them
+type escape struct {
+	k     *continuation
+	value object.Object
+}
+
+func (m *Machine) callcc(args []object.Object) {
+	if len(args) != 1 {
+		m.ret(newError("wrong number of arguments. got=%d, want=1", len(args)))
+		return
+	}
+	k := &continuation{machine: m, stack: copyStack(m.stack)}
+	m.apply(args[0], []object.Object{k}, "")
+}
+
+// resume continues with k as if callcc returned args[0]
+func (m *Machine) resume(k *continuation, args []object.Object) {
+	if len(args) != 1 {
+		m.ret(newError("wrong number of arguments to continuation: want=1, got=%d", len(args)))
+		return
+	}
+	switch {
+	case k.machine == m:
+		m.restore(k, args[0])
+	case k.machine.stepping:
+		panic(&escape{k: k, value: args[0]})
+	default:
+		m.ret(newError("continuation called after its evaluation finished"))
+	}
+}
+
+func (m *Machine) restore(k *continuation, value object.Object) {
+	m.stack = copyStack(k.stack)
+	m.ret(value)
+}
+
+// copyStack copies the call frames, whose tail calls are added to as the
+// stack runs, the other frames are never changed and shared
+func copyStack(stack []*frame) []*frame {
+	copied := make([]*frame, len(stack))
+	for i, f := range stack {
+		if f.kind == callFrame {
+			c := *f
+			c.tail = append(tailFrames(nil), f.tail...)
+			f = &c
+		}
+		copied[i] = f
+	}
+	return copied
+}
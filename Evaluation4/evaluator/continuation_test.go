@@ -0,0 +1,122 @@
+package evaluator
+
+import (
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"os"
+	"testing"
+)
+
+func useMachine(t *testing.T, on bool) {
+	UseMachine = on
+	t.Cleanup(func() { UseMachine = os.Getenv("MONKEY_MACHINE") != "" })
+}
+
+func TestCallcc(t *testing.T) {
+	useMachine(t, true)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let r = callcc(func(k) { 1 + k(41) + 100 }); r + 1", "42"},
+		{"callcc(func(k) { 5 })", "5"},
+		// early exit out of a recursion which isn't in tail position
+		{`let find = func(arr, target) {
+			callcc(func(found) {
+				let walk = func(i) { if (i == len(arr)) { -1 } else { if (arr[i] == target) { found(i) } else { walk(i + 1) + 0 } } };
+				walk(0)
+			})
+		};
+		[find([5, 3, 8, 1], 8), find([5, 3], 4)]`, "[2, -1]"},
+		// going back to a let of the program
+		{`struct Box { k; n }
+		let b = Box{k: 0, n: 0};
+		let x = callcc(func(k) { b.k = k; 0 });
+		b.n = b.n + 1;
+		if (x < 3) { b.k(x + 1) } else { [x, b.n] }`, "[3, 4]"},
+		// a generator
+		{`struct Gen { body; ret; resume; started }
+		let next = func(gen) {
+			callcc(func(ret) {
+				gen.ret = ret;
+				if (gen.started) { gen.resume(0) } else {
+					gen.started = true;
+					gen.body(func(v) { callcc(func(k) { gen.resume = k; gen.ret(v) }) });
+					gen.ret("done")
+				}
+			})
+		};
+		let g = Gen{body: func(yield) { yield(1); yield(2); yield(3) }, started: false};
+		[next(g), next(g), next(g), next(g), next(g)]`, "[1, 2, 3, done, done]"},
+		// backtracking, choose returns again for every option a later fail rejects
+		{`struct Search { fail }
+		let s = Search{fail: func() { throw "no solution" }};
+		let choose = func(options) {
+			callcc(func(k) {
+				let prev = s.fail;
+				let attempt = func(rest) {
+					if (len(rest) == 0) { s.fail = prev; prev() } else {
+						callcc(func(next) { s.fail = func() { next(0) }; k(rest[0]) });
+						attempt(rest[1:])
+					}
+				};
+				attempt(options)
+			})
+		};
+		let a = choose([1, 2, 3, 4, 5]);
+		let b = choose([1, 2, 3, 4, 5]);
+		if (a + b != 7) { s.fail() };
+		if (a < b) { [a, b] } else { s.fail() }`, "[2, 5]"},
+		// out of a method a builtin calls
+		{`struct Bag { k; func __len__(self) { self.k(7) } }
+		callcc(func(k) { len(Bag{k: k}) + 100 })`, "7"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestCallccErrors(t *testing.T) {
+	useMachine(t, true)
+
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"callcc(func(k) { k(1, 2) })", "wrong number of arguments to continuation: want=1, got=2"},
+		{"callcc(1, 2)", "wrong number of arguments. got=2, want=1"},
+		{"callcc(func() { 1 })", "wrong number of arguments: want=0, got=1"},
+		{"callcc(func(k) { throw \"boom\" })", "boom"},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+
+	k := testEval("callcc(func(k) { k })")
+	env := object.NewEnvironment()
+	env.Set("k", k)
+	errObj, ok := NewMachine(parser.New(lexer.New("k(1)")).ParseProgram(), env).Run().(*object.Error)
+	if !ok || errObj.Message != "continuation called after its evaluation finished" {
+		t.Errorf("continuation called after its evaluation. got=%v", errObj)
+	}
+
+	useMachine(t, false)
+	errObj, ok = testEval("callcc(func(k) { 1 })").(*object.Error)
+	if !ok || errObj.Message != "callcc needs the machine evaluator, run with --machine" {
+		t.Errorf("callcc without the machine. got=%v", errObj)
+	}
+}
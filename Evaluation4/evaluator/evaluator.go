@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"interpreter/ast"
 	"interpreter/object"
+	"interpreter/token"
+	"math"
+	"path"
+	"strings"
 )
 
 var (
@@ -12,11 +16,29 @@ var (
 	NULL  = &object.Null{}
 )
 
+func init() {
+	object.ApplyMethod = func(method *object.Function, receiver object.Object, args ...object.Object) object.Object {
+		return applyFunction(&object.BoundMethod{Receiver: receiver, Method: method}, args)
+	}
+}
+
+// Eval evaluates node in env, on a Machine when UseMachine is set.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	if UseMachine {
+		return NewMachine(node, env).Run()
+	}
+	return evaluate(node, env)
+}
+
+// evaluate is Eval with a Go call for every node below node
+func evaluate(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+
 	case *ast.BooleanExpression:
 		return nativeBoolToBooleanObject(node.Value)
 
@@ -32,10 +54,16 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(left) {
 			return left
 		}
+		if node.Op == "??" {
+			return evaluateCoalesceExpression(left, node.Right, env)
+		}
 		right := Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
+		if node.Token.Type == token.OPERATOR {
+			return evaluateDeclaredOperator(node.Op, left, right, env)
+		}
 		return evaluateInfixExpression(left, right, node.Op)
 
 	case *ast.Program:
@@ -57,6 +85,40 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return &object.Return{Value: val}
 
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return throwValue(val)
+
+	case *ast.TryExpression:
+		return evaluateTryExpression(node, env)
+
+	case *ast.StructStatement:
+		evaluateStructStatement(node, env)
+
+	case *ast.StructLiteral:
+		return evaluateStructLiteral(node, env)
+
+	case *ast.EnumStatement:
+		env.Set(node.Name.Value, newEnum(node))
+
+	case *ast.MatchExpression:
+		return evaluateMatchExpression(node, env)
+
+	case *ast.ImportStatement:
+		return evaluateImportStatement(node, env)
+
+	case *ast.ExportStatement:
+		return evaluateExportStatement(node, env)
+
+	case *ast.MemberExpression:
+		return unskip(evaluateMemberLink(node, env))
+
+	case *ast.AssignExpression:
+		return evaluateAssignExpression(node, env)
+
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
 		if isError(val) {
@@ -64,6 +126,14 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		env.Set(node.Name.Value, val)
 
+	case *ast.OperatorStatement:
+		fn := Eval(node.Function, env)
+		if isError(fn) {
+			return fn
+		}
+		// operator symbols can't clash with identifiers, so they share the scope
+		env.Set(node.Operator, fn)
+
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 
@@ -72,29 +142,660 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		body := node.Body
 		return &object.Function{Parameters: params, Body: body, Env: env}
 
+	case *ast.MacroLiteral:
+		return newError("macro literals are only allowed in top level let statements")
+
+	case *ast.CallExpression:
+		return unskip(evaluateCallExpression(node, env, false))
+
+	case *ast.ArrayLiteral:
+		elements := evaluateExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+
+	case *ast.IndexExpression:
+		return unskip(evaluateIndexLink(node, env))
+
+	case *ast.SliceExpression:
+		return unskip(evaluateSliceExpression(node, env))
+
+	case *ast.RangeExpression:
+		start := Eval(node.Start, env)
+		if isError(start) {
+			return start
+		}
+		end := Eval(node.End, env)
+		if isError(end) {
+			return end
+		}
+		return evaluateRangeExpression(start, end, node.Inclusive)
+	}
+	return evaluateExtensionNode(node, env)
+}
+
+// Member, index, slice and call expressions are the links of a chain like
+// a?.b[0].c(). Once a ?. meets null, the links applied after it are skipped
+// and the whole chain is null. A link hands skipped to the link applied to it
+// then, anything else gets NULL. It has a type of its own, pointers to values
+// without fields like NULL can be equal.
+var skipped object.Object = &skippedLink{}
+
+type skippedLink struct{}
+
+func (s *skippedLink) Type() object.ObjectType { return object.NULL_OBJ }
+func (s *skippedLink) Inspect() string         { return "null" }
+
+// linkObject evaluates what a link applies to
+func linkObject(node ast.Expression, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	case *ast.MemberExpression:
+		return evaluateMemberLink(node, env)
+	case *ast.IndexExpression:
+		return evaluateIndexLink(node, env)
+	case *ast.SliceExpression:
+		return evaluateSliceExpression(node, env)
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		if isError(function) {
-			return function
+		return evaluateCallExpression(node, env, false)
+	}
+	return Eval(node, env)
+}
+
+// unskip is the value of a whole chain
+func unskip(obj object.Object) object.Object {
+	if obj == skipped {
+		return NULL
+	}
+	return obj
+}
+
+func evaluateMemberLink(node *ast.MemberExpression, env *object.Environment) object.Object {
+	obj := linkObject(node.Object, env)
+	if isError(obj) {
+		return obj
+	}
+	if obj == skipped || node.Optional && obj == NULL {
+		return skipped
+	}
+	return evaluateMemberExpression(obj, node.Member.Value)
+}
+
+func evaluateIndexLink(node *ast.IndexExpression, env *object.Environment) object.Object {
+	left := linkObject(node.Left, env)
+	if isError(left) {
+		return left
+	}
+	if left == skipped || node.Optional && left == NULL {
+		return skipped
+	}
+	index := Eval(node.Index, env)
+	if isError(index) {
+		return index
+	}
+	return evaluateIndexExpression(left, index)
+}
+
+func evaluateStructStatement(node *ast.StructStatement, env *object.Environment) {
+	fields := make([]string, len(node.Fields))
+	for i, f := range node.Fields {
+		fields[i] = f.Value
+	}
+	methods := make(map[string]*object.Function, len(node.Methods))
+	for _, m := range node.Methods {
+		methods[m.Name] = &object.Function{Parameters: m.Parameters, Body: m.Body, Env: env}
+	}
+	env.Set(node.Name.Value, &object.Struct{Name: node.Name.Value, Fields: fields, Methods: methods})
+}
+
+// fields left out of the literal start as NULL
+func evaluateStructLiteral(node *ast.StructLiteral, env *object.Environment) object.Object {
+	val := Eval(node.Name, env)
+	if isError(val) {
+		return val
+	}
+	structType, ok := val.(*object.Struct)
+	if !ok {
+		return newError("not a struct: %s", val.Type())
+	}
+
+	fields := make(map[string]object.Object, len(structType.Fields))
+	for _, f := range structType.Fields {
+		fields[f] = NULL
+	}
+
+	given := map[string]bool{}
+	for i, f := range node.Fields {
+		if !structType.HasField(f.Value) {
+			return newError("unknown field %s in struct %s", f.Value, structType.Name)
+		}
+		if given[f.Value] {
+			return newError("field %s given twice in struct %s", f.Value, structType.Name)
 		}
-		args := evaluateExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
+		given[f.Value] = true
+
+		value := Eval(node.Values[i], env)
+		if isError(value) {
+			return value
+		}
+		fields[f.Value] = value
+	}
+
+	return &object.Instance{Struct: structType, Fields: fields}
+}
+
+// fields are looked up before methods, Point.add gives the method without a receiver
+func evaluateMemberExpression(obj object.Object, name string) object.Object {
+	switch obj := obj.(type) {
+	case *object.Instance:
+		if value, ok := obj.Fields[name]; ok {
+			return value
+		}
+		if method, ok := obj.Struct.Methods[name]; ok {
+			return &object.BoundMethod{Receiver: obj, Method: method}
+		}
+		return newError("unknown field %s in struct %s", name, obj.Struct.Name)
+	case *object.Struct:
+		if method, ok := obj.Methods[name]; ok {
+			return method
+		}
+		return newError("unknown method %s in struct %s", name, obj.Name)
+	case *object.Enum:
+		variant, ok := obj.Variant(name)
+		if !ok {
+			return newError("unknown variant %s in enum %s", name, obj.Name)
+		}
+		if !variant.Constructor {
+			return variant.Value
+		}
+		return variant
+	case *object.Module:
+		value, ok := obj.Env.Get(name)
+		if !ok {
+			return newError("module %s has no member %s", obj.Name, name)
+		}
+		if !obj.Exports[name] {
+			return newError("%s is not exported by module %s", name, obj.Name)
+		}
+		return value
+	case *object.Variant:
+		for i, f := range obj.Variant.Fields {
+			if f == name {
+				return obj.Values[i]
+			}
+		}
+		return newError("unknown field %s in variant %s.%s", name, obj.Variant.Enum.Name, obj.Variant.Name)
+	case *object.ErrorValue:
+		return errorMember(obj.Error, name)
+	default:
+		return newError("member access not supported: %s.%s", obj.Type(), name)
+	}
+}
+
+// errorMember is a member of a caught error: its message, its kind, or its
+// stack, the calls it unwound through, innermost first
+func errorMember(err *object.Error, name string) object.Object {
+	switch name {
+	case "message":
+		return &object.String{Value: err.Message}
+	case "kind":
+		return &object.String{Value: err.Kind}
+	case "stack":
+		elements := make([]object.Object, len(err.Stack))
+		for i, frame := range err.Stack {
+			elements[i] = &object.String{Value: frame}
 		}
-		return applyFunction(function, args)
+		return &object.Array{Elements: elements}
+	default:
+		return newError("unknown field %s in ERROR_VALUE", name)
+	}
+}
+
+func evaluateAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	target, ok := node.Target.(*ast.MemberExpression)
+	if !ok {
+		return newError("cannot assign to %s", node.Target.String())
+	}
+
+	obj := Eval(target.Object, env)
+	if isError(obj) {
+		return obj
+	}
+	instance, ok := obj.(*object.Instance)
+	if !ok {
+		return newError("member assignment not supported: %s.%s", obj.Type(), target.Member.Value)
+	}
+	if !instance.Struct.HasField(target.Member.Value) {
+		return newError("unknown field %s in struct %s", target.Member.Value, instance.Struct.Name)
+	}
+
+	value := Eval(node.Value, env)
+	if isError(value) {
+		return value
+	}
+	instance.Fields[target.Member.Value] = value
+	return value
+}
+
+func evaluateImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	module := env.Module()
+	if module == nil || module.Loader == nil {
+		return newError("cannot import %q: no module loader", node.Path.Value)
 	}
+
+	imported := module.Loader.Import(module, node.Path.Value)
+	if isError(imported) {
+		return imported
+	}
+
+	// without an alias the module is named after the last part of the import path
+	name := path.Base(node.Path.Value)
+	name = strings.TrimSuffix(name, path.Ext(name))
+	if node.Alias != nil {
+		name = node.Alias.Value
+	}
+	env.Set(name, imported)
 	return nil
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
-	function, ok := fn.(*object.Function)
+func evaluateExportStatement(node *ast.ExportStatement, env *object.Environment) object.Object {
+	module := env.Module()
+	if module != nil && module.Env != env {
+		return newError("export of %s is only allowed at the top level of a module", node.Name())
+	}
+
+	result := Eval(node.Statement, env)
+	if isError(result) {
+		return result
+	}
+	if module != nil {
+		module.Exports[node.Name()] = true
+	}
+	return result
+}
+
+func newEnum(node *ast.EnumStatement) *object.Enum {
+	enum := &object.Enum{Name: node.Name.Value}
+	for _, v := range node.Variants {
+		variant := &object.EnumVariant{Enum: enum, Name: v.Name.Value, Constructor: v.Fields != nil}
+		for _, f := range v.Fields {
+			variant.Fields = append(variant.Fields, f.Value)
+		}
+		if !variant.Constructor {
+			variant.Value = &object.Variant{Variant: variant}
+		}
+		enum.Variants = append(enum.Variants, variant)
+	}
+	return enum
+}
+
+// Every arm is checked against the enum before one is picked, so a match
+// missing a variant, or with two arms for one, fails even when the value at
+// hand is handled.
+func evaluateMatchExpression(node *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := Eval(node.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+	body, armEnv, result := selectArm(node, subject, env)
+	if body == nil {
+		return result
+	}
+	return Eval(body, armEnv)
+}
+
+// selectArm finds the arm of node for subject and binds its values in a new
+// environment. Without an arm to evaluate, result is an error or NULL.
+func selectArm(node *ast.MatchExpression, subject object.Object, env *object.Environment) (body *ast.StatementBlock, armEnv *object.Environment, result object.Object) {
+	value, ok := subject.(*object.Variant)
 	if !ok {
-		return newError("not a function: %s", fn.Type())
+		return nil, nil, newError("match needs an enum value, got %s", subject.Type())
 	}
+	enum := value.Variant.Enum
 
-	functionEnv := extendedFunctionEnv(function, args)
-	evaluated := Eval(function.Body, functionEnv)
-	return unwrapReturnValue(evaluated)
+	handled := map[string]bool{}
+	wildcard := false
+	for _, arm := range node.Arms {
+		if arm.Variant.Value == "_" {
+			if wildcard {
+				return nil, nil, newError("match on %s has more than one arm for _", enum.Name)
+			}
+			wildcard = true
+			continue
+		}
+		variant, ok := enum.Variant(arm.Variant.Value)
+		if !ok {
+			return nil, nil, newError("unknown variant %s in enum %s", arm.Variant.Value, enum.Name)
+		}
+		// only the first arm for a variant would ever run
+		if handled[variant.Name] {
+			return nil, nil, newError("match on %s has more than one arm for %s", enum.Name, variant.Name)
+		}
+		if arm.Bindings != nil && len(arm.Bindings) != len(variant.Fields) {
+			return nil, nil, newError("pattern %s binds %d values, %s.%s has %d",
+				arm.Variant.Value, len(arm.Bindings), enum.Name, variant.Name, len(variant.Fields))
+		}
+		handled[variant.Name] = true
+	}
+
+	if !wildcard {
+		missing := []string{}
+		for _, v := range enum.Variants {
+			if !handled[v.Name] {
+				missing = append(missing, v.Name)
+			}
+		}
+		if len(missing) > 0 {
+			return nil, nil, newError("match on %s does not handle %s", enum.Name, strings.Join(missing, ", "))
+		}
+	}
+
+	for _, arm := range node.Arms {
+		if arm.Variant.Value != "_" && arm.Variant.Value != value.Variant.Name {
+			continue
+		}
+		armEnv := object.NewEnclosedEnvironment(env)
+		for i, b := range arm.Bindings {
+			if b.Value != "_" {
+				armEnv.Set(b.Value, value.Values[i])
+			}
+		}
+		return arm.Body, armEnv, nil
+	}
+
+	return nil, nil, NULL
+}
+
+// the default is only evaluated when the left side is NULL
+func evaluateCoalesceExpression(left object.Object, right ast.Expression, env *object.Environment) object.Object {
+	if left != NULL {
+		return left
+	}
+	return Eval(right, env)
+}
+
+func evaluateRangeExpression(start object.Object, end object.Object, inclusive bool) object.Object {
+	if start.Type() != object.INTEGER_OBJ || end.Type() != object.INTEGER_OBJ {
+		return newError("range bounds must be INTEGER, got %s..%s", start.Type(), end.Type())
+	}
+	r := &object.Range{
+		Start:     start.(*object.Integer).Value,
+		End:       end.(*object.Integer).Value,
+		Inclusive: inclusive,
+	}
+	// the length has to fit in an integer
+	n := r.End - r.Start
+	if r.End > r.Start && (n < 0 || r.Inclusive && n == math.MaxInt64) {
+		return newError("range %s is too long", r.Inspect())
+	}
+	return r
+}
+
+func evaluateIndexExpression(left object.Object, index object.Object) object.Object {
+	if index.Type() != object.INTEGER_OBJ {
+		return newError("index must be INTEGER, got %s", index.Type())
+	}
+	idx := index.(*object.Integer).Value
+
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := normalizeIndex(idx, int64(len(left.Elements)))
+		if !ok {
+			return NULL
+		}
+		return left.Elements[i]
+	case *object.String:
+		runes := []rune(left.Value)
+		i, ok := normalizeIndex(idx, int64(len(runes)))
+		if !ok {
+			return NULL
+		}
+		return &object.String{Value: string(runes[i])}
+	case *object.Range:
+		i, ok := normalizeIndex(idx, left.Len())
+		if !ok {
+			return NULL
+		}
+		return &object.Integer{Value: left.Start + i}
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+// negative indices count back from the end, -1 is the last element
+func normalizeIndex(idx int64, length int64) (int64, bool) {
+	if idx < 0 {
+		idx += length
+	}
+	return idx, idx >= 0 && idx < length
+}
+
+func evaluateSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := linkObject(node.Left, env)
+	if isError(left) {
+		return left
+	}
+	if left == skipped || node.Optional && left == NULL {
+		return skipped
+	}
+
+	var start, end object.Object
+	if node.Start != nil {
+		start = Eval(node.Start, env)
+		if isError(start) {
+			return start
+		}
+	}
+	if node.End != nil {
+		end = Eval(node.End, env)
+		if isError(end) {
+			return end
+		}
+	}
+	return sliceValue(left, start, end)
+}
+
+// sliceValue slices left, start and end are nil when left out
+func sliceValue(left object.Object, start object.Object, end object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		from, to, err := sliceBounds(start, end, int64(len(left.Elements)))
+		if err != nil {
+			return err
+		}
+		elements := make([]object.Object, to-from)
+		copy(elements, left.Elements[from:to])
+		return &object.Array{Elements: elements}
+	case *object.String:
+		runes := []rune(left.Value)
+		from, to, err := sliceBounds(start, end, int64(len(runes)))
+		if err != nil {
+			return err
+		}
+		return &object.String{Value: string(runes[from:to])}
+	case *object.Range:
+		from, to, err := sliceBounds(start, end, left.Len())
+		if err != nil {
+			return err
+		}
+		return &object.Range{Start: left.Start + from, End: left.Start + to}
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+}
+
+// sliceBounds resolves the optional, possibly negative, bounds of a slice
+// and clamps them to [0, length] the same way out of range indices give NULL
+func sliceBounds(start object.Object, end object.Object, length int64) (int64, int64, *object.Error) {
+	from, err := sliceBound(start, 0, length)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := sliceBound(end, length, length)
+	if err != nil {
+		return 0, 0, err
+	}
+	if from > to {
+		from = to
+	}
+	return from, to, nil
+}
+
+func sliceBound(bound object.Object, fallback int64, length int64) (int64, *object.Error) {
+	if bound == nil {
+		return fallback, nil
+	}
+	integer, ok := bound.(*object.Integer)
+	if !ok {
+		return 0, newError("slice bounds must be INTEGER, got %s", bound.Type())
+	}
+
+	idx := integer.Value
+	if idx < 0 {
+		idx += length
+	}
+	if idx < 0 {
+		return 0, nil
+	}
+	if idx > length {
+		return length, nil
+	}
+	return idx, nil
+}
+
+// evaluateCallExpression leaves a call in tail position to the applyFunction
+// running the function it is in
+func evaluateCallExpression(node *ast.CallExpression, env *object.Environment, tail bool) object.Object {
+	if node.Function.TokenLexeme() == "quote" {
+		if len(node.Arguments) != 1 {
+			return newError("wrong number of arguments to quote: want=1, got=%d", len(node.Arguments))
+		}
+		return quote(node.Arguments[0], env)
+	}
+	function := linkObject(node.Function, env)
+	if isError(function) {
+		return function
+	}
+	if function == skipped || node.Optional && function == NULL {
+		return skipped
+	}
+	args := evaluateExpressions(node.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+	if tail {
+		return &tailCall{function: function, args: args, name: callName(node)}
+	}
+	result := applyFunction(function, args)
+	if errObj, ok := result.(*object.Error); ok {
+		errObj.Stack = append(errObj.Stack, callName(node))
+	}
+	return result
+}
+
+// applyFunction calls fn and then, in a loop, the calls it left in tail
+// position, so they don't grow the Go stack
+func applyFunction(fn object.Object, args []object.Object) object.Object {
+	if UseMachine {
+		m := &Machine{Limit: StackLimit}
+		m.apply(fn, args, "")
+		return m.Run()
+	}
+
+	var tail tailFrames
+	for {
+		var result object.Object
+		switch function := fn.(type) {
+		case *object.Function:
+			if len(args) != len(function.Parameters) {
+				result = newError("wrong number of arguments: want=%d, got=%d",
+					len(function.Parameters), len(args))
+				break
+			}
+			functionEnv := extendedFunctionEnv(function, args)
+			evaluated := evaluateTailBlock(function.Body, functionEnv, true)
+			result = unwrapReturnValue(evaluated)
+		case *object.BoundMethod:
+			fn, args = function.Method, append([]object.Object{function.Receiver}, args...)
+			continue
+		case *object.Builtin:
+			result = function.Fn(args...)
+		case *object.EnumVariant:
+			if len(args) != len(function.Fields) {
+				result = newError("wrong number of arguments to %s.%s: want=%d, got=%d",
+					function.Enum.Name, function.Name, len(function.Fields), len(args))
+				break
+			}
+			result = &object.Variant{Variant: function, Values: args}
+		default:
+			result = newError("not a function: %s", fn.Type())
+		}
+
+		call, ok := result.(*tailCall)
+		if !ok {
+			if errObj, ok := result.(*object.Error); ok {
+				tail.unwind(errObj)
+			}
+			return result
+		}
+		fn, args = call.function, call.args
+		tail.push(call.name)
+	}
+}
+
+// callName is how a call shows up in an error's stack
+func callName(node *ast.CallExpression) string {
+	switch function := node.Function.(type) {
+	case *ast.Identifier:
+		return function.Value
+	case *ast.MemberExpression:
+		return function.Member.Value
+	default:
+		return "<anonymous>"
+	}
+}
+
+// throwValue turns an error value or a message into an Error that unwinds.
+// The Error is copied so frames added while unwinding don't change the thrown value.
+func throwValue(val object.Object) object.Object {
+	switch val := val.(type) {
+	case *object.ErrorValue:
+		stack := make([]string, len(val.Error.Stack))
+		copy(stack, val.Error.Stack)
+		return &object.Error{Message: val.Error.Message, Kind: val.Error.Kind, Stack: stack}
+	case *object.String:
+		return &object.Error{Message: val.Value, Kind: "Error"}
+	default:
+		return newError("can only throw ERROR_VALUE or STRING, got %s", val.Type())
+	}
+}
+
+// The catch block only runs for an Error, a return unwinds straight through.
+// The finally block always runs and its value is dropped, unless it raises an
+// error or returns, in which case that replaces the result of try and catch,
+// including an error which is still unwinding.
+func evaluateTryExpression(node *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(node.Block, env)
+
+	if errObj, ok := result.(*object.Error); ok && node.Catch != nil {
+		catchEnv := object.NewEnclosedEnvironment(env)
+		if node.CatchParam != nil {
+			catchEnv.Set(node.CatchParam.Value, &object.ErrorValue{Error: errObj})
+		}
+		result = Eval(node.Catch, catchEnv)
+	}
+
+	if node.Finally != nil {
+		finally := Eval(node.Finally, env)
+		if finally != nil {
+			ft := finally.Type()
+			if ft == object.RETURN_OBJ || ft == object.ERROR_OBJ {
+				return finally
+			}
+		}
+	}
+
+	return result
 }
 
 func unwrapReturnValue(evaluated object.Object) object.Object {
@@ -132,11 +833,13 @@ func evaluateExpressions(exps []ast.Expression, env *object.Environment) []objec
 }
 
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
-	val, ok := env.Get(node.Value)
-	if !ok {
-		return newError("identifier not found: " + node.Value)
+	if val, ok := env.Get(node.Value); ok {
+		return val
 	}
-	return val
+	if builtin, ok := builtins[node.Value]; ok {
+		return builtin
+	}
+	return newError("identifier not found: " + node.Value)
 }
 
 func isError(val object.Object) bool {
@@ -173,10 +876,57 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
+// operator methods a user defined type can implement, != is the negation of __eq__
+var operatorMethods = map[string]string{
+	"+":  "__add__",
+	"-":  "__sub__",
+	"*":  "__mul__",
+	"/":  "__div__",
+	"<":  "__lt__",
+	">":  "__gt__",
+	"==": "__eq__",
+	"!=": "__eq__",
+}
+
+// declared operators are called like any other two argument function
+func evaluateDeclaredOperator(op string, left, right object.Object, env *object.Environment) object.Object {
+	fn, ok := env.Get(op)
+	if !ok {
+		return newError("operator not defined: %s", op)
+	}
+	return applyFunction(fn, []object.Object{left, right})
+}
+
 func evaluateInfixExpression(left object.Object, right object.Object, op string) object.Object {
+	if fn, ok := extensionOperators[op]; ok {
+		if result := fn(left, right); result != nil {
+			return result
+		}
+	}
+
+	if instance, ok := left.(*object.Instance); ok {
+		if method, ok := instance.Struct.Methods[operatorMethods[op]]; ok {
+			result := applyFunction(&object.BoundMethod{Receiver: instance, Method: method}, []object.Object{right})
+			if op == "!=" && !isError(result) {
+				return nativeBoolToBooleanObject(!isTruthy(result))
+			}
+			return result
+		}
+	}
+
+	return evaluateBuiltinInfixExpression(left, right, op)
+}
+
+// evaluateBuiltinInfixExpression is what an operator does for the built in types
+func evaluateBuiltinInfixExpression(left object.Object, right object.Object, op string) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evaluateIntegerInfixExpression(left, right, op)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evaluateStringInfixExpression(left, right, op)
+	case left.Type() == object.VARIANT_OBJ && right.Type() == object.VARIANT_OBJ && (op == "==" || op == "!="):
+		equal := variantsEqual(left.(*object.Variant), right.(*object.Variant))
+		return nativeBoolToBooleanObject(equal == (op == "=="))
 	case left.Type() != right.Type():
 		return newError("type mismatch: %s %s %s",
 			left.Type(), op, right.Type())
@@ -190,6 +940,19 @@ func evaluateInfixExpression(left object.Object, right object.Object, op string)
 	}
 }
 
+// variants are equal when they share a tag and their values are equal with ==
+func variantsEqual(left *object.Variant, right *object.Variant) bool {
+	if left.Variant != right.Variant {
+		return false
+	}
+	for i := range left.Values {
+		if evaluateInfixExpression(left.Values[i], right.Values[i], "==") != TRUE {
+			return false
+		}
+	}
+	return true
+}
+
 func evaluateIntegerInfixExpression(left object.Object, right object.Object, op string) object.Object {
 	lVal := left.(*object.Integer).Value
 	rVal := right.(*object.Integer).Value
@@ -199,6 +962,9 @@ func evaluateIntegerInfixExpression(left object.Object, right object.Object, op
 	case "+":
 		return &object.Integer{Value: lVal + rVal}
 	case "/":
+		if rVal == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: lVal / rVal}
 	case "*":
 		return &object.Integer{Value: lVal * rVal}
@@ -220,6 +986,22 @@ func evaluateIntegerInfixExpression(left object.Object, right object.Object, op
 	}
 }
 
+func evaluateStringInfixExpression(left object.Object, right object.Object, op string) object.Object {
+	lVal := left.(*object.String).Value
+	rVal := right.(*object.String).Value
+	switch op {
+	case "+":
+		return &object.String{Value: lVal + rVal}
+	case "==":
+		return nativeBoolToBooleanObject(lVal == rVal)
+	case "!=":
+		return nativeBoolToBooleanObject(lVal != rVal)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), op, right.Type())
+	}
+}
+
 func evaluatePrefixExpression(operator string, right object.Object) object.Object {
 	switch operator {
 	case "!":
@@ -289,5 +1071,5 @@ func evaluateStatementBlock(block *ast.StatementBlock, env *object.Environment)
 }
 
 func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+	return &object.Error{Message: fmt.Sprintf(format, a...), Kind: "RuntimeError"}
 }
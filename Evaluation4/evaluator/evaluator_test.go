@@ -1,9 +1,20 @@
 package evaluator
 
 import (
+	"bytes"
+	"interpreter/ast"
 	"interpreter/lexer"
 	"interpreter/object"
+	"interpreter/optimizer"
 	"interpreter/parser"
+	"interpreter/resolver"
+	"interpreter/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -29,7 +40,8 @@ func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
-	return Eval(program)
+	env := object.NewEnvironment()
+	return Eval(program, env)
 }
 
 func TestEvalBooleanExpression(t *testing.T) {
@@ -58,3 +70,1315 @@ func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	}
 	return true
 }
+
+func TestStringConcatenation(t *testing.T) {
+	evaluated := testEval(`"Hello" + " " + "World!"`)
+	testStringObject(t, evaluated, "Hello World!")
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-4]", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"hello"[0]`, "h"},
+		{`"hello"[-1]`, "o"},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[2]`, "l"},
+		{`"hello"[5]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := tt.expected.(string)
+		if ok {
+			testStringObject(t, evaluated, str)
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3, 4][1:3]", "[2, 3]"},
+		{"[1, 2, 3, 4][:-1]", "[1, 2, 3]"},
+		{"[1, 2, 3, 4][2:]", "[3, 4]"},
+		{"[1, 2, 3, 4][:]", "[1, 2, 3, 4]"},
+		{"[1, 2, 3, 4][-2:]", "[3, 4]"},
+		{"[1, 2, 3, 4][3:1]", "[]"},
+		{"[1, 2, 3, 4][-10:10]", "[1, 2, 3, 4]"},
+		{`"hello"[2:]`, "llo"},
+		{`"héllo"[1:3]`, "él"},
+		{`"hello"[:-2]`, "hel"},
+		{"(1..10)[2:5]", "3..6"},
+		{"(1..=10)[-3:]", "8..11"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong slice for %q. want=%q, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestRangeExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"(1..10)[0]", 1},
+		{"(1..10)[-1]", 9},
+		{"(1..=10)[-1]", 10},
+		{"(1..10)[9]", nil},
+		{"(0..1000000000000)[999999999999]", 999999999999},
+		{"(5..1)[0]", nil},
+		{"(0..9223372036854775807)[-1]", 9223372036854775806},
+		{"(-9223372036854775807..0)[0]", -9223372036854775807},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+
+	rng, ok := testEval("1..=10").(*object.Range)
+	if !ok {
+		t.Fatalf("object is not Range. got=%T", testEval("1..=10"))
+	}
+	if rng.Start != 1 || rng.End != 10 || !rng.Inclusive || rng.Len() != 10 {
+		t.Errorf("range has wrong bounds. got=%s (len %d)", rng.Inspect(), rng.Len())
+	}
+}
+
+func TestNullSafeOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = if (false) { 1 }; a?.[0]", nil},
+		{"let a = [1, 2]; a?.[1]", 2},
+		{"let a = if (false) { 1 }; a?.[1:]", nil},
+		{"let f = if (false) { 1 }; f?.(1)", nil},
+		{"let f = func(x) { x * 2 }; f?.(2)", 4},
+		{"let a = [[1], if (false) { 1 }]; a[1]?.[0]", nil},
+		{"let a = [[1], if (false) { 1 }]; a[0]?.[0]", 1},
+		{"let a = if (false) { 1 }; a ?? 5", 5},
+		{"let a = 1; a ?? 5", 1},
+		{"[1, 2][5] ?? 3", 3},
+		{"if (false) { 1 } ?? [][0] ?? 7", 7},
+		{"let cfg = [[1, 2]]; cfg[3]?.[0] ?? cfg[0]?.[-1]", 2},
+		// ?. skips the rest of the chain
+		{"let nil = if (false) { 1 }; nil?.x.y", nil},
+		{"let nil = if (false) { 1 }; nil?.[0][1].z", nil},
+		{"let f = if (false) { 1 }; f?.(1).x(2)[1:]", nil},
+		{"let a = [if (false) { 1 }]; a[0]?.x.y ?? 3", 3},
+		{"struct Box { v } let b = Box{v: [4]}; b?.v[0]", 4},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestNullSafeOperatorsShortCircuit(t *testing.T) {
+	tests := []string{
+		"let a = 1; a ?? missing",
+		"let f = if (false) { 1 }; f?.(missing) ?? 1",
+		"let a = if (false) { 1 }; a?.[missing] ?? 1",
+		"let nil = if (false) { 1 }; nil?.x[missing].f(missing) ?? 1",
+	}
+
+	for _, input := range tests {
+		evaluated := testEval(input)
+		testIntegerObject(t, evaluated, 1)
+	}
+
+	for _, input := range []string{
+		"let a = if (false) { 1 }; a[0]",
+		// only a null met by ?. ends the chain
+		"struct Box { v } let b = Box{v: if (false) { 1 }}; b?.v.x",
+		"let a = if (false) { 1 }; (if (true) { a?.x } else { 1 }).y",
+	} {
+		evaluated := testEval(input)
+		if _, ok := evaluated.(*object.Error); !ok {
+			t.Errorf("using NULL without ?. should fail for %q. got=%T(%+v)", input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestIndexErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`[1, 2]["a"]`, "index must be INTEGER, got STRING"},
+		{"5[0]", "index operator not supported: INTEGER"},
+		{`[1, 2][1:"a"]`, "slice bounds must be INTEGER, got STRING"},
+		{"true[1:]", "slice operator not supported: BOOLEAN"},
+		{`1.."a"`, "range bounds must be INTEGER, got INTEGER..STRING"},
+		{"len(-9223372036854775807..9223372036854775807)", "range -9223372036854775807..9223372036854775807 is too long"},
+		{"0..=9223372036854775807", "range 0..=9223372036854775807 is too long"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { missing } catch (e) { 2 }", 2},
+		{`try { throw "bad"; 1 } catch (e) { error_message(e) }`, "bad"},
+		{`try { throw error("bad", "ValueError") } catch (e) { error_kind(e) }`, "ValueError"},
+		{`try { throw "bad" } catch (e) { error_kind(e) }`, "Error"},
+		{"try { 1 + true } catch (e) { error_message(e) }", "type mismatch: INTEGER + BOOLEAN"},
+		{"try { 1 + true } catch (e) { error_kind(e) }", "RuntimeError"},
+		{"try { missing } catch { 3 }", 3},
+		{`let r = try { throw "x" } catch (e) { 0 }; r + 1`, 1},
+		// catching across function boundaries
+		{`let f = func() { throw "deep" }; let g = func() { f() + 1 }; try { g() } catch (e) { error_message(e) }`, "deep"},
+		// the error value is a plain value until thrown again
+		{`let e = error("x"); let v = e; error_kind(v)`, "Error"},
+		{`try { try { throw "a" } catch (e) { throw e } } catch (e) { error_message(e) }`, "a"},
+		// the members are the same as the builtins and don't take the names from programs
+		{`let message = "m"; let kind = "k"; try { throw error(message, kind) } catch (e) { e.kind + e.message }`, "km"},
+		{`let f = func() { throw "a" }; try { f() } catch (e) { str(e.stack) + e.kind }`, "[f]Error"},
+		{`let f = func() { throw "a" }; try { f() } catch (e) { str(error_stack(e)) + error_kind(e) }`, "[f]Error"},
+		// division by zero is a runtime error too
+		{"try { 1 / 0 } catch (e) { error_message(e) }", "division by zero"},
+		{"let f = func(n) { 10 / n }; try { f(0) } catch (e) { error_kind(e) }", "RuntimeError"},
+		// a return in a try still returns from the function
+		{"let f = func() { try { return 1 } catch (e) { 2 }; 3 }; f()", 1},
+		{"let f = func() { try { missing } catch (e) { return 2 }; 3 }; f()", 2},
+		// keep going after bad records
+		{`let parse = func(x) { if (x < 0) { throw "negative" } x };
+		  let safe = func(x) { try { parse(x) } catch (e) { 0 } };
+		  safe(1) + safe(-5) + safe(3)`, 4},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestTryFinally(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// finally runs and its value is dropped
+		{"let r = try { 1 } finally { 5 }; r", 1},
+		{"try { missing } catch (e) { 2 } finally { 5 }", 2},
+		// an error raised in finally replaces the result, even a pending error
+		{`try { try { 1 } finally { throw "fin" } } catch (e) { error_message(e) }`, "fin"},
+		{`try { try { throw "body" } finally { throw "fin" } } catch (e) { error_message(e) }`, "fin"},
+		{`try { try { throw "body" } catch (e) { throw "catch" } finally { 1 } } catch (e) { error_message(e) }`, "catch"},
+		// a pending error passes through a finally without catch
+		{`try { try { throw "body" } finally { 1 } } catch (e) { error_message(e) }`, "body"},
+		// a return in finally wins
+		{"let f = func() { try { return 1 } finally { return 2 } }; f()", 2},
+		{"let f = func() { try { missing } finally { return 2 } }; f()", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+
+	evaluated := testEval(`try { throw "body" } finally { 1 }`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "body" {
+		t.Errorf("error should unwind past finally. got=%T(%+v)", evaluated, evaluated)
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	input := `
+	let inner = func() { throw "boom" };
+	let outer = func() { inner() };
+	try { outer() } catch (e) { error_stack(e) }`
+
+	evaluated := testEval(input)
+	if evaluated == nil || evaluated.Inspect() != "[inner, outer]" {
+		t.Errorf("wrong stack. want=%q, got=%v", "[inner, outer]", evaluated)
+	}
+
+	evaluated = testEval(input[:len(input)-len("try { outer() } catch (e) { error_stack(e) }")] + "outer()")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if len(errObj.Stack) != 2 || errObj.Stack[0] != "inner" || errObj.Stack[1] != "outer" {
+		t.Errorf("wrong stack on uncaught error. got=%v", errObj.Stack)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	// without tail calls these need far more Go stack than this
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let count = func(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(300000, 0)", 300000},
+		{"let count = func(n) { if (n == 0) { return 0 }; return count(n - 1) }; count(300000)", 0},
+		{`let even = func(n) { if (n == 0) { true } else { odd(n - 1) } };
+		let odd = func(n) { if (n == 0) { false } else { even(n - 1) } };
+		if (even(300001)) { 1 } else { 2 }`, 2},
+		{`struct C { n; func down(self, k) { if (k == 0) { self.n } else { self.down(k - 1) } } }
+		C{n: 7}.down(300000)`, 7},
+		{"let f = func(n) { if (n > 0) { if (true) { return f(n - 1) } }; n }; f(300000)", 0},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTailCallErrorStack(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let fail = func() { throw "boom" };
+		let loop = func(n) { if (n == 0) { fail() } else { loop(n - 1) } };
+		let start = func() { loop(2) };
+		try { start() } catch (e) { e.stack }`, "[fail, loop (x3), start]"},
+		{`let fail = func() { throw "boom" };
+		let loop = func(n) { if (n == 0) { fail() } else { loop(n - 1) } };
+		let start = func() { loop(300000) };
+		try { start() } catch (e) { e.stack }`, "[fail, loop (x300001), start]"},
+		// only the innermost names of a mutual recursion are kept
+		{`let fail = func() { throw "boom" };
+		let even = func(n) { if (n == 0) { fail() } else { odd(n - 1) } };
+		let odd = func(n) { if (n == 0) { fail() } else { even(n - 1) } };
+		let start = func() { even(1000) };
+		try { start() } catch (e) { let s = e.stack; [len(s), s[0], s[1], s[len(s) - 2], s[len(s) - 1]] }`,
+			"[42, fail, even, ... (962 more calls), start]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong stack. want=%s, got=%s", tt.expected, inspect(evaluated))
+		}
+	}
+}
+
+func TestPuts(t *testing.T) {
+	var out strings.Builder
+	Output = &out
+	defer func() { Output = os.Stdout }()
+
+	evaluated := testEval(`let h = func() { let q = 1; }; puts(h(), 1, "a", [2])`)
+	if evaluated != NULL {
+		t.Errorf("puts didn't return null. got=%v", evaluated)
+	}
+	if out.String() != "null\n1\na\n[2]\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
+func TestErrorBuiltins(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"throw 1", "can only throw ERROR_VALUE or STRING, got INTEGER"},
+		{"error(1)", "argument to `error` must be STRING, got INTEGER"},
+		{`error("a", 1)`, "kind passed to `error` must be STRING, got INTEGER"},
+		{`error_message("a")`, "argument to `error_message` must be ERROR_VALUE, got STRING"},
+		{"error_kind()", "wrong number of arguments. got=0, want=1"},
+		{`error("a").line`, "unknown field line in ERROR_VALUE"},
+		{`message(error("a"))`, "identifier not found: message"},
+		{"1 / 0", "division by zero"},
+		{"let f = func(a, b) { a }; f(1)", "wrong number of arguments: want=2, got=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"struct Point { x, y }; let p = Point{x: 1, y: 2}; p.x + p.y", 3},
+		{"struct Point { x, y }; Point{y: 2}.y", 2},
+		{"struct Point { x, y }; Point{y: 2}.x", nil},
+		{"struct Point { x, y }; let p = Point{x: 1, y: 2}; p.x = 5; p.x", 5},
+		{"struct Point { x, y }; let p = Point{x: 1, y: 2}; let q = p; q.y = 7; p.y", 7},
+		{"struct Point { x, y }; let p = Point{x: 1, y: 2}; p.x = p.y = 4; p.x + p.y", 8},
+		{"struct Box { v }; let b = Box{v: Box{v: 3}}; b.v.v", 3},
+		{"struct Box { v }; let b = Box{}; b.v?.v", nil},
+		{"struct Box { v }; let b = if (false) { 1 }; b?.v ?? 9", 9},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+
+	evaluated := testEval("struct Point { x, y }; Point{x: 1, y: [2]}")
+	if evaluated == nil || evaluated.Inspect() != "Point{x: 1, y: [2]}" {
+		t.Errorf("wrong instance. got=%v", evaluated)
+	}
+}
+
+func TestMethods(t *testing.T) {
+	vector := `
+	type Vec {
+		x, y;
+		func add(self, other) { Vec{x: self.x + other.x, y: self.y + other.y} }
+		func scale(self, k) { Vec{x: self.x * k, y: self.y * k} }
+		func __add__(self, other) { self.add(other) }
+		func __mul__(self, k) { self.scale(k) }
+		func __eq__(self, other) { self.x == other.x }
+		func __str__(self) { "<" + str(self.x) + ", " + str(self.y) + ">" }
+		func __len__(self) { 2 }
+		func __iter__(self) { [self.x, self.y] }
+	};
+	let a = Vec{x: 1, y: 2};
+	let b = Vec{x: 3, y: 4};
+	`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a.add(b)", "<4, 6>"},
+		{"a.add(b).scale(2).x", "8"},
+		{"Vec.add(a, b)", "<4, 6>"},
+		{"let m = a.scale; m(3)", "<3, 6>"},
+		{"a + b", "<4, 6>"},
+		{"a + b * 2", "<7, 10>"},
+		{"a == Vec{x: 1, y: 9}", "true"},
+		{"a == b", "false"},
+		{"a != b", "true"},
+		{"str(a)", "<1, 2>"},
+		{"[a, b]", "[<1, 2>, <3, 4>]"},
+		{"len(a)", "2"},
+		{"list(b)", "[3, 4]"},
+		{"try { a - b } catch (e) { e.message }", "unknown operator: INSTANCE - INSTANCE"},
+		{"try { a.nope() } catch (e) { e.message }", "unknown field nope in struct Vec"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(vector + tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestProtocolBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`len("héllo")`, "5"},
+		{"len([1, 2, 3])", "3"},
+		{"len(1..=10)", "10"},
+		{"list(1..4)", "[1, 2, 3]"},
+		{`list("abc")`, "[a, b, c]"},
+		{"str([1, 2])", "[1, 2]"},
+		{"type T { func __iter__(self) { 0..2 } }; list(T{})", "[0, 1]"},
+		{"type T { func __len__(self) { true } }; try { len(T{}) } catch (e) { e.message }",
+			"__len__ must return INTEGER, got BOOLEAN"},
+		{"type T { x }; try { len(T{}) } catch (e) { e.message }",
+			"argument to `len` not supported, got INSTANCE"},
+		{"try { list(1) } catch (e) { e.message }", "INTEGER is not iterable"},
+		{"type T { func __iter__(self) { self } }; try { list(T{}) } catch (e) { e.message }",
+			"__iter__ of T returned the instance itself"},
+		{`type A { b; func __iter__(self) { self.b } }; type B { a; func __iter__(self) { self.a } };
+			let a = A{b: 0}; a.b = B{a: a}; try { list(a) } catch (e) { e.message }`,
+			"__iter__ of B returned an instance of A which was already iterated"},
+		{"type T { func __str__(self) { self } }; try { puts(T{}) } catch (e) { e.message }",
+			"__str__ must return STRING, got INSTANCE"},
+		{"type T { func __str__(self) { 1 } }; try { str(T{}) } catch (e) { e.message }",
+			"__str__ must return STRING, got INTEGER"},
+		{"type T { func __str__(self) { } }; try { str(T{}) } catch (e) { e.message }",
+			"__str__ must return STRING, got NULL"},
+		{"type T { func __str__(self) { self } }; [T{}]", "[ERROR: __str__ must return STRING, got INSTANCE]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestEnums(t *testing.T) {
+	shapes := `
+	enum Shape { Circle(r), Rect(w, h), Empty };
+	let area = func(s) {
+		match (s) {
+			Circle(r) => 3 * r * r,
+			Rect(w, h) => { w * h },
+			Empty => 0
+		}
+	};
+	`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"area(Shape.Circle(2))", "12"},
+		{"area(Shape.Rect(2, 5))", "10"},
+		{"area(Shape.Empty)", "0"},
+		{"Shape.Rect(2, 5)", "Shape.Rect(2, 5)"},
+		{"Shape.Empty", "Shape.Empty"},
+		{"Shape.Rect(2, 5).h", "5"},
+		{"let c = Shape.Circle; c(1)", "Shape.Circle(1)"},
+		{"Shape.Circle(1) == Shape.Circle(1)", "true"},
+		{"Shape.Circle(1) == Shape.Circle(2)", "false"},
+		{"Shape.Circle(1) != Shape.Rect(1, 1)", "true"},
+		{"Shape.Empty == Shape.Empty", "true"},
+		{"match (Shape.Rect(1, 2)) { Circle(r) => r, _ => 99 }", "99"},
+		{"match (Shape.Rect(1, 2)) { Rect(_, h) => h, _ => 99 }", "2"},
+		{"match (Shape.Rect(1, 2)) { Rect => 7, _ => 99 }", "7"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(shapes + tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestEnumErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"match (Shape.Circle(1)) { Circle(r) => r }", "match on Shape does not handle Rect, Empty"},
+		{"match (Shape.Circle(1)) { Circle(r) => r, Tri => 1, _ => 0 }", "unknown variant Tri in enum Shape"},
+		{"match (Shape.Circle(1)) { Circle(r, x) => r, _ => 0 }", "pattern Circle binds 2 values, Shape.Circle has 1"},
+		{"match (Shape.Circle(1)) { Circle(r) => r, Rect(w, h) => w, Circle(x) => 0, Empty => 1 }",
+			"match on Shape has more than one arm for Circle"},
+		{"match (Shape.Empty) { Rect(w, h) => w, _ => 0, _ => 1 }", "match on Shape has more than one arm for _"},
+		{"match (1) { _ => 0 }", "match needs an enum value, got INTEGER"},
+		{"Shape.Circle(1, 2)", "wrong number of arguments to Shape.Circle: want=1, got=2"},
+		{"Shape.Tri", "unknown variant Tri in enum Shape"},
+		{"Shape.Circle(1).w", "unknown field w in variant Shape.Circle"},
+		{"Shape.Empty()", "not a function: VARIANT"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval("enum Shape { Circle(r), Rect(w, h), Empty };" + tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestModules(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"lib/math.monkey": `
+			import "counter"
+			export let add = func(a, b) { counter.bump(); a + b };
+			export struct Point { x, y }
+			let secret = 42;`,
+		"lib/counter.monkey": `
+			struct Count { n }
+			export let count = Count{n: 0};
+			export let bump = func() { count.n = count.n + 1 };`,
+		"vendor/strs.monkey": `export let greet = func(name) { "hello " + name };`,
+		"main.monkey": `
+			import "lib/math" as m
+			import "./lib/counter"
+			import "strs"
+			let p = m.Point{x: m.add(1, 2), y: m.add(3, 4)};
+			[p.x, p.y, counter.count.n, strs.greet("bob")]`,
+	})
+
+	loader := NewModuleLoader(filepath.Join(dir, "vendor"))
+	module, result := loader.EvalFile(filepath.Join(dir, "main.monkey"))
+	if isError(result) {
+		t.Fatalf("module failed: %s", result.Inspect())
+	}
+	if result.Inspect() != "[3, 7, 2, hello bob]" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+	if module.Name != "main" {
+		t.Errorf("wrong module name. got=%q", module.Name)
+	}
+
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`import "lib/math" as m; m.secret`, "secret is not exported by module math"},
+		{`import "lib/math" as m; m.nope`, "module math has no member nope"},
+		{`import "nope"`, `cannot find module "nope.monkey"`},
+		{`import "./strs"`, `cannot find module "./strs.monkey"`},
+		{`import "cycle/a"`, "import cycle: a.monkey -> b.monkey -> a.monkey"},
+		{`let f = func() { export let x = 1 }; f()`, "export of x is only allowed at the top level of a module"},
+	}
+
+	writeModules(t, map[string]string{
+		"cycle/a.monkey": `import "b"`,
+		"cycle/b.monkey": `import "a"`,
+	}, dir)
+
+	for _, tt := range tests {
+		env := loader.NewMainModule(dir).Env
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := Eval(program, env)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+
+	evaluated := testEval(`import "lib/math"`)
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != `cannot import "lib/math": no module loader` {
+		t.Errorf("import without a loader should fail. got=%v", evaluated)
+	}
+}
+
+func TestModulesAreEvaluatedOnce(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"state.monkey": `
+			struct Cell { v }
+			export let cell = Cell{v: 0};
+			cell.v = cell.v + 1;`,
+		"a.monkey":    `import "state"; export let v = state.cell.v;`,
+		"b.monkey":    `import "state"; export let v = state.cell.v;`,
+		"main.monkey": `import "a"; import "b"; import "state"; [a.v, b.v, state.cell.v]`,
+	})
+
+	_, result := NewModuleLoader().EvalFile(filepath.Join(dir, "main.monkey"))
+	if result == nil || result.Inspect() != "[1, 1, 1]" {
+		t.Errorf("module evaluated more than once. got=%v", result)
+	}
+}
+
+// undefined names stop a module before any of it runs
+func TestModulesAreResolved(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"lib.monkey":  "export let v = 1;\nputs(\"lib ran\");\nlet f = func(a, a) { b }",
+		"main.monkey": `import "lib"; lib.v`,
+	})
+
+	_, result := NewModuleLoader().EvalFile(filepath.Join(dir, "main.monkey"))
+	errObj, ok := result.(*object.Error)
+	if !ok || !strings.HasSuffix(errObj.Message, "lib.monkey\": 3:17: duplicate parameter a; 3:22: undefined name b") {
+		t.Errorf("expected resolve errors. got=%v", result)
+	}
+}
+
+func TestModulesAreTypeChecked(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"lib.monkey":  "export let f = func(a: int): string { a };\nputs(\"lib ran\");",
+		"main.monkey": `import "lib"; lib.f(1)`,
+	})
+
+	_, result := NewModuleLoader().EvalFile(filepath.Join(dir, "main.monkey"))
+	errObj, ok := result.(*object.Error)
+	if !ok || !strings.HasSuffix(errObj.Message, "lib.monkey\": 1:39: cannot return int from a function returning string") {
+		t.Errorf("expected type errors. got=%v", result)
+	}
+}
+
+func TestUnannotatedModulesRunDespiteWarnings(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"main.monkey": `let r = try { "a" + 1 } catch (e) { 0 }; r`,
+	})
+
+	var warnings bytes.Buffer
+	loader := NewModuleLoader()
+	loader.Warnings = &warnings
+	_, result := loader.EvalFile(filepath.Join(dir, "main.monkey"))
+	testIntegerObject(t, result, 0)
+	if !strings.HasSuffix(warnings.String(), "main.monkey: warning: 1:19: type mismatch: string + int\n") {
+		t.Errorf("wrong warnings. got=%q", warnings.String())
+	}
+}
+
+func TestStrictModules(t *testing.T) {
+	tests := []struct {
+		files           map[string]string
+		strict          bool
+		expectedMessage string
+	}{
+		{map[string]string{
+			"lib.monkey":  "// monkey:strict\nexport let f = func(x) { if (x) { 1 } else { \"a\" } };",
+			"main.monkey": `import "lib"; lib.f(true)`,
+		}, false, "lib.monkey\": 2:26: cannot unify int with string in if (x) { 1 } else { \"a\" }"},
+		{map[string]string{
+			"main.monkey": "let f = func(x) { x + 1 }; f(\"a\")",
+		}, true, "/main.monkey: 1:29: cannot unify func(int): int with func(string): 'a in f(\"a\")"},
+		{map[string]string{
+			"main.monkey": "let f = func(x) { x + 1 }; f(\"a\")",
+		}, false, ""},
+	}
+
+	for _, tt := range tests {
+		dir := writeModules(t, tt.files)
+		loader := NewModuleLoader()
+		loader.Strict = tt.strict
+		_, result := loader.EvalFile(filepath.Join(dir, "main.monkey"))
+		errObj, ok := result.(*object.Error)
+		if tt.expectedMessage == "" {
+			if ok && strings.Contains(errObj.Message, "cannot unify") {
+				t.Errorf("gradual checking should not infer types. got=%s", errObj.Message)
+			}
+			continue
+		}
+		if !ok || !strings.HasSuffix(errObj.Message, tt.expectedMessage) {
+			t.Errorf("expected strict type errors. got=%v", result)
+		}
+	}
+}
+
+func TestOptimizedProgramsKeepTheirResults(t *testing.T) {
+	tests := []string{
+		"1 + 2 * 3 - 4 / 2",
+		"-(5 - 10) * 2 == 10",
+		"!(1 < 2) != !!\"a\"",
+		"\"foo\" + \"bar\" == \"foobar\"",
+		"1 + \"a\"",
+		"true + false",
+		"let x = 10; if (x > 5) { x * 2 } else { 0 }",
+		"if (true) { let a = 1 }; a + 1",
+		"if (0) { 1 } else { 2 }; 3",
+		"if (false) { 1 }",
+		"let x = if (\"\") { 1 } else { 2 }; x",
+		"let f = func() { if (true) { return 1; 2 }; 3 }; f()",
+		"let f = func(x) { return x; throw \"never\" }; f(7)",
+		"try { throw \"boom\"; 1 } catch (e) { e.message }",
+		"let sq = func(x) { x * x }; sq(3) + sq(4)",
+		"let a = 1; let f = func(x) { x + a }; let g = func(a) { f(a) }; g(10)",
+		"let first = func(xs) { xs[0] }; let xs = [4, 5]; first(xs) + first([6])",
+		"let add = func(a, b) { a + b }; add(\"x\", 1)",
+		"let k = func(a, b) { [a, b, len(a)] }; k(\"ab\", true)",
+		"struct P { x } let getX = func(p) { p.x }; let p = P{x: 3}; getX(p) * 2",
+		"let fact = func(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(5)",
+		"let m = macro(a) { quote(unquote(a) + (1 + 1)) }; m(2)",
+		"quote(1 + 2)",
+	}
+
+	for _, input := range tests {
+		program := testParseProgram(input)
+		macroEnv := object.NewEnvironment()
+		DefineMacros(program, macroEnv)
+		expanded, err := ExpandMacros(program, macroEnv)
+		if err != nil {
+			t.Fatalf("macro expansion failed for %q: %s", input, err)
+		}
+		expected := Eval(expanded, object.NewEnvironment())
+		table := resolver.Resolve(expanded, IsBuiltin, nil)
+		optimized := optimizer.Optimize(expanded, table, optimizer.Config{})
+		got := Eval(optimized, object.NewEnvironment())
+
+		if inspect(got) != inspect(expected) {
+			t.Errorf("optimizing %q changed its result. expected=%s, got=%s", input, inspect(expected), inspect(got))
+		}
+	}
+}
+
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+	return obj.Inspect()
+}
+
+func TestOptimizedModules(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"main.monkey": "let double = func(x) { x * 2 }; if (double(2) == 4) { 1 + 1 } else { 0 }",
+	})
+
+	loader := NewModuleLoader()
+	loader.Optimize = &optimizer.Config{}
+	_, result := loader.EvalFile(filepath.Join(dir, "main.monkey"))
+	testIntegerObject(t, result, 2)
+}
+
+func TestTypeAnnotationsAreIgnored(t *testing.T) {
+	input := `
+	let add = func(a: int, b: int): int { a + b };
+	let twice: func(func(int): int, int): int = func(f, x) { f(f(x)) };
+	let xs: [int] = [1, 2];
+	twice(func(n: int): int { add(n, xs[1]) }, 1)`
+
+	testIntegerObject(t, testEval(input), 5)
+}
+
+// writeModules writes files below dir, or a new temporary directory, and returns the directory
+func writeModules(t *testing.T, files map[string]string, dir ...string) string {
+	root := t.TempDir()
+	if len(dir) > 0 {
+		root = dir[0]
+	}
+	for name, source := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar)`, `foobar`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Fatalf("expected *object.Quote. got=%T (%+v)", evaluated, evaluated)
+		}
+
+		if quote.Node == nil {
+			t.Fatalf("quote.Node is nil")
+		}
+
+		if quote.Node.String() != tt.expected {
+			t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), tt.expected)
+		}
+	}
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(4))`, `4`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+		{`let foobar = 8; quote(foobar)`, `foobar`},
+		{`let foobar = 8; quote(unquote(foobar))`, `8`},
+		{`quote(unquote(true))`, `true`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{`let quotedInfixExpression = quote(4 + 4);
+		  quote(unquote(4 + 4) + unquote(quotedInfixExpression))`, `(8 + (4 + 4))`},
+		{`quote(f(unquote(1 + 1), [unquote("a")]))`, `f(2, [a])`},
+		{`quote(unquote([1]))`, `unquote([1])`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Fatalf("expected *object.Quote. got=%T (%+v)", evaluated, evaluated)
+		}
+
+		if quote.Node == nil {
+			t.Fatalf("quote.Node is nil")
+		}
+
+		if quote.Node.String() != tt.expected {
+			t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), tt.expected)
+		}
+	}
+}
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = func(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+
+	env := object.NewEnvironment()
+	program := testParseProgram(input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("Wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	_, ok := env.Get("number")
+	if ok {
+		t.Fatalf("number should not be defined")
+	}
+	_, ok = env.Get("function")
+	if ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment.")
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("Wrong number of macro parameters. got=%d", len(macro.Parameters))
+	}
+
+	if macro.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", macro.Parameters[0])
+	}
+	if macro.Parameters[1].String() != "y" {
+		t.Fatalf("parameter is not 'y'. got=%q", macro.Parameters[1])
+	}
+
+	expectedBody := "(x + y)"
+
+	if macro.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+			let infixExpression = macro() { quote(1 + 2); };
+
+			infixExpression();
+			`,
+			`(1 + 2)`,
+		},
+		{
+			`
+			let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+
+			reverse(2 + 2, 10 - 5);
+			`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`
+			let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+
+			unless(10 > 5, puts("not greater"), puts("greater"));
+			`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		{
+			`
+			let twice = macro(x) { quote(unquote(x) + unquote(x)); };
+
+			let f = func() { [twice(1)] };
+			`,
+			`let f = func() { [(1 + 1)] };`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := testParseProgram(tt.expected)
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("ExpandMacros failed: %s", err)
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal. want=%q, got=%q",
+				expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"let m = macro(x) { 1 }; m(2)", "macro m must return a quote, got INTEGER"},
+		{"let m = macro(x) { quote(x) }; m(1, 2)", "wrong number of arguments to macro m: want=1, got=2"},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+		if err == nil || err.Error() != tt.expectedError {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expectedError, err)
+		}
+	}
+}
+
+func TestMacrosInModules(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"main.monkey": `
+			let unless = macro(cond, cons, alt) {
+				quote(if (!(unquote(cond))) { unquote(cons) } else { unquote(alt) })
+			};
+			let assert = macro(cond, msg) {
+				quote(if (!(unquote(cond))) { throw unquote(msg) })
+			};
+			assert(1 < 2, "math is broken");
+			let evaluated = func() { throw "the other branch ran" };
+			unless(10 > 5, evaluated(), "greater")`,
+	})
+
+	_, result := NewModuleLoader().EvalFile(filepath.Join(dir, "main.monkey"))
+	if result == nil || result.Inspect() != "greater" {
+		t.Errorf("wrong result. got=%v", result)
+	}
+}
+
+func testParseProgram(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func TestStructErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"struct Point { x, y }; Point{z: 1}", "unknown field z in struct Point"},
+		{"struct Point { x, y }; Point{x: 1, x: 2}", "field x given twice in struct Point"},
+		{"struct Point { x, y }; Point{}.z", "unknown field z in struct Point"},
+		{"struct Point { x, y }; let p = Point{}; p.z = 1", "unknown field z in struct Point"},
+		{"let p = 1; p{x: 1}", "not a struct: INTEGER"},
+		{"let p = 1; p.x", "member access not supported: INTEGER.x"},
+		{"let p = [1]; p.x = 1", "member assignment not supported: ARRAY.x"},
+		{"struct Point { x, y }; let p = Point{}; p.x = missing", "identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testStringObject(t *testing.T, obj object.Object, expected string) bool {
+	result, ok := obj.(*object.String)
+	if !ok {
+		t.Errorf("object is not String. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%q, want=%q",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != NULL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
+
+type betweenExpression struct {
+	ast.CustomExpression
+	Token            token.Token
+	Value, Low, High ast.Expression
+}
+
+func (b *betweenExpression) TokenLexeme() string { return b.Token.Lexeme }
+func (b *betweenExpression) String() string {
+	return "(" + b.Value.String() + " between " + b.Low.String() + " and " + b.High.String() + ")"
+}
+
+var registerExtensions sync.Once
+
+func registerTestExtensions() {
+	registerExtensions.Do(func() {
+		token.RegisterKeyword("in", "IN")
+		token.RegisterKeyword("matches", "MATCHES")
+		token.RegisterKeyword("between", "BETWEEN")
+		token.RegisterKeyword("and", "AND")
+
+		parser.RegisterInfix("IN", parser.EQUALS, (*parser.Parser).ParseInfixExpression)
+		parser.RegisterInfix("MATCHES", parser.EQUALS, (*parser.Parser).ParseInfixExpression)
+		parser.RegisterInfix("BETWEEN", parser.EQUALS, func(p *parser.Parser, left ast.Expression) ast.Expression {
+			expr := &betweenExpression{Token: p.CurrentToken(), Value: left}
+			p.Advance()
+			expr.Low = p.ParseExpression(parser.EQUALS)
+			if !p.Expect("AND") {
+				return nil
+			}
+			p.Advance()
+			expr.High = p.ParseExpression(parser.EQUALS)
+			return expr
+		})
+
+		RegisterInfixOperator("in", func(left, right object.Object) object.Object {
+			elements, err := iterate(right)
+			if err != nil {
+				return err
+			}
+			for _, el := range elements {
+				if isTruthy(evaluateInfixExpression(left, el, "==")) {
+					return TRUE
+				}
+			}
+			return FALSE
+		})
+		RegisterInfixOperator("matches", func(left, right object.Object) object.Object {
+			str, ok1 := left.(*object.String)
+			pattern, ok2 := right.(*object.String)
+			if !ok1 || !ok2 {
+				return NewError("unknown operator: %s matches %s", left.Type(), right.Type())
+			}
+			matched, err := regexp.MatchString(pattern.Value, str.Value)
+			if err != nil {
+				return NewError("invalid pattern: %s", pattern.Value)
+			}
+			return nativeBoolToBooleanObject(matched)
+		})
+		// `+` on two arrays concatenates; anything else falls through
+		RegisterInfixOperator("+", func(left, right object.Object) object.Object {
+			l, ok1 := left.(*object.Array)
+			r, ok2 := right.(*object.Array)
+			if !ok1 || !ok2 {
+				return nil
+			}
+			return &object.Array{Elements: append(append([]object.Object{}, l.Elements...), r.Elements...)}
+		})
+		RegisterNode(&betweenExpression{}, func(node ast.Node, env *object.Environment) object.Object {
+			b := node.(*betweenExpression)
+			var vals []object.Object
+			for _, e := range []ast.Expression{b.Value, b.Low, b.High} {
+				val := Eval(e, env)
+				if isError(val) {
+					return val
+				}
+				vals = append(vals, val)
+			}
+			if vals[0].Type() != object.INTEGER_OBJ || vals[1].Type() != object.INTEGER_OBJ || vals[2].Type() != object.INTEGER_OBJ {
+				return NewError("between needs integers")
+			}
+			v := vals[0].(*object.Integer).Value
+			return nativeBoolToBooleanObject(vals[1].(*object.Integer).Value <= v && v <= vals[2].(*object.Integer).Value)
+		})
+	})
+}
+
+func TestRegisteredExtensions(t *testing.T) {
+	registerTestExtensions()
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"2 in [1, 2, 3]", true},
+		{"5 in (1..4)", false},
+		{`"a" in ["b", "a"]`, true},
+		{`"monkey" matches "^mon"`, true},
+		{`"ape" matches "^mon"`, false},
+		{"let x = 4; x between 1 and 2 * 2", true},
+		{"10 between 1 and 5", false},
+		{"len([1] + [2, 3])", 3},
+		{"1 + 2", 3},
+		{`1 matches "1"`, "unknown operator: INTEGER matches STRING"},
+		{`1 between "a" and 2`, "between needs integers"},
+		{"y between 1 and 2", "identifier not found: y"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			err, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if err.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, err.Message)
+			}
+		}
+	}
+}
+
+func TestDeclaredOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"infixl 6 <+> = func(a, b) { a + b * 10 }; 1 <+> 2", 21},
+		{"infixl 6 <-> = func(a, b) { a - b }; 10 <-> 3 <-> 2", 5},
+		{"infixr 6 <-> = func(a, b) { a - b }; 10 <-> 3 <-> 2", 9},
+		{"infixl 6 <.> = func(a, b) { a * b }; 1 + 2 <.> 3", 9},
+		{"infixl 7 <.> = func(a, b) { a * b }; 1 + 2 <.> 3", 7},
+		{`
+		struct Vec { x, y }
+		infixl 6 |+| = func(a, b) { Vec{x: a.x + b.x, y: a.y + b.y} }
+		infixl 7 *| = func(k, v) { Vec{x: k * v.x, y: k * v.y} }
+		let v = Vec{x: 1, y: 2} |+| 2 *| Vec{x: 3, y: 4};
+		v.x * 100 + v.y`, 710},
+		{"let f = func() { infixl 6 <+> = func(a, b) { a }; 0 }; f(); 1 <+> 2", "operator not defined: <+>"},
+		{"infixl 6 <+> = 5; 1 <+> 2", "not a function: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			err, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if err.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, err.Message)
+			}
+		}
+	}
+
+	evaluated := testEval(`infixr 5 <> = func(a, b) { "(" + a + b + ")" }; "a" <> "b" <> "c"`)
+	testStringObject(t, evaluated, "(a(bc))")
+}
@@ -0,0 +1,53 @@
+package evaluator
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/object"
+	"reflect"
+)
+
+// InfixOperator evaluates a registered infix operator on its evaluated operands.
+type InfixOperator func(left, right object.Object) object.Object
+
+// NodeEvaluator evaluates a node type the evaluator does not know about. It can
+// call Eval for the node's children and should return errors from them as is.
+type NodeEvaluator func(node ast.Node, env *object.Environment) object.Object
+
+var (
+	extensionOperators = map[string]InfixOperator{}
+	extensionNodes     = map[reflect.Type]NodeEvaluator{}
+)
+
+// RegisterInfixOperator makes op, as found in ast.InfixExpression.Op, evaluate
+// with fn. Registered operators are tried before the built in ones, so they
+// can also give existing operators a meaning for new operand types by
+// returning nil to fall through. Registering the same operator twice panics.
+func RegisterInfixOperator(op string, fn InfixOperator) {
+	if _, found := extensionOperators[op]; found {
+		panic(fmt.Sprintf("evaluator: operator %q already registered", op))
+	}
+	extensionOperators[op] = fn
+}
+
+// RegisterNode makes Eval hand nodes with the same dynamic type as node to fn.
+// This is the evaluation side of parse functions registered with the parser.
+func RegisterNode(node ast.Node, fn NodeEvaluator) {
+	nodeType := reflect.TypeOf(node)
+	if _, found := extensionNodes[nodeType]; found {
+		panic(fmt.Sprintf("evaluator: node %s already registered", nodeType))
+	}
+	extensionNodes[nodeType] = fn
+}
+
+// NewError returns a runtime error for extensions to return from their hooks.
+func NewError(format string, a ...interface{}) *object.Error {
+	return newError(format, a...)
+}
+
+func evaluateExtensionNode(node ast.Node, env *object.Environment) object.Object {
+	if fn, ok := extensionNodes[reflect.TypeOf(node)]; ok {
+		return fn(node, env)
+	}
+	return nil
+}
@@ -0,0 +1,730 @@
+package evaluator
+
+import (
+	"interpreter/ast"
+	"interpreter/object"
+	"interpreter/token"
+)
+
+// A Machine evaluates a node in a loop over an explicit stack of
+// continuations instead of with a Go call per node, so how deep a program can
+// recurse is bounded by Limit rather than by the Go stack. Each Step either
+// evaluates a node, pushing what to do with the values of its children, or
+// hands a value to the continuation on top of the stack.
+//
+// A call whose value goes straight to the function making it, like the last
+// expression of a body or a return, shares that function's frame, so tail
+// recursion runs in constant space as it does with Eval.
+type Machine struct {
+	// Limit is how many continuations the stack can hold, an evaluation
+	// needing more fails with a stack overflow error
+	Limit int
+
+	stack []*frame
+	// node is evaluated by the next step in env, when it is nil value is
+	// handed to the continuation on top of the stack
+	node  ast.Node
+	env   *object.Environment
+	value object.Object
+	// stepping is set during a step, continuations of the machine can be
+	// called by the machines of the builtins it calls
+	stepping bool
+}
+
+var (
+	// UseMachine makes Eval, and the calls builtins make, run on a Machine
+	UseMachine = false
+	// StackLimit is the Limit of new machines
+	StackLimit = 1 << 20
+)
+
+type frameKind int
+
+const (
+	otherFrame frameKind = iota
+	// blockFrame evaluates the next statement of a block, it hands a return
+	// on unchanged
+	blockFrame
+	// callFrame takes the value a function returns
+	callFrame
+)
+
+type frame struct {
+	kind frameKind
+	// resume takes the value of what the frame waited for, call frames are
+	// resumed by returned
+	resume func(v object.Object)
+	// the call a callFrame was pushed for and the calls made in tail position
+	// since, for the stack of an error
+	name string
+	tail tailFrames
+	// link is the link of a chain the frame waits for, which hands it
+	// skipped rather than NULL
+	link ast.Node
+}
+
+// NewMachine returns a machine ready to evaluate node in env.
+func NewMachine(node ast.Node, env *object.Environment) *Machine {
+	m := &Machine{Limit: StackLimit}
+	m.evalTail(node, env)
+	return m
+}
+
+// Run steps until the evaluation is done and returns its value.
+func (m *Machine) Run() object.Object {
+	for m.Step() {
+	}
+	return m.value
+}
+
+// Step makes one transition and reports whether there is more to do.
+func (m *Machine) Step() (more bool) {
+	m.stepping = true
+	defer func() {
+		m.stepping = false
+		if r := recover(); r != nil {
+			e, ok := r.(*escape)
+			if !ok || e.k.machine != m {
+				panic(r)
+			}
+			m.restore(e.k, e.value)
+			more = true
+		}
+	}()
+
+	if m.node != nil {
+		node, env := m.node, m.env
+		m.node, m.env = nil, nil
+		m.step(node, env)
+		return true
+	}
+	if len(m.stack) == 0 {
+		return false
+	}
+	top := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	if top.kind == callFrame {
+		m.returned(top, m.value)
+	} else {
+		top.resume(m.value)
+	}
+	return true
+}
+
+// Depth is how many continuations are on the stack.
+func (m *Machine) Depth() int {
+	return len(m.stack)
+}
+
+// Result is the value of the node once Step reported there is nothing left.
+func (m *Machine) Result() object.Object {
+	return m.value
+}
+
+func (m *Machine) push(f *frame) bool {
+	if len(m.stack) >= m.Limit {
+		m.ret(newError("stack overflow: more than %d frames", m.Limit))
+		return false
+	}
+	m.stack = append(m.stack, f)
+	return true
+}
+
+// eval evaluates node in env and hands its value to k
+func (m *Machine) eval(node ast.Node, env *object.Environment, k func(v object.Object)) {
+	if m.push(&frame{kind: otherFrame, resume: k}) {
+		m.evalTail(node, env)
+	}
+}
+
+// evalLink evaluates what a link applies to, see linkObject
+func (m *Machine) evalLink(node ast.Node, env *object.Environment, k func(v object.Object)) {
+	if m.push(&frame{kind: otherFrame, resume: k, link: node}) {
+		m.evalTail(node, env)
+	}
+}
+
+// skip ends link once a ?. of its chain met null
+func (m *Machine) skip(link ast.Node) {
+	if n := len(m.stack); n > 0 && m.stack[n-1].link == link {
+		m.ret(skipped)
+		return
+	}
+	m.ret(NULL)
+}
+
+// evalTail evaluates node in env and hands its value to the continuation on
+// top of the stack
+func (m *Machine) evalTail(node ast.Node, env *object.Environment) {
+	if node == nil {
+		m.ret(nil)
+		return
+	}
+	m.node, m.env = node, env
+}
+
+// ret hands v to the continuation on top of the stack
+func (m *Machine) ret(v object.Object) {
+	m.node, m.env, m.value = nil, nil, v
+}
+
+// evalAll evaluates exprs in order and hands their values to done, or the
+// first error to the continuation on top of the stack
+func (m *Machine) evalAll(exprs []ast.Expression, env *object.Environment, done func(values []object.Object)) {
+	m.evalFrom(exprs, nil, env, done)
+}
+
+// evalFrom evaluates the exprs after those whose values are given. A frame
+// can be resumed more than once through a continuation, so values is copied
+// rather than appended to in place.
+func (m *Machine) evalFrom(exprs []ast.Expression, values []object.Object, env *object.Environment, done func(values []object.Object)) {
+	if len(values) == len(exprs) {
+		done(values)
+		return
+	}
+	m.eval(exprs[len(values)], env, func(v object.Object) {
+		if isError(v) {
+			m.ret(v)
+			return
+		}
+		m.evalFrom(exprs, append(values[:len(values):len(values)], v), env, done)
+	})
+}
+
+// step does for node what evaluate does, with continuations instead of Go
+// calls for its children
+func (m *Machine) step(node ast.Node, env *object.Environment) {
+	switch node := node.(type) {
+	case *ast.Program:
+		m.statements(node.Statements, env)
+
+	case *ast.StatementBlock:
+		m.block(node.Statements, env)
+
+	case *ast.ExpressionStatement:
+		m.evalTail(node.Expression, env)
+
+	case *ast.PrefixExpression:
+		m.eval(node.Value, env, func(right object.Object) {
+			if isError(right) {
+				m.ret(right)
+				return
+			}
+			m.ret(evaluatePrefixExpression(node.Op, right))
+		})
+
+	case *ast.InfixExpression:
+		m.infix(node, env)
+
+	case *ast.IfExpression:
+		m.eval(node.Condition, env, func(condition object.Object) {
+			switch {
+			case isError(condition):
+				m.ret(condition)
+			case isTruthy(condition):
+				m.evalTail(node.Consequence, env)
+			case node.Alternative != nil:
+				m.evalTail(node.Alternative, env)
+			default:
+				m.ret(NULL)
+			}
+		})
+
+	case *ast.ReturnStatement:
+		if m.returnFromCall() {
+			m.evalTail(node.Value, env)
+			return
+		}
+		m.eval(node.Value, env, func(val object.Object) {
+			if isError(val) {
+				m.ret(val)
+				return
+			}
+			m.ret(&object.Return{Value: val})
+		})
+
+	case *ast.ThrowStatement:
+		m.eval(node.Value, env, func(val object.Object) {
+			if isError(val) {
+				m.ret(val)
+				return
+			}
+			m.ret(throwValue(val))
+		})
+
+	case *ast.TryExpression:
+		m.try(node, env)
+
+	case *ast.StructLiteral:
+		m.structLiteral(node, env)
+
+	case *ast.MatchExpression:
+		m.eval(node.Subject, env, func(subject object.Object) {
+			if isError(subject) {
+				m.ret(subject)
+				return
+			}
+			body, armEnv, result := selectArm(node, subject, env)
+			if body == nil {
+				m.ret(result)
+				return
+			}
+			m.evalTail(body, armEnv)
+		})
+
+	case *ast.ExportStatement:
+		module := env.Module()
+		if module != nil && module.Env != env {
+			m.ret(newError("export of %s is only allowed at the top level of a module", node.Name()))
+			return
+		}
+		m.eval(node.Statement, env, func(result object.Object) {
+			if !isError(result) && module != nil {
+				module.Exports[node.Name()] = true
+			}
+			m.ret(result)
+		})
+
+	case *ast.MemberExpression:
+		m.evalLink(node.Object, env, func(obj object.Object) {
+			switch {
+			case isError(obj):
+				m.ret(obj)
+			case obj == skipped || node.Optional && obj == NULL:
+				m.skip(node)
+			default:
+				m.ret(evaluateMemberExpression(obj, node.Member.Value))
+			}
+		})
+
+	case *ast.AssignExpression:
+		m.assign(node, env)
+
+	case *ast.LetStatement:
+		m.eval(node.Value, env, func(val object.Object) {
+			if isError(val) {
+				m.ret(val)
+				return
+			}
+			env.Set(node.Name.Value, val)
+			m.ret(nil)
+		})
+
+	case *ast.OperatorStatement:
+		m.eval(node.Function, env, func(fn object.Object) {
+			if isError(fn) {
+				m.ret(fn)
+				return
+			}
+			env.Set(node.Operator, fn)
+			m.ret(nil)
+		})
+
+	case *ast.CallExpression:
+		m.call(node, env)
+
+	case *ast.ArrayLiteral:
+		m.evalAll(node.Elements, env, func(elements []object.Object) {
+			m.ret(&object.Array{Elements: elements})
+		})
+
+	case *ast.IndexExpression:
+		m.evalLink(node.Left, env, func(left object.Object) {
+			if isError(left) {
+				m.ret(left)
+				return
+			}
+			if left == skipped || node.Optional && left == NULL {
+				m.skip(node)
+				return
+			}
+			m.eval(node.Index, env, func(index object.Object) {
+				if isError(index) {
+					m.ret(index)
+					return
+				}
+				m.ret(evaluateIndexExpression(left, index))
+			})
+		})
+
+	case *ast.SliceExpression:
+		m.slice(node, env)
+
+	case *ast.RangeExpression:
+		m.eval(node.Start, env, func(start object.Object) {
+			if isError(start) {
+				m.ret(start)
+				return
+			}
+			m.eval(node.End, env, func(end object.Object) {
+				if isError(end) {
+					m.ret(end)
+					return
+				}
+				m.ret(evaluateRangeExpression(start, end, node.Inclusive))
+			})
+		})
+
+	default:
+		// literals, declarations and nodes of extensions have no children
+		// for the machine to evaluate
+		m.ret(evaluate(node, env))
+	}
+}
+
+// statements runs a program, which stops at the first return or error
+func (m *Machine) statements(statements []ast.Statement, env *object.Environment) {
+	m.statement(statements, 0, env)
+}
+
+func (m *Machine) statement(statements []ast.Statement, i int, env *object.Environment) {
+	if i == len(statements) {
+		m.ret(nil)
+		return
+	}
+	m.eval(statements[i], env, func(result object.Object) {
+		switch result := result.(type) {
+		case *object.Return:
+			m.ret(result.Value)
+		case *object.Error:
+			m.ret(result)
+		default:
+			if i == len(statements)-1 {
+				m.ret(result)
+				return
+			}
+			m.statement(statements, i+1, env)
+		}
+	})
+}
+
+// block runs the statements of a block, a return or an error is handed on
+// as is. The last statement is evaluated in place of the block.
+func (m *Machine) block(statements []ast.Statement, env *object.Environment) {
+	if len(statements) == 0 {
+		m.ret(nil)
+		return
+	}
+	m.blockStatement(statements, 0, env)
+}
+
+func (m *Machine) blockStatement(statements []ast.Statement, i int, env *object.Environment) {
+	if i == len(statements)-1 {
+		m.evalTail(statements[i], env)
+		return
+	}
+	next := func(result object.Object) {
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_OBJ || rt == object.ERROR_OBJ {
+				m.ret(result)
+				return
+			}
+		}
+		m.blockStatement(statements, i+1, env)
+	}
+	if m.push(&frame{kind: blockFrame, resume: next}) {
+		m.evalTail(statements[i], env)
+	}
+}
+
+// returnFromCall drops the blocks between a return and the function it
+// returns from, which would only hand the return on. It reports false when
+// something else is in between, like a try, or the return is outside of a
+// function.
+func (m *Machine) returnFromCall() bool {
+	for i := len(m.stack) - 1; i >= 0; i-- {
+		switch m.stack[i].kind {
+		case callFrame:
+			m.stack = m.stack[:i+1]
+			return true
+		case otherFrame:
+			return false
+		}
+	}
+	return false
+}
+
+func (m *Machine) infix(node *ast.InfixExpression, env *object.Environment) {
+	m.eval(node.Left, env, func(left object.Object) {
+		if isError(left) {
+			m.ret(left)
+			return
+		}
+		if node.Op == "??" {
+			if left != NULL {
+				m.ret(left)
+				return
+			}
+			m.evalTail(node.Right, env)
+			return
+		}
+		m.eval(node.Right, env, func(right object.Object) {
+			if isError(right) {
+				m.ret(right)
+				return
+			}
+			if node.Token.Type == token.OPERATOR {
+				fn, ok := env.Get(node.Op)
+				if !ok {
+					m.ret(newError("operator not defined: %s", node.Op))
+					return
+				}
+				m.apply(fn, []object.Object{left, right}, "")
+				return
+			}
+			m.operator(left, right, node.Op)
+		})
+	})
+}
+
+// operator is evaluateInfixExpression with operator methods called on the
+// machine
+func (m *Machine) operator(left object.Object, right object.Object, op string) {
+	if fn, ok := extensionOperators[op]; ok {
+		if result := fn(left, right); result != nil {
+			m.ret(result)
+			return
+		}
+	}
+
+	if instance, ok := left.(*object.Instance); ok {
+		if method, ok := instance.Struct.Methods[operatorMethods[op]]; ok {
+			if op == "!=" {
+				negate := func(result object.Object) {
+					if isError(result) {
+						m.ret(result)
+						return
+					}
+					m.ret(nativeBoolToBooleanObject(!isTruthy(result)))
+				}
+				if !m.push(&frame{kind: otherFrame, resume: negate}) {
+					return
+				}
+			}
+			m.apply(&object.BoundMethod{Receiver: instance, Method: method}, []object.Object{right}, "")
+			return
+		}
+	}
+
+	m.ret(evaluateBuiltinInfixExpression(left, right, op))
+}
+
+func (m *Machine) call(node *ast.CallExpression, env *object.Environment) {
+	if node.Function.TokenLexeme() == "quote" {
+		m.ret(evaluate(node, env))
+		return
+	}
+	m.evalLink(node.Function, env, func(function object.Object) {
+		if isError(function) {
+			m.ret(function)
+			return
+		}
+		if function == skipped || node.Optional && function == NULL {
+			m.skip(node)
+			return
+		}
+		m.evalAll(node.Arguments, env, func(args []object.Object) {
+			m.apply(function, args, callName(node))
+		})
+	})
+}
+
+// apply calls fn with args and hands what it returns to the continuation on
+// top of the stack. name is the call for the stack of an error, or "" for
+// calls an error's stack doesn't show, like those of operators.
+func (m *Machine) apply(fn object.Object, args []object.Object, name string) {
+	if method, ok := fn.(*object.BoundMethod); ok {
+		fn, args = method.Method, append([]object.Object{method.Receiver}, args...)
+	}
+
+	if n := len(m.stack); n > 0 && m.stack[n-1].kind == callFrame {
+		if name != "" {
+			m.stack[n-1].tail.push(name)
+		}
+	} else if !m.push(&frame{kind: callFrame, name: name}) {
+		return
+	}
+
+	switch function := fn.(type) {
+	case *object.Function:
+		if len(args) != len(function.Parameters) {
+			m.ret(newError("wrong number of arguments: want=%d, got=%d",
+				len(function.Parameters), len(args)))
+			return
+		}
+		m.evalTail(function.Body, extendedFunctionEnv(function, args))
+	case *object.Builtin:
+		if function == callcc {
+			m.callcc(args)
+			return
+		}
+		m.ret(function.Fn(args...))
+	case *continuation:
+		m.resume(function, args)
+	case *object.EnumVariant:
+		if len(args) != len(function.Fields) {
+			m.ret(newError("wrong number of arguments to %s.%s: want=%d, got=%d",
+				function.Enum.Name, function.Name, len(function.Fields), len(args)))
+			return
+		}
+		m.ret(&object.Variant{Variant: function, Values: args})
+	default:
+		m.ret(newError("not a function: %s", fn.Type()))
+	}
+}
+
+// returned takes the value of the call f was pushed for
+func (m *Machine) returned(f *frame, v object.Object) {
+	v = unwrapReturnValue(v)
+	if errObj, ok := v.(*object.Error); ok {
+		f.tail.unwind(errObj)
+		if f.name != "" {
+			errObj.Stack = append(errObj.Stack, f.name)
+		}
+	}
+	m.ret(v)
+}
+
+// try is evaluateTryExpression
+func (m *Machine) try(node *ast.TryExpression, env *object.Environment) {
+	finally := func(result object.Object) {
+		if node.Finally == nil {
+			m.ret(result)
+			return
+		}
+		m.eval(node.Finally, env, func(finally object.Object) {
+			if finally != nil {
+				ft := finally.Type()
+				if ft == object.RETURN_OBJ || ft == object.ERROR_OBJ {
+					m.ret(finally)
+					return
+				}
+			}
+			m.ret(result)
+		})
+	}
+
+	m.eval(node.Block, env, func(result object.Object) {
+		errObj, ok := result.(*object.Error)
+		if !ok || node.Catch == nil {
+			finally(result)
+			return
+		}
+		catchEnv := object.NewEnclosedEnvironment(env)
+		if node.CatchParam != nil {
+			catchEnv.Set(node.CatchParam.Value, &object.ErrorValue{Error: errObj})
+		}
+		m.eval(node.Catch, catchEnv, finally)
+	})
+}
+
+// structLiteral is evaluateStructLiteral
+func (m *Machine) structLiteral(node *ast.StructLiteral, env *object.Environment) {
+	m.eval(node.Name, env, func(val object.Object) {
+		if isError(val) {
+			m.ret(val)
+			return
+		}
+		structType, ok := val.(*object.Struct)
+		if !ok {
+			m.ret(newError("not a struct: %s", val.Type()))
+			return
+		}
+
+		// the values before the first wrong field are evaluated, as
+		// evaluateStructLiteral checks each field before its value
+		var fieldErr object.Object
+		valid := len(node.Fields)
+		given := map[string]bool{}
+		for i, f := range node.Fields {
+			if !structType.HasField(f.Value) {
+				fieldErr = newError("unknown field %s in struct %s", f.Value, structType.Name)
+			} else if given[f.Value] {
+				fieldErr = newError("field %s given twice in struct %s", f.Value, structType.Name)
+			}
+			if fieldErr != nil {
+				valid = i
+				break
+			}
+			given[f.Value] = true
+		}
+
+		m.evalAll(node.Values[:valid], env, func(values []object.Object) {
+			if fieldErr != nil {
+				m.ret(fieldErr)
+				return
+			}
+			fields := make(map[string]object.Object, len(structType.Fields))
+			for _, f := range structType.Fields {
+				fields[f] = NULL
+			}
+			for i, value := range values {
+				fields[node.Fields[i].Value] = value
+			}
+			m.ret(&object.Instance{Struct: structType, Fields: fields})
+		})
+	})
+}
+
+// assign is evaluateAssignExpression
+func (m *Machine) assign(node *ast.AssignExpression, env *object.Environment) {
+	target, ok := node.Target.(*ast.MemberExpression)
+	if !ok {
+		m.ret(newError("cannot assign to %s", node.Target.String()))
+		return
+	}
+
+	m.eval(target.Object, env, func(obj object.Object) {
+		if isError(obj) {
+			m.ret(obj)
+			return
+		}
+		instance, ok := obj.(*object.Instance)
+		if !ok {
+			m.ret(newError("member assignment not supported: %s.%s", obj.Type(), target.Member.Value))
+			return
+		}
+		if !instance.Struct.HasField(target.Member.Value) {
+			m.ret(newError("unknown field %s in struct %s", target.Member.Value, instance.Struct.Name))
+			return
+		}
+
+		m.eval(node.Value, env, func(value object.Object) {
+			if !isError(value) {
+				instance.Fields[target.Member.Value] = value
+			}
+			m.ret(value)
+		})
+	})
+}
+
+// slice is evaluateSliceExpression
+func (m *Machine) slice(node *ast.SliceExpression, env *object.Environment) {
+	m.evalLink(node.Left, env, func(left object.Object) {
+		if isError(left) {
+			m.ret(left)
+			return
+		}
+		if left == skipped || node.Optional && left == NULL {
+			m.skip(node)
+			return
+		}
+		bounds := []ast.Expression{}
+		for _, bound := range []ast.Expression{node.Start, node.End} {
+			if bound != nil {
+				bounds = append(bounds, bound)
+			}
+		}
+		m.evalAll(bounds, env, func(values []object.Object) {
+			var start, end object.Object
+			if node.Start != nil {
+				start, values = values[0], values[1:]
+			}
+			if node.End != nil {
+				end = values[0]
+			}
+			m.ret(sliceValue(left, start, end))
+		})
+	})
+}
@@ -0,0 +1,105 @@
+package evaluator
+
+import (
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"os"
+	"os/exec"
+	"runtime/debug"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// the suite runs again on the machine, see TestMachine
+	UseMachine = os.Getenv("MONKEY_MACHINE") != ""
+	os.Exit(m.Run())
+}
+
+func TestMachine(t *testing.T) {
+	if UseMachine {
+		t.Skip("already running on the machine")
+	}
+	cmd := exec.Command(os.Args[0], "-test.count=1")
+	cmd.Env = append(os.Environ(), "MONKEY_MACHINE=1")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("the tests fail on the machine: %v\n%s", err, output)
+	}
+}
+
+func newTestMachine(input string) *Machine {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	return NewMachine(program, object.NewEnvironment())
+}
+
+func TestMachineDeepRecursion(t *testing.T) {
+	// far less Go stack than the recursive evaluator needs for this
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+
+	m := newTestMachine("let sum = func(n) { if (n == 0) { 0 } else { n + sum(n - 1) } }; sum(100000)")
+	testIntegerObject(t, m.Run(), 5000050000)
+}
+
+func TestMachineStackLimit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let sum = func(n) { if (n == 0) { 0 } else { n + sum(n - 1) } }; sum(1000)", "stack overflow: more than 100 frames"},
+		{"let f = func(n) { f(n + 1) + 1 }; try { f(0) } catch (e) { e.message }", "stack overflow: more than 100 frames"},
+	}
+
+	for _, tt := range tests {
+		m := newTestMachine(tt.input)
+		m.Limit = 100
+		switch result := m.Run().(type) {
+		case *object.Error:
+			if result.Message != tt.expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, result.Message)
+			}
+		case *object.String:
+			if result.Value != tt.expected {
+				t.Errorf("wrong message. expected=%q, got=%q", tt.expected, result.Value)
+			}
+		default:
+			t.Errorf("no stack overflow for %q. got=%v", tt.input, result)
+		}
+	}
+
+	// tail calls run in the frame of their caller
+	m := newTestMachine("let count = func(n) { if (n == 0) { 0 } else { count(n - 1) } }; count(10000)")
+	m.Limit = 10
+	testIntegerObject(t, m.Run(), 0)
+}
+
+func TestMachineStep(t *testing.T) {
+	m := newTestMachine("let x = 1 + 2; x * 3")
+
+	steps, depth := 0, 0
+	for m.Step() {
+		steps++
+		depth = max(depth, m.Depth())
+	}
+	if steps < 8 || depth < 2 {
+		t.Errorf("expected a step per node. got steps=%d, depth=%d", steps, depth)
+	}
+	if m.Depth() != 0 || m.Step() {
+		t.Errorf("machine not done after its last step")
+	}
+	testIntegerObject(t, m.Result(), 9)
+}
+
+func TestMachineCallsFromBuiltins(t *testing.T) {
+	UseMachine = true
+	defer func() { UseMachine = os.Getenv("MONKEY_MACHINE") != "" }()
+
+	evaluated := testEval(`
+	struct Bag { items; func __len__(self) { len(self.items) } }
+	len(Bag{items: [1, 2, 3]})`)
+	testIntegerObject(t, evaluated, 3)
+
+	evaluated = testEval("let f = func() { throw \"boom\" }; let g = func() { f() }; try { g() } catch (e) { e.stack }")
+	if evaluated == nil || evaluated.Inspect() != "[f, g]" {
+		t.Errorf("wrong stack. got=%v", evaluated)
+	}
+}
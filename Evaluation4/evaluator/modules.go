@@ -0,0 +1,232 @@
+package evaluator
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/optimizer"
+	"interpreter/parser"
+	"interpreter/resolver"
+	"interpreter/types"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileExtension is added to import paths which don't name one
+const FileExtension = ".monkey"
+
+// PackageResolver maps imports of a package's dependencies to files. found is
+// false when path doesn't start with a dependency of the package holding from.
+type PackageResolver interface {
+	Resolve(from string, path string) (resolved string, found bool, err error)
+}
+
+// ModuleLoader evaluates every file once into its own environment and hands
+// the cached module to later imports
+type ModuleLoader struct {
+	// SearchPath is tried, in order, after the directory of the importing file
+	SearchPath []string
+	// Packages, when set, is asked first
+	Packages PackageResolver
+	// Strict infers the types of every module as if it had the strict pragma
+	Strict bool
+	// Optimize, when set, says which optimizer passes run over every module
+	Optimize *optimizer.Config
+	// Warnings, when set, gets the type mismatches found in unannotated code
+	// of modules which aren't strict. Those modules still run.
+	Warnings io.Writer
+
+	modules map[string]*object.Module
+	// paths of the modules being evaluated, the last one is the innermost import
+	loading []string
+}
+
+func NewModuleLoader(searchPath ...string) *ModuleLoader {
+	return &ModuleLoader{
+		SearchPath: searchPath,
+		modules:    make(map[string]*object.Module),
+	}
+}
+
+// NewMainModule is the module code outside of any file, like the console,
+// runs in. Its imports are resolved relative to dir.
+func (ml *ModuleLoader) NewMainModule(dir string) *object.Module {
+	module := &object.Module{
+		Name:    "main",
+		Path:    filepath.Join(dir, "main"+FileExtension),
+		Exports: make(map[string]bool),
+		Loader:  ml,
+	}
+	module.Env = object.NewModuleEnvironment(module)
+	return module
+}
+
+// EvalFile evaluates path as the entry module, the result is the value of its last statement
+func (ml *ModuleLoader) EvalFile(path string) (*object.Module, object.Object) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, loadError(path, false, err)
+	}
+	return ml.load(abs, false)
+}
+
+func (ml *ModuleLoader) Import(from *object.Module, path string) object.Object {
+	resolved, errObj := ml.resolve(from, path)
+	if errObj != nil {
+		return errObj
+	}
+
+	module, result := ml.load(resolved, true)
+	if isError(result) {
+		return result
+	}
+	return module
+}
+
+func (ml *ModuleLoader) load(path string, imported bool) (*object.Module, object.Object) {
+	if module, ok := ml.modules[path]; ok {
+		return module, module
+	}
+
+	for i, loading := range ml.loading {
+		if loading == path {
+			cycle := []string{}
+			for _, p := range append(ml.loading[i:], path) {
+				cycle = append(cycle, filepath.Base(p))
+			}
+			return nil, newError("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, loadError(path, imported, err)
+	}
+
+	l := lexer.New(string(source))
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, loadError(path, imported, strings.Join(p.Errors(), "; "))
+	}
+
+	macroEnv := object.NewEnvironment()
+	DefineMacros(program, macroEnv)
+	expanded, err := ExpandMacros(program, macroEnv)
+	if err != nil {
+		return nil, loadError(path, imported, err)
+	}
+	table := resolver.Resolve(expanded, IsBuiltin, nil)
+	if len(table.Errors) != 0 {
+		return nil, loadError(path, imported, strings.Join(table.Errors, "; "))
+	}
+	var info *types.Info
+	if ml.Strict || types.HasPragma(l.Comments()) {
+		info = types.NewEnv().Infer(expanded, table)
+	} else {
+		info = types.Check(expanded, table)
+	}
+	if ml.Warnings != nil {
+		for _, msg := range info.Warnings {
+			fmt.Fprintf(ml.Warnings, "%s: warning: %s\n", path, msg)
+		}
+	}
+	if len(info.Errors) != 0 {
+		return nil, loadError(path, imported, strings.Join(info.Errors, "; "))
+	}
+	if ml.Optimize != nil {
+		expanded = Optimize(expanded, table, *ml.Optimize)
+	}
+
+	module := &object.Module{
+		Name:    strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		Path:    path,
+		Exports: make(map[string]bool),
+		Loader:  ml,
+	}
+	module.Env = object.NewModuleEnvironment(module)
+
+	ml.loading = append(ml.loading, path)
+	result := Eval(expanded, module.Env)
+	ml.loading = ml.loading[:len(ml.loading)-1]
+
+	if isError(result) {
+		return nil, result
+	}
+
+	ml.modules[path] = module
+	return module, result
+}
+
+// Optimize runs the optimizer over program, leaving the operators registered
+// by extensions as they are.
+func Optimize(program ast.Node, table *resolver.Table, config optimizer.Config) ast.Node {
+	config.Extended = func(op string) bool {
+		_, ok := extensionOperators[op]
+		return ok
+	}
+	return optimizer.Optimize(program, table, config)
+}
+
+// loadError is why the file at path can't be evaluated, reported as an error
+// of the import when it was imported
+func loadError(path string, imported bool, msg any) *object.Error {
+	if imported {
+		return newError("cannot import %q: %s", path, msg)
+	}
+	return newError("%s: %s", path, msg)
+}
+
+// Paths starting with ./ or ../ are only looked up next to the importing
+// file. Others go to the package resolver and are then tried next to the
+// importing file and in each directory of the search path.
+func (ml *ModuleLoader) resolve(from *object.Module, path string) (string, *object.Error) {
+	if ml.Packages != nil && from != nil && !strings.HasPrefix(path, "./") && !strings.HasPrefix(path, "../") {
+		resolved, found, err := ml.Packages.Resolve(from.Path, path)
+		if err != nil {
+			return "", newError("cannot import %q: %s", path, err)
+		}
+		if found {
+			if filepath.Ext(resolved) == "" {
+				resolved += FileExtension
+			}
+			if info, err := os.Stat(resolved); err != nil || info.IsDir() {
+				return "", newError("cannot find module %q in %s", path, resolved)
+			}
+			return resolved, nil
+		}
+	}
+
+	if filepath.Ext(path) == "" {
+		path += FileExtension
+	}
+
+	dir := "."
+	if from != nil {
+		dir = filepath.Dir(from.Path)
+	}
+
+	candidates := []string{filepath.Join(dir, path)}
+	if filepath.IsAbs(path) {
+		candidates = []string{path}
+	} else if !strings.HasPrefix(path, "./") && !strings.HasPrefix(path, "../") {
+		for _, searchDir := range ml.SearchPath {
+			candidates = append(candidates, filepath.Join(searchDir, path))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			abs, err := filepath.Abs(candidate)
+			if err != nil {
+				return "", newError("cannot import %q: %s", path, err)
+			}
+			return abs, nil
+		}
+	}
+
+	return "", newError("cannot find module %q", path)
+}
@@ -0,0 +1,123 @@
+package evaluator
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/object"
+)
+
+// A call in tail position, whose value is what the function it is in returns,
+// is not made where it is evaluated. The body of the function gives back a
+// tailCall instead and applyFunction makes the call once the body is done, so
+// a tail recursive function runs in constant Go stack. Tail positions are the
+// last expression of a function body, the value of a return outside of a try
+// block and the branches of an if in tail position.
+
+const tailCallObj = "TAIL_CALL"
+
+type tailCall struct {
+	function object.Object
+	args     []object.Object
+	// name is the call as it shows up in an error's stack
+	name string
+}
+
+func (tc *tailCall) Type() object.ObjectType { return tailCallObj }
+func (tc *tailCall) Inspect() string         { return "tail call to " + tc.name }
+
+// tailFrames are the names of the tail calls applyFunction made. Calls through
+// the same name in a row are kept once with their count, and past
+// maxTailFrames names the outer half is only counted, so neither a loop nor a
+// mutual recursion grows them without bound.
+type tailFrames []tailFrame
+
+// maxTailFrames is how many names tailFrames keeps
+const maxTailFrames = 64
+
+type tailFrame struct {
+	// name is "" for the calls no longer kept
+	name  string
+	count int
+}
+
+func (tf *tailFrames) push(name string) {
+	frames := *tf
+	if n := len(frames); n > 0 && frames[n-1].name == name {
+		frames[n-1].count++
+		return
+	}
+	if len(frames) == maxTailFrames {
+		dropped := tailFrame{}
+		for _, f := range frames[:maxTailFrames/2] {
+			dropped.count += f.count
+		}
+		frames = append(tailFrames{dropped}, frames[maxTailFrames/2:]...)
+	}
+	*tf = append(frames, tailFrame{name: name, count: 1})
+}
+
+// unwind adds the tail calls to the stack of err, innermost first, with one
+// entry for each name in a row like loop (x300000)
+func (tf tailFrames) unwind(err *object.Error) {
+	for i := len(tf) - 1; i >= 0; i-- {
+		switch {
+		case tf[i].name == "":
+			err.Stack = append(err.Stack, fmt.Sprintf("... (%d more calls)", tf[i].count))
+		case tf[i].count > 1:
+			err.Stack = append(err.Stack, fmt.Sprintf("%s (x%d)", tf[i].name, tf[i].count))
+		default:
+			err.Stack = append(err.Stack, tf[i].name)
+		}
+	}
+}
+
+// evaluateTailBlock is evaluateStatementBlock for a block of a function body,
+// tail is whether its value is what the function returns
+func evaluateTailBlock(block *ast.StatementBlock, env *object.Environment, tail bool) object.Object {
+	var result object.Object
+	for i, statement := range block.Statements {
+		result = evaluateTailStatement(statement, env, tail && i == len(block.Statements)-1)
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+	return result
+}
+
+func evaluateTailStatement(stmt ast.Statement, env *object.Environment, tail bool) object.Object {
+	switch stmt := stmt.(type) {
+	case *ast.ReturnStatement:
+		val := evaluateTailExpression(stmt.Value, env, true)
+		if isError(val) {
+			return val
+		}
+		return &object.Return{Value: val}
+	case *ast.ExpressionStatement:
+		return evaluateTailExpression(stmt.Expression, env, tail)
+	}
+	return Eval(stmt, env)
+}
+
+// evaluateTailExpression looks into the branches of an if for returns even
+// when the if itself isn't in tail position
+func evaluateTailExpression(expr ast.Expression, env *object.Environment, tail bool) object.Object {
+	switch expr := expr.(type) {
+	case *ast.IfExpression:
+		condition := Eval(expr.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if isTruthy(condition) {
+			return evaluateTailBlock(expr.Consequence, env, tail)
+		} else if expr.Alternative != nil {
+			return evaluateTailBlock(expr.Alternative, env, tail)
+		}
+		return NULL
+	case *ast.CallExpression:
+		return unskip(evaluateCallExpression(expr, env, tail))
+	}
+	return Eval(expr, env)
+}
@@ -0,0 +1,246 @@
+package format
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// The formatter turns the syntax tree into a document of text and places where
+// a line may break, then the printer decides group by group whether each group
+// fits on the rest of its line or has all of its breaks taken.
+
+type doc interface{}
+
+type text string
+
+// line is a space, or nothing when soft, if its group stays on one line and a
+// newline otherwise
+type line struct{ soft bool }
+
+// hardline always breaks, and so does every group around it
+type hardline struct{}
+
+// breakParent prints nothing but breaks every group around it
+type breakParent struct{}
+
+// ifBreak is only printed when its group is broken
+type ifBreak string
+
+type concat []doc
+
+// nest indents the lines broken inside it one level more
+type nest struct{ d doc }
+
+type group struct {
+	d      doc
+	broken bool
+}
+
+// expand prints g broken even though it might fit
+type expand struct{ g *group }
+
+// hug lays out a call whose last argument is a function: on one line if the
+// whole call fits, with only the function body broken if the line up to the
+// body fits, and with every argument on its own line otherwise
+type hug struct {
+	normal *group
+	hugged doc
+}
+
+var (
+	softline = line{soft: true}
+	spaced   = line{}
+)
+
+const indent = "    "
+
+type mode int
+
+const (
+	modeBreak mode = iota
+	modeFlat
+)
+
+type command struct {
+	indent int
+	mode   mode
+	d      doc
+}
+
+func render(d doc, width int) string {
+	propagateBreaks(d)
+
+	var out strings.Builder
+	col := 0
+	newline := func(level int) {
+		out.WriteString("\n")
+		out.WriteString(strings.Repeat(indent, level))
+		col = level * len(indent)
+	}
+
+	cmds := []command{{0, modeBreak, d}}
+	for len(cmds) > 0 {
+		c := cmds[len(cmds)-1]
+		cmds = cmds[:len(cmds)-1]
+
+		switch d := c.d.(type) {
+		case text:
+			out.WriteString(string(d))
+			col += utf8.RuneCountInString(string(d))
+		case concat:
+			for i := len(d) - 1; i >= 0; i-- {
+				cmds = append(cmds, command{c.indent, c.mode, d[i]})
+			}
+		case nest:
+			cmds = append(cmds, command{c.indent + 1, c.mode, d.d})
+		case *group:
+			next := command{c.indent, modeFlat, d.d}
+			if d.broken || c.mode == modeBreak && !fits(next, cmds, width-col) {
+				next.mode = modeBreak
+			}
+			cmds = append(cmds, next)
+		case expand:
+			cmds = append(cmds, command{c.indent, modeBreak, d.g.d})
+		case hug:
+			next := command{c.indent, modeFlat, d.normal.d}
+			if d.normal.broken || !fits(next, cmds, width-col) {
+				next = command{c.indent, modeFlat, d.hugged}
+				if !fits(next, cmds, width-col) {
+					next = command{c.indent, modeBreak, d.normal.d}
+				}
+			}
+			cmds = append(cmds, next)
+		case line:
+			if c.mode == modeBreak {
+				newline(c.indent)
+			} else if !d.soft {
+				out.WriteString(" ")
+				col++
+			}
+		case hardline:
+			newline(c.indent)
+		case ifBreak:
+			if c.mode == modeBreak {
+				out.WriteString(string(d))
+				col += utf8.RuneCountInString(string(d))
+			}
+		case breakParent:
+		}
+	}
+
+	lines := strings.Split(out.String(), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// fits measures next and then what follows it up to the first line break,
+// which has to fit in width
+func fits(next command, rest []command, width int) bool {
+	cmds := []command{next}
+	for width >= 0 {
+		if len(cmds) == 0 {
+			if len(rest) == 0 {
+				return true
+			}
+			cmds = append(cmds, rest[len(rest)-1])
+			rest = rest[:len(rest)-1]
+			continue
+		}
+		c := cmds[len(cmds)-1]
+		cmds = cmds[:len(cmds)-1]
+
+		switch d := c.d.(type) {
+		case text:
+			width -= utf8.RuneCountInString(string(d))
+		case concat:
+			for i := len(d) - 1; i >= 0; i-- {
+				cmds = append(cmds, command{c.indent, c.mode, d[i]})
+			}
+		case nest:
+			cmds = append(cmds, command{c.indent + 1, c.mode, d.d})
+		case *group:
+			m := c.mode
+			if d.broken {
+				m = modeBreak
+			}
+			cmds = append(cmds, command{c.indent, m, d.d})
+		case expand:
+			cmds = append(cmds, command{c.indent, modeBreak, d.g.d})
+		case hug:
+			cmds = append(cmds, command{c.indent, c.mode, d.normal})
+		case line:
+			if c.mode == modeBreak {
+				return true
+			}
+			if !d.soft {
+				width--
+			}
+		case hardline:
+			return true
+		case ifBreak:
+			if c.mode == modeBreak {
+				width -= utf8.RuneCountInString(string(d))
+			}
+		}
+	}
+	return false
+}
+
+// propagateBreaks marks every group holding a forced break as broken and
+// reports whether d holds one
+func propagateBreaks(d doc) bool {
+	switch d := d.(type) {
+	case hardline, breakParent:
+		return true
+	case concat:
+		broken := false
+		for _, part := range d {
+			if propagateBreaks(part) {
+				broken = true
+			}
+		}
+		return broken
+	case nest:
+		return propagateBreaks(d.d)
+	case *group:
+		if propagateBreaks(d.d) {
+			d.broken = true
+		}
+		return d.broken
+	case expand:
+		propagateBreaks(d.g)
+		return true
+	case hug:
+		// the hugged layout is only picked when it fits, it forces nothing
+		propagateBreaks(d.hugged)
+		return propagateBreaks(d.normal)
+	}
+	return false
+}
+
+// firstChar is the first character d prints
+func firstChar(d doc) byte {
+	switch d := d.(type) {
+	case text:
+		if len(d) > 0 {
+			return d[0]
+		}
+	case concat:
+		for _, part := range d {
+			if c := firstChar(part); c != 0 {
+				return c
+			}
+		}
+	case nest:
+		return firstChar(d.d)
+	case *group:
+		return firstChar(d.d)
+	case expand:
+		return firstChar(d.g)
+	case hug:
+		return firstChar(d.normal)
+	}
+	return 0
+}
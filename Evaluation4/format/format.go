@@ -0,0 +1,634 @@
+// Package format prints Monkey programs in their canonical layout.
+package format
+
+import (
+	"errors"
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"interpreter/token"
+	"strconv"
+	"strings"
+)
+
+// Config controls the layout.
+type Config struct {
+	// Width is the line length the formatter breaks lines to stay within.
+	Width int
+}
+
+const DefaultWidth = 80
+
+// Source formats a whole file. Comments are kept between the statements they
+// were found between; a comment in the middle of an expression moves to after
+// its statement.
+func Source(src []byte, config Config) ([]byte, error) {
+	l := lexer.New(string(src))
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	f := newFormatter(string(src), l.Comments())
+	out := render(f.program(program), config.width())
+	if out != "" {
+		out += "\n"
+	}
+	return []byte(out), nil
+}
+
+// Node formats a single node on its own.
+func Node(node ast.Node, config Config) string {
+	f := newFormatter("", nil)
+
+	var d doc
+	switch node := node.(type) {
+	case *ast.Program:
+		d = f.program(node)
+	case ast.Statement:
+		d = concat{f.statement(node), text(f.terminator(node, nil))}
+	case ast.Expression:
+		d = f.expression(node)
+	default:
+		d = text(node.String())
+	}
+	return render(d, config.width())
+}
+
+func (config Config) width() int {
+	if config.Width <= 0 {
+		return DefaultWidth
+	}
+	return config.Width
+}
+
+type formatter struct {
+	// source lines, to see where the author left blank lines
+	lines []string
+
+	// comments not printed yet
+	comments []token.Token
+
+	// operators declared with infixl/infixr so far
+	operators map[string]declaredOperator
+}
+
+type declaredOperator struct {
+	precedence int
+	right      bool
+}
+
+func newFormatter(src string, comments []token.Token) *formatter {
+	return &formatter{
+		lines:     strings.Split(src, "\n"),
+		comments:  comments,
+		operators: map[string]declaredOperator{},
+	}
+}
+
+func (f *formatter) program(program *ast.Program) doc {
+	end := token.Token{Line: len(f.lines) + 1}
+	return f.statements(program.Statements, end)
+}
+
+// one statement of a list with the comments around it
+type item struct {
+	leading  []token.Token
+	stmt     ast.Statement
+	doc      doc
+	line     int
+	blank    bool
+	trailing string
+}
+
+// statements lays out a statement list and the comments before end, one per
+// line
+func (f *formatter) statements(stmts []ast.Statement, end token.Token) doc {
+	items := []*item{}
+
+	// comments on the line a statement started become trailing comments
+	takeComments := func(line, column int) []token.Token {
+		leading := []token.Token{}
+		for len(f.comments) > 0 && before(f.comments[0], line, column) {
+			c := f.comments[0]
+			f.comments = f.comments[1:]
+			if len(leading) == 0 && len(items) > 0 {
+				if last := items[len(items)-1]; last.line == c.Line && last.trailing == "" {
+					last.trailing = c.Lexeme
+					continue
+				}
+			}
+			leading = append(leading, c)
+		}
+		return leading
+	}
+	// a blank line before an item, or its first comment, is kept
+	blankBefore := func(it *item) bool {
+		line := it.line
+		if len(it.leading) > 0 {
+			line = it.leading[0].Line
+		}
+		return len(items) > 0 && f.blankBefore(line)
+	}
+	// comments a blank line away from what follows them stand on their own
+	splitComments := func(comments []token.Token, nextLine int) []token.Token {
+		start := 0
+		for i, c := range comments {
+			following := nextLine
+			if i+1 < len(comments) {
+				following = comments[i+1].Line
+			}
+			if following-1 > c.Line && f.blankBefore(following) {
+				it := &item{leading: comments[start : i+1]}
+				it.blank = blankBefore(it)
+				items = append(items, it)
+				start = i + 1
+			}
+		}
+		return comments[start:]
+	}
+
+	for _, stmt := range stmts {
+		tok := statementToken(stmt)
+		it := &item{stmt: stmt, line: tok.Line}
+		it.leading = splitComments(takeComments(tok.Line, tok.Column), tok.Line)
+		it.blank = blankBefore(it)
+		it.doc = f.statement(stmt)
+		items = append(items, it)
+	}
+
+	if leading := splitComments(takeComments(end.Line, end.Column), end.Line); len(leading) > 0 {
+		it := &item{leading: leading}
+		it.blank = blankBefore(it)
+		items = append(items, it)
+	}
+
+	parts := concat{}
+	for i, it := range items {
+		if i > 0 {
+			parts = append(parts, hardline{})
+			if it.blank {
+				parts = append(parts, hardline{})
+			}
+		}
+		for j, c := range it.leading {
+			if j > 0 {
+				parts = append(parts, hardline{})
+			}
+			parts = append(parts, text(c.Lexeme), breakParent{})
+		}
+		if it.stmt != nil {
+			if len(it.leading) > 0 {
+				parts = append(parts, hardline{})
+			}
+			// comments in between don't change how the next statement parses
+			var next doc
+			for _, later := range items[i+1:] {
+				if later.stmt != nil {
+					next = later.doc
+					break
+				}
+			}
+			parts = append(parts, it.doc, text(f.terminator(it.stmt, next)))
+		}
+		if it.trailing != "" {
+			parts = append(parts, text(" "+it.trailing), breakParent{})
+		}
+	}
+	return parts
+}
+
+// blankBefore reports whether the source line before line is empty
+func (f *formatter) blankBefore(line int) bool {
+	return line >= 2 && line-2 < len(f.lines) && strings.TrimSpace(f.lines[line-2]) == ""
+}
+
+// before reports whether comment c comes before the given position; unset
+// positions come before nothing
+func before(c token.Token, line, column int) bool {
+	return c.Line < line || c.Line == line && c.Column < column
+}
+
+func statementToken(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.ThrowStatement:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	case *ast.StructStatement:
+		return stmt.Token
+	case *ast.EnumStatement:
+		return stmt.Token
+	case *ast.ImportStatement:
+		return stmt.Token
+	case *ast.ExportStatement:
+		return stmt.Token
+	case *ast.OperatorStatement:
+		return stmt.Token
+	}
+	return token.Token{}
+}
+
+// terminator is the semicolon after a statement, if it needs one. Expression
+// statements skip it when they are last, with next nil, or when they end in a
+// block and next can't be read as continuing them.
+func (f *formatter) terminator(stmt ast.Statement, next doc) string {
+	switch stmt := stmt.(type) {
+	case *ast.StructStatement, *ast.EnumStatement:
+		return ""
+	case *ast.ExportStatement:
+		return f.terminator(stmt.Statement, next)
+	case *ast.ExpressionStatement:
+		if next == nil {
+			return ""
+		}
+		switch stmt.Expression.(type) {
+		case *ast.IfExpression, *ast.TryExpression, *ast.MatchExpression:
+			if !strings.ContainsRune("([-", rune(firstChar(next))) {
+				return ""
+			}
+		}
+	}
+	return ";"
+}
+
+func (f *formatter) statement(stmt ast.Statement) doc {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		name := stmt.Name.Value
+		if stmt.Type != nil {
+			name += ": " + stmt.Type.String()
+		}
+		return concat{text("let " + name + " = "), f.expression(stmt.Value)}
+	case *ast.ReturnStatement:
+		return concat{text("return "), f.expression(stmt.Value)}
+	case *ast.ThrowStatement:
+		return concat{text("throw "), f.expression(stmt.Value)}
+	case *ast.ExpressionStatement:
+		return f.expression(stmt.Expression)
+	case *ast.StructStatement:
+		return f.structStatement(stmt)
+	case *ast.EnumStatement:
+		return f.enumStatement(stmt)
+	case *ast.ImportStatement:
+		d := concat{text("import " + quote(stmt.Path.Value))}
+		if stmt.Alias != nil {
+			d = append(d, text(" as "+stmt.Alias.Value))
+		}
+		return d
+	case *ast.ExportStatement:
+		return concat{text("export "), f.statement(stmt.Statement)}
+	case *ast.OperatorStatement:
+		f.operators[stmt.Operator] = declaredOperator{
+			precedence: parser.DeclaredPrecedence(stmt.Precedence),
+			right:      stmt.RightAssociative(),
+		}
+		header := stmt.TokenLexeme() + " " + strconv.FormatInt(stmt.Precedence, 10) + " " + stmt.Operator + " = "
+		return concat{text(header), f.expression(stmt.Function)}
+	case *ast.StatementBlock:
+		return f.block(stmt)
+	}
+	return text(stmt.String())
+}
+
+// struct P { x, y } fits on a line, methods go one per line after the fields
+func (f *formatter) structStatement(stmt *ast.StructStatement) doc {
+	header := text(stmt.TokenLexeme() + " " + stmt.Name.Value + " {")
+
+	fields := []doc{}
+	for _, field := range stmt.Fields {
+		fields = append(fields, text(field.Value))
+	}
+	if len(stmt.Methods) == 0 {
+		if len(fields) == 0 {
+			return concat{header, text("}")}
+		}
+		return &group{d: concat{header, nest{concat{spaced, join(fields, concat{text(","), spaced})}}, spaced, text("}")}}
+	}
+
+	members := []doc{}
+	if len(fields) > 0 {
+		members = append(members, concat{join(fields, text(", ")), text(";")})
+	}
+	for _, method := range stmt.Methods {
+		members = append(members, f.function(method))
+	}
+	return concat{header, nest{concat{hardline{}, join(members, concat{hardline{}, hardline{}})}}, hardline{}, text("}")}
+}
+
+func (f *formatter) enumStatement(stmt *ast.EnumStatement) doc {
+	variants := []doc{}
+	for _, variant := range stmt.Variants {
+		if variant.Fields == nil {
+			variants = append(variants, text(variant.Name.Value))
+			continue
+		}
+		variants = append(variants, concat{text(variant.Name.Value), f.identifiers(variant.Fields)})
+	}
+	header := text("enum " + stmt.Name.Value + " {")
+	if len(variants) == 0 {
+		return concat{header, text("}")}
+	}
+	return &group{d: concat{header, nest{concat{spaced, join(variants, concat{text(","), spaced}), ifBreak(",")}}, spaced, text("}")}}
+}
+
+// block lays out { stmts }, which stays on one line only when it holds a
+// single statement that fits
+func (f *formatter) block(block *ast.StatementBlock) doc {
+	body := f.blockBody(block)
+	if _, ok := body.(text); ok {
+		return body
+	}
+	return &group{d: body}
+}
+
+// blockBody is a block that breaks along with the group around it, so that
+// the blocks of an if or try all break together
+func (f *formatter) blockBody(block *ast.StatementBlock) doc {
+	body := f.statements(block.Statements, block.Rbrace)
+	if len(body.(concat)) == 0 {
+		return text("{}")
+	}
+	return concat{text("{"), nest{concat{spaced, body}}, spaced, text("}")}
+}
+
+// precedences of the expressions that aren't infix operators
+const (
+	postfix = parser.CALL
+	primary = parser.INDEX + 1
+)
+
+// precedence reports how tightly expr binds and whether it groups to the right
+func (f *formatter) precedence(expr ast.Expression) (int, bool) {
+	switch expr := expr.(type) {
+	case *ast.InfixExpression:
+		if expr.Token.Type == token.OPERATOR {
+			op := f.operators[expr.Op]
+			return op.precedence, op.right
+		}
+		return parser.Precedence(expr.Token.Type), false
+	case *ast.AssignExpression:
+		return parser.ASSIGN, true
+	case *ast.RangeExpression:
+		return parser.RANGE, false
+	case *ast.PrefixExpression:
+		return parser.PREFIX, false
+	case *ast.CallExpression, *ast.IndexExpression, *ast.SliceExpression,
+		*ast.MemberExpression, *ast.StructLiteral:
+		return postfix, false
+	}
+	return primary, false
+}
+
+// operand wraps expr in parentheses when it binds looser than min, or as
+// loosely on the side its operator doesn't group to
+func (f *formatter) operand(expr ast.Expression, min int, tight bool) doc {
+	precedence, _ := f.precedence(expr)
+	if precedence < min || tight && precedence == min {
+		return concat{text("("), f.expression(expr), text(")")}
+	}
+	return f.expression(expr)
+}
+
+func (f *formatter) binary(left ast.Expression, op string, right ast.Expression, precedence int, rightAssoc bool) doc {
+	return &group{d: concat{
+		f.operand(left, precedence, rightAssoc),
+		text(" " + op),
+		nest{concat{spaced, f.operand(right, precedence, !rightAssoc)}},
+	}}
+}
+
+func (f *formatter) expression(expr ast.Expression) doc {
+	switch expr := expr.(type) {
+	case nil:
+		return text("")
+	case *ast.Identifier:
+		return text(expr.Value)
+	case *ast.IntegerLiteral:
+		if expr.Token.Type == token.DIGIT {
+			return text(expr.Token.Lexeme)
+		}
+		return text(strconv.FormatInt(expr.Value, 10))
+	case *ast.StringLiteral:
+		return text(quote(expr.Value))
+	case *ast.BooleanExpression:
+		return text(strconv.FormatBool(expr.Value))
+	case *ast.PrefixExpression:
+		return concat{text(expr.Op), f.operand(expr.Value, parser.PREFIX, false)}
+	case *ast.InfixExpression:
+		precedence, right := f.precedence(expr)
+		return f.binary(expr.Left, expr.Op, expr.Right, precedence, right)
+	case *ast.AssignExpression:
+		return f.binary(expr.Target, "=", expr.Value, parser.ASSIGN, true)
+	case *ast.RangeExpression:
+		return concat{
+			f.operand(expr.Start, parser.RANGE, false),
+			text(expr.Token.Lexeme),
+			f.operand(expr.End, parser.RANGE, true),
+		}
+	case *ast.ArrayLiteral:
+		return f.list("[", f.expressions(expr.Elements), "]", false)
+	case *ast.CallExpression:
+		return f.call(expr)
+	case *ast.IndexExpression:
+		open := "["
+		if expr.Optional {
+			open = "?.["
+		}
+		return concat{f.operand(expr.Left, postfix, false), text(open), f.expression(expr.Index), text("]")}
+	case *ast.SliceExpression:
+		open := "["
+		if expr.Optional {
+			open = "?.["
+		}
+		d := concat{f.operand(expr.Left, postfix, false), text(open)}
+		if expr.Start != nil {
+			d = append(d, f.expression(expr.Start))
+		}
+		d = append(d, text(":"))
+		if expr.End != nil {
+			d = append(d, f.expression(expr.End))
+		}
+		return append(d, text("]"))
+	case *ast.MemberExpression:
+		dot := "."
+		if expr.Optional {
+			dot = "?."
+		}
+		return concat{f.operand(expr.Object, postfix, false), text(dot + expr.Member.Value)}
+	case *ast.StructLiteral:
+		fields := []doc{}
+		for i, field := range expr.Fields {
+			fields = append(fields, concat{text(field.Value + ": "), f.expression(expr.Values[i])})
+		}
+		return concat{f.operand(expr.Name, postfix, false), f.list("{", fields, "}", true)}
+	case *ast.IfExpression:
+		d := concat{text("if ("), f.expression(expr.Condition), text(") "), f.blockBody(expr.Consequence)}
+		if expr.Alternative != nil {
+			d = append(d, text(" else "), f.blockBody(expr.Alternative))
+		}
+		return &group{d: d}
+	case *ast.FunctionLiteral:
+		return f.function(expr)
+	case *ast.MacroLiteral:
+		return concat{text("macro"), f.identifiers(expr.Parameters), text(" "), f.block(expr.Body)}
+	case *ast.TryExpression:
+		d := concat{text("try "), f.blockBody(expr.Block)}
+		if expr.Catch != nil {
+			d = append(d, text(" catch "))
+			if expr.CatchParam != nil {
+				d = append(d, text("("+expr.CatchParam.Value+") "))
+			}
+			d = append(d, f.blockBody(expr.Catch))
+		}
+		if expr.Finally != nil {
+			d = append(d, text(" finally "), f.blockBody(expr.Finally))
+		}
+		return &group{d: d}
+	case *ast.MatchExpression:
+		return f.match(expr)
+	}
+	return text(expr.String())
+}
+
+func (f *formatter) expressions(exprs []ast.Expression) []doc {
+	docs := []doc{}
+	for _, expr := range exprs {
+		docs = append(docs, f.expression(expr))
+	}
+	return docs
+}
+
+func (f *formatter) identifiers(idents []*ast.Identifier) doc {
+	docs := []doc{}
+	for _, ident := range idents {
+		docs = append(docs, text(ident.Value))
+	}
+	return f.list("(", docs, ")", false)
+}
+
+// list lays out items on one line or one per line, with a trailing comma when
+// broken if the syntax allows one
+func (f *formatter) list(open string, items []doc, close string, trailingComma bool) doc {
+	if len(items) == 0 {
+		return text(open + close)
+	}
+	body := concat{softline, join(items, concat{text(","), spaced})}
+	if trailingComma {
+		body = append(body, ifBreak(","))
+	}
+	return &group{d: concat{text(open), nest{body}, softline, text(close)}}
+}
+
+// call hugs a trailing function argument, keeping the other arguments on the
+// first line as in `each(xs, func(x) {`
+func (f *formatter) call(call *ast.CallExpression) doc {
+	open := "("
+	if call.Optional {
+		open = "?.("
+	}
+	callee := f.operand(call.Function, postfix, false)
+
+	args := f.expressions(call.Arguments)
+	normal := f.list(open, args, ")", false)
+
+	n := len(call.Arguments)
+	if n == 0 {
+		return concat{callee, normal}
+	}
+	fn, ok := call.Arguments[n-1].(*ast.FunctionLiteral)
+	if !ok {
+		return concat{callee, normal}
+	}
+	// an empty body is plain text and there is nothing to break
+	last := args[n-1].(concat)
+	body, ok := last[len(last)-1].(*group)
+	if !ok {
+		return concat{callee, normal}
+	}
+
+	hugged := concat{text(open)}
+	for _, arg := range args[:n-1] {
+		hugged = append(hugged, arg, text(", "))
+	}
+	hugged = append(hugged, f.functionHeader(fn), text(" "), expand{body}, text(")"))
+	return concat{callee, hug{normal: normal.(*group), hugged: hugged}}
+}
+
+func (f *formatter) functionHeader(fn *ast.FunctionLiteral) doc {
+	name := "func"
+	if fn.Name != "" {
+		name += " " + fn.Name
+	}
+	params := []doc{}
+	for i, param := range fn.Parameters {
+		if i < len(fn.ParameterTypes) && fn.ParameterTypes[i] != nil {
+			params = append(params, text(param.Value+": "+fn.ParameterTypes[i].String()))
+		} else {
+			params = append(params, text(param.Value))
+		}
+	}
+	header := concat{text(name), f.list("(", params, ")", false)}
+	if fn.Result != nil {
+		header = append(header, text(": "+fn.Result.String()))
+	}
+	return header
+}
+
+// function ends with its block, which call relies on to hug it
+func (f *formatter) function(fn *ast.FunctionLiteral) doc {
+	return concat{f.functionHeader(fn), text(" "), f.block(fn.Body)}
+}
+
+// arms with a single expression lose their braces
+func (f *formatter) match(expr *ast.MatchExpression) doc {
+	arms := []doc{}
+	for _, arm := range expr.Arms {
+		d := concat{text(arm.Variant.Value)}
+		if arm.Bindings != nil {
+			d = append(d, f.identifiers(arm.Bindings))
+		}
+		d = append(d, text(" => "))
+		if stmt, ok := singleExpression(arm.Body); ok {
+			d = append(d, f.expression(stmt.Expression))
+		} else {
+			d = append(d, f.block(arm.Body))
+		}
+		arms = append(arms, d)
+	}
+
+	header := concat{text("match ("), f.expression(expr.Subject), text(") {")}
+	if len(arms) == 0 {
+		return append(header, text("}"))
+	}
+	return &group{d: concat{header, nest{concat{spaced, join(arms, concat{text(","), spaced}), ifBreak(",")}}, spaced, text("}")}}
+}
+
+func singleExpression(block *ast.StatementBlock) (*ast.ExpressionStatement, bool) {
+	if len(block.Statements) != 1 {
+		return nil, false
+	}
+	stmt, ok := block.Statements[0].(*ast.ExpressionStatement)
+	return stmt, ok
+}
+
+func join(docs []doc, sep doc) doc {
+	out := concat{}
+	for i, d := range docs {
+		if i > 0 {
+			out = append(out, sep)
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// strings have no escapes, so they print as they were written
+func quote(s string) string {
+	return `"` + s + `"`
+}
@@ -0,0 +1,165 @@
+package format
+
+import (
+	"interpreter/lexer"
+	"interpreter/parser"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let  x=1+2*3", "let x = 1 + 2 * 3;"},
+		{"let x = (1 + 2) * 3; -(a + b); !(!a); a - (b - c); (a - b) - c", "let x = (1 + 2) * 3;\n-(a + b);\n!!a;\na - (b - c);\na - b - c"},
+		{"(-a).b; -a.b; f(x)(y)[1:]; (1..3)[0]; xs?.[0]?.x?.(1)", "(-a).b;\n-a.b;\nf(x)(y)[1:];\n(1..3)[0];\nxs?.[0]?.x?.(1)"},
+		{"p.x = q.y = 1; (a ?? b) ?? c; a ?? (b ?? c)", "p.x = q.y = 1;\na ?? b ?? c;\na ?? (b ?? c)"},
+		{"infixr 8 ^ = f; 1 ^ (2 ^ 3); (1 ^ 2) ^ 3", "infixr 8 ^ = f;\n1 ^ 2 ^ 3;\n(1 ^ 2) ^ 3"},
+		{"let f = func(a,b){a+b}", "let f = func(a, b) { a + b };"},
+		{"let f:func(int):[int]=func(a:int,b):[int]{[a]}", "let f: func(int): [int] = func(a: int, b): [int] { [a] };"},
+		{"let f = func(){ let a = 1; a }", "let f = func() {\n    let a = 1;\n    a\n};"},
+		{"if (a) { b } else { c }", "if (a) { b } else { c }"},
+		{"if (a) { b; c } else { d }", "if (a) {\n    b;\n    c\n} else {\n    d\n}"},
+		{"if (a) { b }; [c]", "if (a) { b };\n[c]"},
+		{"if (a) { b }; c", "if (a) { b }\nc"},
+		{"try { a } catch (e) { b } finally { c }", "try { a } catch (e) { b } finally { c }"},
+		{"struct P { x, y }; type Q {}", "struct P { x, y }\ntype Q {}"},
+		{"struct P { x; func f(self) { self.x } func g(self) { 1 } }",
+			"struct P {\n    x;\n\n    func f(self) { self.x }\n\n    func g(self) { 1 }\n}"},
+		{"enum E { A(x, y), B }", "enum E { A(x, y), B }"},
+		{"match (s) { A(x) => x, B => { 1 } }", "match (s) { A(x) => x, B => 1 }"},
+		{`import "a/b" as c; export let d = P{x: 1, y: "s"}`, "import \"a/b\" as c;\nexport let d = P{x: 1, y: \"s\"};"},
+		{"let m = macro(a) { quote(unquote(a)) }; [1, 2][0]", "let m = macro(a) { quote(unquote(a)) };\n[1, 2][0]"},
+	}
+
+	for _, tt := range tests {
+		out, err := Source([]byte(tt.input), Config{})
+		if err != nil {
+			t.Fatalf("Source(%q) failed: %v", tt.input, err)
+		}
+		if string(out) != tt.expected+"\n" {
+			t.Errorf("wrong format for %q.\nexpected=\n%s\ngot=\n%s", tt.input, tt.expected, out)
+		}
+	}
+}
+
+func TestFormatWidth(t *testing.T) {
+	tests := []struct {
+		input    string
+		width    int
+		expected string
+	}{
+		{"f(aaaa, bbbb, cccc)", 20, "f(aaaa, bbbb, cccc)"},
+		{"f(aaaa, bbbb, cccc)", 15, "f(\n    aaaa,\n    bbbb,\n    cccc\n)"},
+		{"let xs = [aaaa, bbbb]", 15, "let xs = [\n    aaaa,\n    bbbb\n];"},
+		{"P{aaaa: 1, bbbb: 2}", 15, "P{\n    aaaa: 1,\n    bbbb: 2,\n}"},
+		{"aaaa + bbbb + cccc", 15, "aaaa + bbbb +\n    cccc"},
+		{"each(xs, func(x) { puts(x) })", 20, "each(xs, func(x) {\n    puts(x)\n})"},
+		{"each(xs, func(x) { a; b })", 80, "each(xs, func(x) {\n    a;\n    b\n})"},
+		{"if (a) { b } else { c }", 15, "if (a) {\n    b\n} else {\n    c\n}"},
+		{"enum E { Aaaa, Bbbb }", 15, "enum E {\n    Aaaa,\n    Bbbb,\n}"},
+	}
+
+	for _, tt := range tests {
+		out, err := Source([]byte(tt.input), Config{Width: tt.width})
+		if err != nil {
+			t.Fatalf("Source(%q) failed: %v", tt.input, err)
+		}
+		if string(out) != tt.expected+"\n" {
+			t.Errorf("wrong format for %q at width %d.\nexpected=\n%s\ngot=\n%s", tt.input, tt.width, tt.expected, out)
+		}
+	}
+}
+
+func TestFormatComments(t *testing.T) {
+	input := `// header
+
+let a = 1; // one
+// about b
+let b = func() {
+  // first
+  a
+
+
+  // last
+};
+// footer`
+	expected := `// header
+
+let a = 1; // one
+// about b
+let b = func() {
+    // first
+    a
+
+    // last
+};
+// footer
+`
+	out, err := Source([]byte(input), Config{})
+	if err != nil {
+		t.Fatalf("Source failed: %v", err)
+	}
+	if string(out) != expected {
+		t.Errorf("wrong format.\nexpected=\n%s\ngot=\n%s", expected, out)
+	}
+}
+
+// formatting twice changes nothing and the program still means the same
+func TestFormatStable(t *testing.T) {
+	inputs := []string{
+		"let x = (1 + 2) * -3 - -(4 - 5); x / (2 * 3) == 1 != (true == false)",
+		"struct Vec { x, y; func __add__(self, o) { Vec{x: self.x + o.x, y: self.y + o.y} } } Vec{x: 1, y: 2} + Vec{x: 3, y: 4}",
+		"enum Opt { Some(v), None } let f = func(o) { match (o) { Some(v) => v, None => { throw error(\"none\") } } }; f(Opt.Some(1))",
+		"let r = try { risky() } catch (e) { message(e) } finally { cleanup() }; r ?? 0",
+		"infixl 6 <+> = func(a, b) { a + b }; infixr 7 <*> = func(a, b) { a * b }; 1 <+> 2 <*> (3 <*> 4) <+> 5",
+		"map([1, 2, 3], func(longParameterName) { let doubled = longParameterName * 2; doubled + 1 })",
+		"if (a) { b } else { c }; (d); if (e) { f }; [g]; if (h) { i }; -j",
+		"xs[1:-1]; xs[:2]; xs?.[:]; 1..10; (1..2)..3; a..b + c; f()?.(1)",
+	}
+
+	for _, input := range inputs {
+		for _, width := range []int{10, 40, 80} {
+			out, err := Source([]byte(input), Config{Width: width})
+			if err != nil {
+				t.Fatalf("Source(%q) failed: %v", input, err)
+			}
+			again, err := Source(out, Config{Width: width})
+			if err != nil {
+				t.Fatalf("formatted %q does not parse: %v\n%s", input, err, out)
+			}
+			if string(again) != string(out) {
+				t.Errorf("formatting %q twice differs at width %d.\nfirst=\n%s\nsecond=\n%s", input, width, out, again)
+			}
+			if parse(t, string(out)) != parse(t, input) {
+				t.Errorf("formatting %q at width %d changed its meaning.\n%s", input, width, out)
+			}
+		}
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	_, err := Source([]byte("let = 1"), Config{})
+	if err == nil || !strings.Contains(err.Error(), "expected next token to be ID") {
+		t.Errorf("expected a parse error, got=%v", err)
+	}
+}
+
+func TestFormatNode(t *testing.T) {
+	p := parser.New(lexer.New("let f = func(x) { x * (1 + 2) }"))
+	program := p.ParseProgram()
+	if out := Node(program.Statements[0], Config{}); out != "let f = func(x) { x * (1 + 2) };" {
+		t.Errorf("wrong format. got=%q", out)
+	}
+}
+
+func parse(t *testing.T, input string) string {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program.String()
+}
@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"interpreter/token"
+	"strings"
 )
 
 type Lexer struct {
@@ -9,15 +10,37 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+
+	// line of the current character and the offset that line starts at
+	line      int
+	lineStart int
+
+	// operators declared with infixl/infixr so far, and how far into such a
+	// declaration we are
+	operators []string
+	fixity    int
+
+	// line comments skipped so far, for tools that keep them
+	comments []token.Token
 }
 
+const (
+	fixityNone = iota
+	fixityKeyword
+	fixityLevel
+)
+
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.lineStart = l.readPosition
+	}
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 		l.position = l.readPosition
@@ -37,10 +60,53 @@ func (l *Lexer) peekChar() byte {
 	}
 }
 
+// GetToken returns the next token. Besides the built in tokens it recognizes
+// the symbol of an operator declaration (`infixl 6 <+> = ...`) and, from then
+// on, every use of that symbol as an OPERATOR token.
 func (l *Lexer) GetToken() token.Token {
+	l.eatWhitespace()
+	line, column := l.line, l.position-l.lineStart+1
+
 	var tok token.Token
+	if l.fixity == fixityLevel && isOperatorChar(l.ch) {
+		tok = token.Token{Type: token.OPERATOR, Lexeme: l.readOperator()}
+		if !token.IsBuiltinOperator(tok.Lexeme) {
+			l.operators = append(l.operators, tok.Lexeme)
+		}
+	} else if op := l.matchOperator(); op != "" {
+		for range op {
+			l.readChar()
+		}
+		tok = token.Token{Type: token.OPERATOR, Lexeme: op}
+	} else {
+		tok = l.readToken()
+	}
 
-	l.eatWhitespace()
+	switch {
+	case tok.Type == token.INFIXL || tok.Type == token.INFIXR:
+		l.fixity = fixityKeyword
+	case tok.Type == token.DIGIT && l.fixity == fixityKeyword:
+		l.fixity = fixityLevel
+	default:
+		l.fixity = fixityNone
+	}
+	tok.Line, tok.Column = line, column
+	return tok
+}
+
+// longest declared operator starting at the current character
+func (l *Lexer) matchOperator() string {
+	match := ""
+	for _, op := range l.operators {
+		if len(op) > len(match) && strings.HasPrefix(l.input[l.position:], op) {
+			match = op
+		}
+	}
+	return match
+}
+
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
 
 	switch l.ch {
 	case '{':
@@ -51,11 +117,18 @@ func (l *Lexer) GetToken() token.Token {
 		tok = createToken(token.LPAREN, l.ch)
 	case ')':
 		tok = createToken(token.RPAREN, l.ch)
+	case '[':
+		tok = createToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = createToken(token.RBRACKET, l.ch)
 	case '=':
 		if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
 			tok = token.Token{Type: token.EQ, Lexeme: string(ch) + string(l.ch)}
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.ARROW, Lexeme: "=>"}
 		} else {
 			tok = createToken(token.ASSIGN, l.ch)
 		}
@@ -83,6 +156,30 @@ func (l *Lexer) GetToken() token.Token {
 		tok = createToken(token.SEMICOLON, l.ch)
 	case ',':
 		tok = createToken(token.COMMA, l.ch)
+	case '?':
+		if l.peekChar() == '.' {
+			l.readChar()
+			tok = token.Token{Type: token.QDOT, Lexeme: "?."}
+		} else if l.peekChar() == '?' {
+			l.readChar()
+			tok = token.Token{Type: token.COALESCE, Lexeme: "??"}
+		} else {
+			tok = createToken(token.ILLEGAL, l.ch)
+		}
+	case ':':
+		tok = createToken(token.COLON, l.ch)
+	case '.':
+		if l.peekChar() == '.' {
+			l.readChar()
+			if l.peekChar() == '=' {
+				l.readChar()
+				tok = token.Token{Type: token.RANGEINCL, Lexeme: "..="}
+			} else {
+				tok = token.Token{Type: token.RANGE, Lexeme: ".."}
+			}
+		} else {
+			tok = createToken(token.DOT, l.ch)
+		}
 	case '"':
 		tok.Type = token.STRING
 		tok.Lexeme = l.readString()
@@ -107,11 +204,11 @@ func (l *Lexer) GetToken() token.Token {
 }
 
 func (l *Lexer) readString() string {
-	position := l.position
+	position := l.position + 1
 
 	for {
 		l.readChar()
-		if l.ch != '"' || l.ch != 0 {
+		if l.ch == '"' || l.ch == 0 {
 			break
 		}
 	}
@@ -127,6 +224,14 @@ func (l *Lexer) readId() string {
 	return l.input[pos:l.position]
 }
 
+func (l *Lexer) readOperator() string {
+	pos := l.position
+	for isOperatorChar(l.ch) {
+		l.readChar()
+	}
+	return l.input[pos:l.position]
+}
+
 func (l *Lexer) readNumber() string {
 	pos := l.position
 	for isDigit(l.ch) {
@@ -139,14 +244,47 @@ func isLetter(ch byte) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
 }
 
+func isOperatorChar(ch byte) bool {
+	return strings.IndexByte("+-*/<>=!&|^%~@$?:.", ch) >= 0
+}
+
 func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+// Offset returns the offset of the first byte not read yet, which after
+// GetToken is where the token it returned ends.
+func (l *Lexer) Offset() int {
+	return l.position
+}
+
+// Comments returns the // comments read so far, in order. The parser never
+// sees them.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
 func (l *Lexer) eatWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r':
+			l.readChar()
+		case l.ch == '/' && l.peekChar() == '/':
+			l.readComment()
+		default:
+			return
+		}
+	}
+}
+
+func (l *Lexer) readComment() {
+	comment := token.Token{Type: token.COMMENT, Line: l.line, Column: l.position - l.lineStart + 1}
+	pos := l.position
+	for l.ch != '\n' && l.ch != 0 {
 		l.readChar()
 	}
+	comment.Lexeme = strings.TrimRight(l.input[pos:l.position], " \t\r")
+	l.comments = append(l.comments, comment)
 }
 
 func createToken(tokenType token.TokenType, ch byte) token.Token {
@@ -0,0 +1,436 @@
+// Package lint finds mistakes in a program without running it: names that are
+// never used or that hide another, code that can't run, and expressions that
+// can only fail.
+//
+// Each finding comes from a rule which can be turned off for a whole package
+// in the [lint] table of its manifest,
+//
+//	[lint]
+//	shadow = false
+//
+// or for a single line with a comment on that line or the one before it:
+//
+//	let unused = 1; // lint:ignore unused-let
+//	// lint:ignore type-mismatch, call-literal
+//
+// An ignore comment without rules silences every rule.
+package lint
+
+import (
+	"errors"
+	"fmt"
+	"interpreter/ast"
+	"interpreter/evaluator"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"interpreter/resolver"
+	"interpreter/token"
+	"sort"
+	"strings"
+)
+
+const (
+	UnusedLet         = "unused-let"
+	UnusedParameter   = "unused-parameter"
+	Shadow            = "shadow"
+	Unreachable       = "unreachable"
+	ConstantCondition = "constant-condition"
+	TypeMismatch      = "type-mismatch"
+	CallLiteral       = "call-literal"
+)
+
+// Rules lists every rule, all of them are on unless configured otherwise.
+var Rules = []string{UnusedLet, UnusedParameter, Shadow, Unreachable, ConstantCondition, TypeMismatch, CallLiteral}
+
+// Config turns rules on and off by name, rules it doesn't name are on.
+type Config map[string]bool
+
+func (c Config) enabled(rule string) bool {
+	on, ok := c[rule]
+	return !ok || on
+}
+
+// Diagnostic is one finding, at the token it is about.
+type Diagnostic struct {
+	Line, Column int
+	Rule         string
+	Message      string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s (%s)", d.Line, d.Column, d.Message, d.Rule)
+}
+
+// Check lints src, or returns its parse errors. Names starting with _ are
+// never reported as unused.
+func Check(src string, config Config) ([]Diagnostic, error) {
+	for rule := range config {
+		if !isRule(rule) {
+			return nil, fmt.Errorf("unknown lint rule %q", rule)
+		}
+	}
+
+	l := lexer.New(src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	c := &checker{
+		config:  config,
+		table:   resolver.Resolve(program, evaluator.IsBuiltin, nil),
+		ignored: ignores(l.Comments()),
+	}
+	c.unused(program)
+	c.shadows()
+	ast.Inspect(program, c.inspect)
+
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		a, b := c.diagnostics[i], c.diagnostics[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return c.diagnostics, nil
+}
+
+func isRule(name string) bool {
+	for _, rule := range Rules {
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
+
+type checker struct {
+	config      Config
+	table       *resolver.Table
+	diagnostics []Diagnostic
+
+	// rules ignored by line, an empty list ignores all of them
+	ignored map[int][]string
+}
+
+// ignores reads the lint:ignore comments, each covers its own line and the
+// next one
+func ignores(comments []token.Token) map[int][]string {
+	ignored := map[int][]string{}
+	for _, comment := range comments {
+		text := strings.TrimSpace(strings.TrimPrefix(comment.Lexeme, "//"))
+		rest, ok := strings.CutPrefix(text, "lint:ignore")
+		if !ok || rest != "" && rest[0] != ' ' {
+			continue
+		}
+		rules := []string{}
+		for _, rule := range strings.Split(rest, ",") {
+			if rule = strings.TrimSpace(rule); rule != "" {
+				rules = append(rules, rule)
+			}
+		}
+		for _, line := range []int{comment.Line, comment.Line + 1} {
+			if old, ok := ignored[line]; ok && (len(old) == 0 || len(rules) == 0) {
+				ignored[line] = []string{}
+			} else {
+				ignored[line] = append(old, rules...)
+			}
+		}
+	}
+	return ignored
+}
+
+func (c *checker) report(tok token.Token, rule string, format string, args ...interface{}) {
+	if !c.config.enabled(rule) {
+		return
+	}
+	if rules, ok := c.ignored[tok.Line]; ok {
+		if len(rules) == 0 {
+			return
+		}
+		for _, ignored := range rules {
+			if ignored == rule {
+				return
+			}
+		}
+	}
+	c.diagnostics = append(c.diagnostics, Diagnostic{
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Rule:    rule,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// unused reports lets and parameters nothing refers to. Exported lets are
+// used by importers and a method's receiver has to be there.
+func (c *checker) unused(program *ast.Program) {
+	check := func(ident *ast.Identifier, rule string, what string) {
+		if ident == nil || strings.HasPrefix(ident.Value, "_") {
+			return
+		}
+		if decl, ok := c.table.Declarations[ident]; ok && len(decl.Uses) == 0 {
+			c.report(ident.Token, rule, "%s %s is never used", what, ident.Value)
+		}
+	}
+
+	exported := map[ast.Statement]bool{}
+	receivers := map[*ast.Identifier]bool{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.ExportStatement:
+			exported[node.Statement] = true
+		case *ast.StructStatement:
+			for _, method := range node.Methods {
+				if len(method.Parameters) > 0 {
+					receivers[method.Parameters[0]] = true
+				}
+			}
+		case *ast.LetStatement:
+			if !exported[node] {
+				check(node.Name, UnusedLet, "let")
+			}
+		case *ast.FunctionLiteral:
+			for _, param := range node.Parameters {
+				if !receivers[param] {
+					check(param, UnusedParameter, "parameter")
+				}
+			}
+		case *ast.MacroLiteral:
+			for _, param := range node.Parameters {
+				check(param, UnusedParameter, "parameter")
+			}
+		}
+		return true
+	})
+}
+
+// shadows reports names declared inside a function, match arm or catch block
+// which hide the same name declared around it
+func (c *checker) shadows() {
+	for ident, decl := range c.table.Declarations {
+		for scope := decl.Scope.Parent; scope != nil; scope = scope.Parent {
+			outer, ok := scope.Names[decl.Name]
+			if !ok {
+				continue
+			}
+			if tok, ok := position(outer.Node); ok {
+				c.report(ident.Token, Shadow, "%s shadows the declaration at %d:%d", decl.Name, tok.Line, tok.Column)
+			} else {
+				c.report(ident.Token, Shadow, "%s shadows an outer declaration", decl.Name)
+			}
+			break
+		}
+	}
+}
+
+func position(node ast.Node) (token.Token, bool) {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		return node.Token, true
+	case *ast.ImportStatement:
+		return node.Token, true
+	}
+	return token.Token{}, false
+}
+
+// builtinOperators are the infix operators the evaluator implements itself,
+// the others may be extended to take any types
+var builtinOperators = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true,
+	"<": true, ">": true, "==": true, "!=": true,
+}
+
+func (c *checker) inspect(node ast.Node) bool {
+	switch node := node.(type) {
+	case *ast.Program:
+		c.unreachable(node.Statements)
+	case *ast.StatementBlock:
+		c.unreachable(node.Statements)
+
+	case *ast.IfExpression:
+		if value, ok := constant(node.Condition); ok {
+			c.report(node.Token, ConstantCondition, "condition is always %t", truthy(value))
+		}
+
+	case *ast.InfixExpression:
+		if !builtinOperators[node.Op] || node.Token.Type == token.OPERATOR {
+			break
+		}
+		left, right := staticType(node.Left), staticType(node.Right)
+		if left != "" && right != "" && left != right {
+			c.report(node.Token, TypeMismatch, "%s %s %s is always a type mismatch", left, node.Op, right)
+		}
+
+	case *ast.CallExpression:
+		if node.Function.TokenLexeme() == "quote" {
+			// quoted code is data for a macro
+			return false
+		}
+		switch node.Function.(type) {
+		case *ast.IntegerLiteral, *ast.StringLiteral, *ast.BooleanExpression, *ast.ArrayLiteral:
+			c.report(node.Token, CallLiteral, "%s literal called like a function", staticType(node.Function))
+		}
+	}
+	return true
+}
+
+// unreachable reports the first statement after a return or throw
+func (c *checker) unreachable(statements []ast.Statement) {
+	for i, stmt := range statements[:max(len(statements)-1, 0)] {
+		var what string
+		switch stmt.(type) {
+		case *ast.ReturnStatement:
+			what = "return"
+		case *ast.ThrowStatement:
+			what = "throw"
+		default:
+			continue
+		}
+		c.report(statementToken(statements[i+1]), Unreachable, "unreachable statement after %s", what)
+		return
+	}
+}
+
+// statementToken is the first token of a statement
+func statementToken(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.StructStatement:
+		return stmt.Token
+	case *ast.EnumStatement:
+		return stmt.Token
+	case *ast.ImportStatement:
+		return stmt.Token
+	case *ast.ExportStatement:
+		return stmt.Token
+	case *ast.ThrowStatement:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	case *ast.StatementBlock:
+		return stmt.Token
+	case *ast.OperatorStatement:
+		return stmt.Token
+	}
+	return token.Token{}
+}
+
+// constant is the value of an expression made of literals, when it can be
+// known without running it. Arrays and functions are values that are always
+// true.
+func constant(expr ast.Expression) (interface{}, bool) {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return expr.Value, true
+	case *ast.StringLiteral:
+		return expr.Value, true
+	case *ast.BooleanExpression:
+		return expr.Value, true
+	case *ast.ArrayLiteral, *ast.FunctionLiteral:
+		return expr, true
+	case *ast.PrefixExpression:
+		value, ok := constant(expr.Value)
+		if !ok {
+			return nil, false
+		}
+		switch v := value.(type) {
+		case int64:
+			if expr.Op == "-" {
+				return -v, true
+			}
+		}
+		if expr.Op == "!" {
+			return !truthy(value), true
+		}
+	case *ast.InfixExpression:
+		left, ok := constant(expr.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := constant(expr.Right)
+		if !ok {
+			return nil, false
+		}
+		return fold(left, expr.Op, right)
+	}
+	return nil, false
+}
+
+func fold(left interface{}, op string, right interface{}) (interface{}, bool) {
+	switch l := left.(type) {
+	case int64:
+		r, ok := right.(int64)
+		if !ok {
+			return nil, false
+		}
+		switch op {
+		case "+":
+			return l + r, true
+		case "-":
+			return l - r, true
+		case "*":
+			return l * r, true
+		case "<":
+			return l < r, true
+		case ">":
+			return l > r, true
+		case "==":
+			return l == r, true
+		case "!=":
+			return l != r, true
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, false
+		}
+		switch op {
+		case "+":
+			return l + r, true
+		case "==":
+			return l == r, true
+		case "!=":
+			return l != r, true
+		}
+	case bool:
+		r, ok := right.(bool)
+		if !ok {
+			return nil, false
+		}
+		switch op {
+		case "==":
+			return l == r, true
+		case "!=":
+			return l != r, true
+		}
+	}
+	return nil, false
+}
+
+// truthy follows the evaluator, only false is false among constants
+func truthy(value interface{}) bool {
+	b, ok := value.(bool)
+	return !ok || b
+}
+
+// staticType is the evaluator's name for the type an expression always has,
+// or "" if that depends on what it refers to
+func staticType(expr ast.Expression) string {
+	switch expr.(type) {
+	case *ast.ArrayLiteral:
+		return "ARRAY"
+	case *ast.FunctionLiteral:
+		return "FUNCTION"
+	}
+	switch value, _ := constant(expr); value.(type) {
+	case int64:
+		return "INTEGER"
+	case string:
+		return "STRING"
+	case bool:
+		return "BOOLEAN"
+	}
+	return ""
+}
@@ -0,0 +1,99 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; puts(x)", nil},
+		{"let x = 1;", []string{"1:5: let x is never used (unused-let)"}},
+		{"let _x = 1; export let y = 2;", nil},
+		{"let f = func(a, b) { a }; f(1, 2)", []string{"1:17: parameter b is never used (unused-parameter)"}},
+		{"struct P { x; func get(self, _unused) { 1 } }; P", nil},
+		{"let x = 1; let f = func() { let x = 2; x }; f(x)", []string{"1:33: x shadows the declaration at 1:5 (shadow)"}},
+		{"let f = func(f) { f }; f(1)", []string{"1:14: f shadows the declaration at 1:5 (shadow)"}},
+		{"let f = func() { return 1; puts(2); puts(3) }; f()", []string{"1:28: unreachable statement after return (unreachable)"}},
+		{"throw \"x\";\nlet y = 1; y", []string{"2:1: unreachable statement after throw (unreachable)"}},
+		{"if (1 < 2) { 1 }", []string{"1:1: condition is always true (constant-condition)"}},
+		{"if (!0) { 1 }", []string{"1:1: condition is always false (constant-condition)"}},
+		{"if (\"a\" == \"b\") { 1 }", []string{"1:1: condition is always false (constant-condition)"}},
+		{"let x = 1; if (x < 2) { x }", nil},
+		{"1 + \"a\"", []string{"1:3: INTEGER + STRING is always a type mismatch (type-mismatch)"}},
+		{"(1 < 2) == 1", []string{"1:9: BOOLEAN == INTEGER is always a type mismatch (type-mismatch)"}},
+		{"null ?? 1 ?? \"a\"", nil},
+		{"1(2); [1](0); \"s\"()", []string{
+			"1:2: INTEGER literal called like a function (call-literal)",
+			"1:10: ARRAY literal called like a function (call-literal)",
+			"1:18: STRING literal called like a function (call-literal)",
+		}},
+		{"let m = macro(a) { quote(1 + \"a\" + unquote(a)) }; m(1)", nil},
+	}
+
+	for _, tt := range tests {
+		diagnostics, err := Check(tt.input, nil)
+		if err != nil {
+			t.Fatalf("Check(%q) failed: %v", tt.input, err)
+		}
+		var got []string
+		for _, d := range diagnostics {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong diagnostics for %q.\nexpected=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestSuppression(t *testing.T) {
+	tests := []struct {
+		input  string
+		config Config
+		rules  []string
+	}{
+		{"let x = 1; 1 + \"a\"", nil, []string{UnusedLet, TypeMismatch}},
+		{"let x = 1; 1 + \"a\"", Config{UnusedLet: false}, []string{TypeMismatch}},
+		{"let x = 1; 1 + \"a\"", Config{UnusedLet: true}, []string{UnusedLet, TypeMismatch}},
+		{"let x = 1; 1 + \"a\" // lint:ignore unused-let", nil, []string{TypeMismatch}},
+		{"// lint:ignore\nlet x = 1; 1 + \"a\"", nil, nil},
+		{"// lint:ignore type-mismatch, unused-let\nlet x = 1; 1 + \"a\"", nil, nil},
+		{"// lint:ignore unused-let\n\nlet x = 1;", nil, []string{UnusedLet}},
+		{"// lint:ignored\nlet x = 1;", nil, []string{UnusedLet}},
+	}
+
+	for _, tt := range tests {
+		diagnostics, err := Check(tt.input, tt.config)
+		if err != nil {
+			t.Fatalf("Check(%q) failed: %v", tt.input, err)
+		}
+		var rules []string
+		for _, d := range diagnostics {
+			rules = append(rules, d.Rule)
+		}
+		if strings.Join(rules, ",") != strings.Join(tt.rules, ",") {
+			t.Errorf("wrong rules for %q with %v. expected=%v, got=%v", tt.input, tt.config, tt.rules, rules)
+		}
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		config   Config
+		expected string
+	}{
+		{"let = 1", nil, "expected next token to be ID"},
+		{"1", Config{"no-such-rule": false}, `unknown lint rule "no-such-rule"`},
+	}
+
+	for _, tt := range tests {
+		_, err := Check(tt.input, tt.config)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected error containing %q for %q, got=%v", tt.expected, tt.input, err)
+		}
+	}
+}
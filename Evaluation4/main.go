@@ -3,8 +3,11 @@ package main
 import (
 	"fmt"
 	"interpreter/console"
+	"interpreter/evaluator"
+	"interpreter/optimizer"
 	"os"
 	"os/user"
+	"strings"
 )
 
 func main() {
@@ -12,6 +15,71 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	if len(os.Args) > 1 && os.Args[1] == "lock" {
+		dir := "."
+		if len(os.Args) > 2 {
+			dir = os.Args[2]
+		}
+		if !console.Lock(dir, os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		paths := os.Args[2:]
+		if len(paths) == 0 {
+			paths = []string{"."}
+		}
+		if !console.Lint(paths, os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 2 && os.Args[1] == "ast" {
+		if !console.DumpAST(os.Args[2], os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 2 && os.Args[1] == "dot" {
+		if !console.DumpDot(os.Args[2], os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	}
+	// --strict infers the types of the file, or of the console lines.
+	// --optimize runs every optimizer pass, --optimize=fold,inline only those.
+	// --machine evaluates on the explicit stack machine instead of recursively.
+	args := os.Args[1:]
+	var options console.Options
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		flag, value, hasValue := strings.Cut(args[0], "=")
+		switch {
+		case flag == "--strict" && !hasValue:
+			options.Strict = true
+		case flag == "--machine" && !hasValue:
+			evaluator.UseMachine = true
+		case flag == "--optimize" && !hasValue:
+			options.Optimize = &optimizer.Config{}
+		case flag == "--optimize":
+			config, err := optimizer.Only(strings.Split(value, ",")...)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(2)
+			}
+			options.Optimize = &config
+		default:
+			fmt.Printf("unknown flag %s\n", args[0])
+			os.Exit(2)
+		}
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		if !console.Run(args[0], options, os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	}
 	fmt.Printf("Type in commands\n")
-	console.Go(os.Stdin, os.Stdout)
+	console.Go(os.Stdin, os.Stdout, options)
 }
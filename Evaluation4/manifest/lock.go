@@ -0,0 +1,176 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LockFileName sits next to the root manifest
+const LockFileName = "monkey.lock"
+
+// Lockfile records the content hash of every dependency so a build can be
+// checked against the exact sources it was locked with
+type Lockfile struct {
+	Packages []LockedPackage
+}
+
+type LockedPackage struct {
+	Name    string
+	Version string
+	// Source is the package directory relative to the root package
+	Source string
+	Hash   string
+}
+
+// Lock hashes every dependency of the root package
+func (r *Resolver) Lock() (*Lockfile, error) {
+	lock := &Lockfile{}
+	for _, pkg := range r.Packages() {
+		if pkg == r.Root {
+			continue
+		}
+
+		hash, err := HashDir(pkg.Manifest.Dir)
+		if err != nil {
+			return nil, err
+		}
+
+		source, err := filepath.Rel(r.Root.Manifest.Dir, pkg.Manifest.Dir)
+		if err != nil {
+			return nil, err
+		}
+
+		lock.Packages = append(lock.Packages, LockedPackage{
+			Name:    pkg.Manifest.Name,
+			Version: pkg.Manifest.Version,
+			Source:  filepath.ToSlash(source),
+			Hash:    hash,
+		})
+	}
+	return lock, nil
+}
+
+// Verify fails when a dependency was added, removed, moved or changed since the lock was written
+func (r *Resolver) Verify(lock *Lockfile) error {
+	current, err := r.Lock()
+	if err != nil {
+		return err
+	}
+
+	locked := map[string]LockedPackage{}
+	for _, pkg := range lock.Packages {
+		locked[pkg.Name] = pkg
+	}
+
+	problems := []string{}
+	for _, pkg := range current.Packages {
+		old, ok := locked[pkg.Name]
+		delete(locked, pkg.Name)
+		switch {
+		case !ok:
+			problems = append(problems, pkg.Name+" is not locked")
+		case old.Source != pkg.Source:
+			problems = append(problems, fmt.Sprintf("%s moved from %s to %s", pkg.Name, old.Source, pkg.Source))
+		case old.Version != pkg.Version:
+			problems = append(problems, fmt.Sprintf("%s changed version from %s to %s", pkg.Name, old.Version, pkg.Version))
+		case old.Hash != pkg.Hash:
+			problems = append(problems, pkg.Name+" has changed")
+		}
+	}
+	for name := range locked {
+		problems = append(problems, name+" is locked but no longer a dependency")
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("%s is out of date: %s", LockFileName, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// HashDir hashes the paths and contents of every file in a package. The
+// package's own vendor directory and lock file are left out, vendored
+// packages are hashed on their own.
+func HashDir(dir string) (string, error) {
+	files := []string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && rel == VendorDir {
+			return filepath.SkipDir
+		}
+		if d.Type().IsRegular() && rel != LockFileName {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, rel := range files {
+		content, err := os.ReadFile(filepath.Join(dir, rel))
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(content)
+		fmt.Fprintf(h, "%s\x00%x\n", filepath.ToSlash(rel), sum)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (l *Lockfile) String() string {
+	var out strings.Builder
+	out.WriteString("# Written by `lock`, do not edit.\n")
+	for _, pkg := range l.Packages {
+		out.WriteString("\n[[package]]\n")
+		fmt.Fprintf(&out, "name = %s\n", quote(pkg.Name))
+		fmt.Fprintf(&out, "version = %s\n", quote(pkg.Version))
+		fmt.Fprintf(&out, "source = %s\n", quote(pkg.Source))
+		fmt.Fprintf(&out, "hash = %s\n", quote(pkg.Hash))
+	}
+	return out.String()
+}
+
+// Write saves the lock file next to the root manifest
+func (l *Lockfile) Write(dir string) error {
+	return os.WriteFile(filepath.Join(dir, LockFileName), []byte(l.String()), 0o644)
+}
+
+// ReadLockfile reads the lock file in dir
+func ReadLockfile(dir string) (*Lockfile, error) {
+	path := filepath.Join(dir, LockFileName)
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := parseTOML(string(source))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	lock := &Lockfile{}
+	for _, t := range doc.arrays["package"] {
+		lock.Packages = append(lock.Packages, LockedPackage{
+			Name:    t["name"].str,
+			Version: t["version"].str,
+			Source:  t["source"].str,
+			Hash:    t["hash"].str,
+		})
+	}
+	return lock, nil
+}
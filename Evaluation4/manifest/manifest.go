@@ -0,0 +1,153 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// FileName is the manifest at the root of every package
+	FileName = "monkey.toml"
+	// VendorDir holds the dependencies which don't name a path
+	VendorDir = "vendor"
+	// DefaultEntry is the file `import "pkg"` loads when the manifest names no entry
+	DefaultEntry = "lib.monkey"
+)
+
+// Manifest describes a package:
+//
+//	[package]
+//	name = "app"
+//	version = "0.1.0"
+//	entry = "lib.monkey"
+//
+//	[dependencies]
+//	strs = { path = "../strs" }
+//	dates = "1.2.0"
+//
+//	[lint]
+//	shadow = false
+//
+// A dependency with a path lives there, one with only a version is vendored
+// under vendor/<name>. When both are given the version is checked. The lint
+// table turns rules of `monkey lint` on or off.
+type Manifest struct {
+	Name    string
+	Version string
+	Entry   string
+	// Dir is the directory holding the manifest
+	Dir          string
+	Dependencies []Dependency
+	Lint         map[string]bool
+}
+
+type Dependency struct {
+	Name    string
+	Version string
+	// Dir is absolute, relative paths in the manifest are joined to its Dir
+	Dir string
+}
+
+// Load reads the manifest in dir
+func Load(dir string) (*Manifest, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := os.ReadFile(filepath.Join(abs, FileName))
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := Parse(string(source), abs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filepath.Join(abs, FileName), err)
+	}
+	return m, nil
+}
+
+// Find looks for a manifest in dir and its parents, it returns nil when there is none
+func Find(dir string) (*Manifest, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, err := os.Stat(filepath.Join(abs, FileName)); err == nil {
+			return Load(abs)
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return nil, nil
+		}
+		abs = parent
+	}
+}
+
+// Parse reads a manifest for a package in dir
+func Parse(source string, dir string) (*Manifest, error) {
+	doc, err := parseTOML(source)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg, ok := doc.tables["package"]
+	if !ok {
+		return nil, errors.New("missing [package] table")
+	}
+
+	m := &Manifest{
+		Name:    pkg["name"].str,
+		Version: pkg["version"].str,
+		Entry:   pkg["entry"].str,
+		Dir:     dir,
+	}
+	if m.Name == "" {
+		return nil, errors.New("missing package name")
+	}
+	if m.Entry == "" {
+		m.Entry = DefaultEntry
+	}
+
+	for name, spec := range doc.tables["dependencies"] {
+		dep := Dependency{Name: name, Version: spec.str}
+		if spec.table != nil {
+			dep.Version = spec.table["version"]
+			if path, ok := spec.table["path"]; ok {
+				dep.Dir = path
+			}
+		}
+
+		switch {
+		case dep.Dir != "" && !filepath.IsAbs(dep.Dir):
+			dep.Dir = filepath.Join(dir, dep.Dir)
+		case dep.Dir == "" && dep.Version == "":
+			return nil, fmt.Errorf("dependency %s needs a path or a version", name)
+		case dep.Dir == "":
+			dep.Dir = filepath.Join(dir, VendorDir, name)
+		}
+
+		m.Dependencies = append(m.Dependencies, dep)
+	}
+
+	for rule, value := range doc.tables["lint"] {
+		if value.table != nil || value.str != "true" && value.str != "false" {
+			return nil, fmt.Errorf("lint rule %s must be true or false", rule)
+		}
+		if m.Lint == nil {
+			m.Lint = map[string]bool{}
+		}
+		m.Lint[rule] = value.str == "true"
+	}
+
+	sort.Slice(m.Dependencies, func(i, j int) bool {
+		return m.Dependencies[i].Name < m.Dependencies[j].Name
+	})
+
+	return m, nil
+}
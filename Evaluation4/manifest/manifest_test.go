@@ -0,0 +1,315 @@
+package manifest
+
+import (
+	"interpreter/evaluator"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	input := `
+	# comments are skipped
+	[package]
+	name = "app"
+	version = "0.1.0" # trailing comment
+
+	[dependencies]
+	strs = { path = "../strs", version = "0.3.0" }
+	dates = "1.2.0"
+	"odd-name" = { path = "/abs/odd" }
+
+	[lint]
+	shadow = false
+	unused-let = true
+	`
+
+	m, err := Parse(input, "/work/app")
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+
+	if m.Name != "app" || m.Version != "0.1.0" || m.Entry != DefaultEntry || m.Dir != "/work/app" {
+		t.Errorf("wrong package. got=%+v", m)
+	}
+
+	expected := []Dependency{
+		{Name: "dates", Version: "1.2.0", Dir: "/work/app/vendor/dates"},
+		{Name: "odd-name", Dir: "/abs/odd"},
+		{Name: "strs", Version: "0.3.0", Dir: "/work/strs"},
+	}
+	if len(m.Dependencies) != len(expected) {
+		t.Fatalf("wrong number of dependencies. got=%+v", m.Dependencies)
+	}
+	for i, dep := range expected {
+		if m.Dependencies[i] != dep {
+			t.Errorf("dependency %d wrong. want=%+v, got=%+v", i, dep, m.Dependencies[i])
+		}
+	}
+
+	if len(m.Lint) != 2 || m.Lint["shadow"] || !m.Lint["unused-let"] {
+		t.Errorf("wrong lint rules. got=%v", m.Lint)
+	}
+
+	m, err = Parse("[package]\nname = \"a\\\"#b\\\\\" # comment\nversion = \"1\"", "/work/app")
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	if m.Name != `a"#b\` {
+		t.Errorf("wrong name with escapes. got=%q", m.Name)
+	}
+}
+
+func TestQuotedSeparators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected table
+	}{
+		{`a = { path = "a\"b,c" }`, table{"a": {table: map[string]string{"path": `a"b,c`}}}},
+		{`"k=1" = "v"`, table{"k=1": {str: "v"}}},
+		{`"k\"=" = "v=\"#" # comment`, table{`k"=`: {str: `v="#`}}},
+		{`a = { "x,=\"" = "1\\", b = "2,\"=" }`, table{"a": {table: map[string]string{`x,="`: `1\`, "b": `2,"=`}}}},
+	}
+
+	for _, tt := range tests {
+		doc, err := parseTOML(tt.input)
+		if err != nil {
+			t.Errorf("parseTOML failed for %q: %s", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(doc.tables[""], tt.expected) {
+			t.Errorf("wrong table for %q. want=%+v, got=%+v", tt.input, tt.expected, doc.tables[""])
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`name = "x"`, "missing [package] table"},
+		{"[package]\nversion = \"1\"", "missing package name"},
+		{"[package]\nname = \"a\"\nname = \"b\"", "line 3: key name defined twice"},
+		{"[package]\nname = x", `line 2: expected a quoted string, got "x"`},
+		{"[package]\nname = \"a\"\n[dependencies]\nb = {}", "dependency b needs a path or a version"},
+		{"[package]\n[package]", "line 2: table [package] defined twice"},
+		{"[package]\nname = \"a\"\n[lint]\nshadow = \"no\"", "lint rule shadow must be true or false"},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.input, "/work")
+		if err == nil || err.Error() != tt.expectedError {
+			t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, tt.expectedError, err)
+		}
+	}
+}
+
+func TestResolveAndRun(t *testing.T) {
+	root := writePackages(t, map[string]string{
+		"app/monkey.toml": `
+			[package]
+			name = "app"
+			[dependencies]
+			strs = { path = "../strs" }
+			dates = "1.2.0"`,
+		"app/vendor/dates/monkey.toml": "[package]\nname = \"dates\"\nversion = \"1.2.0\"",
+		"app/vendor/dates/lib.monkey":  `export let year = 2026;`,
+		"strs/monkey.toml":             "[package]\nname = \"strs\"\nentry = \"strs.monkey\"",
+		"strs/strs.monkey":             `import "strs/util/bang"; export let shout = func(s) { bang.bang(s) };`,
+		"strs/util/bang.monkey":        `export let bang = func(s) { s + "!" };`,
+		"app/main.monkey":              `import "strs"; import "dates" as d; [strs.shout("hi"), d.year]`,
+	})
+
+	m, err := Load(filepath.Join(root, "app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver, err := NewResolver(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		from     string
+		path     string
+		expected string
+		found    bool
+	}{
+		{"app/main.monkey", "strs", "strs/strs.monkey", true},
+		{"app/main.monkey", "strs/util/bang", "strs/util/bang", true},
+		{"app/main.monkey", "dates", "app/vendor/dates/lib.monkey", true},
+		{"app/main.monkey", "app/main", "app/main", true},
+		{"app/main.monkey", "other/x", "", false},
+		{"strs/strs.monkey", "dates", "", false},
+		{"/elsewhere/x.monkey", "strs", "", false},
+	}
+
+	for _, tt := range tests {
+		from := tt.from
+		if !filepath.IsAbs(from) {
+			from = filepath.Join(root, from)
+		}
+		resolved, found, err := resolver.Resolve(from, tt.path)
+		if err != nil {
+			t.Errorf("Resolve(%q, %q) failed: %s", tt.from, tt.path, err)
+			continue
+		}
+		expected := ""
+		if tt.expected != "" {
+			expected = filepath.Join(root, tt.expected)
+		}
+		if found != tt.found || resolved != expected {
+			t.Errorf("Resolve(%q, %q) wrong. want=%q %t, got=%q %t",
+				tt.from, tt.path, expected, tt.found, resolved, found)
+		}
+	}
+
+	if _, _, err := resolver.Resolve(filepath.Join(root, "app/main.monkey"), "strs/../../etc"); err == nil {
+		t.Errorf("expected an error for an import leaving its package")
+	}
+
+	loader := evaluator.NewModuleLoader()
+	loader.Packages = resolver
+	_, result := loader.EvalFile(filepath.Join(root, "app/main.monkey"))
+	if result == nil || result.Inspect() != "[hi!, 2026]" {
+		t.Errorf("wrong result. got=%v", result)
+	}
+}
+
+func TestResolverErrors(t *testing.T) {
+	tests := []struct {
+		files         map[string]string
+		expectedError string
+	}{
+		{
+			map[string]string{"app/monkey.toml": "[package]\nname = \"app\"\n[dependencies]\nx = \"1.0\""},
+			"app: dependency x not found in {root}/app/vendor/x",
+		},
+		{
+			map[string]string{
+				"app/monkey.toml":          "[package]\nname = \"app\"\n[dependencies]\nx = \"1.0\"",
+				"app/vendor/x/monkey.toml": "[package]\nname = \"x\"\nversion = \"2.0\"",
+			},
+			"app: dependency x wants version 1.0, {root}/app/vendor/x has 2.0",
+		},
+		{
+			map[string]string{
+				"app/monkey.toml":          "[package]\nname = \"app\"\n[dependencies]\nx = \"1.0\"",
+				"app/vendor/x/monkey.toml": "[package]\nname = \"y\"\nversion = \"1.0\"",
+			},
+			"app: dependency x in {root}/app/vendor/x is named y",
+		},
+	}
+
+	for _, tt := range tests {
+		root := writePackages(t, tt.files)
+		m, err := Load(filepath.Join(root, "app"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = NewResolver(m)
+		expected := strings.ReplaceAll(tt.expectedError, "{root}", root)
+		if err == nil || err.Error() != expected {
+			t.Errorf("wrong error. want=%q, got=%v", expected, err)
+		}
+	}
+}
+
+func TestLockfile(t *testing.T) {
+	root := writePackages(t, map[string]string{
+		"app/monkey.toml": `
+			[package]
+			name = "app"
+			[dependencies]
+			strs = { path = "../strs" }
+			dates = "1.2.0"`,
+		"app/vendor/dates/monkey.toml": "[package]\nname = \"dates\"\nversion = \"1.2.0\"",
+		"app/vendor/dates/lib.monkey":  `export let year = 2026;`,
+		"strs/monkey.toml":             "[package]\nname = \"strs\"\nversion = \"0.3.0\"",
+		"strs/lib.monkey":              `export let x = 1;`,
+	})
+	appDir := filepath.Join(root, "app")
+
+	newResolver := func() *Resolver {
+		m, err := Load(appDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewResolver(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	lock, err := newResolver().Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Write(appDir); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadLockfile(appDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Packages) != 2 {
+		t.Fatalf("wrong number of locked packages. got=%+v", read.Packages)
+	}
+	if read.Packages[0].Name != "dates" || read.Packages[0].Source != "vendor/dates" || read.Packages[0].Version != "1.2.0" {
+		t.Errorf("wrong locked package. got=%+v", read.Packages[0])
+	}
+	if read.Packages[1].Name != "strs" || read.Packages[1].Source != "../strs" {
+		t.Errorf("wrong locked package. got=%+v", read.Packages[1])
+	}
+	for i := range read.Packages {
+		if read.Packages[i] != lock.Packages[i] || !strings.HasPrefix(read.Packages[i].Hash, "sha256:") {
+			t.Errorf("lock file did not round trip. want=%+v, got=%+v", lock.Packages[i], read.Packages[i])
+		}
+	}
+
+	if err := newResolver().Verify(read); err != nil {
+		t.Errorf("fresh lock does not verify: %s", err)
+	}
+
+	// changing the root package doesn't touch the lock
+	writePackages(t, map[string]string{"app/main.monkey": "1"}, root)
+	if err := newResolver().Verify(read); err != nil {
+		t.Errorf("change to the root package broke the lock: %s", err)
+	}
+
+	writePackages(t, map[string]string{"strs/lib.monkey": "export let x = 2;"}, root)
+	err = newResolver().Verify(read)
+	if err == nil || err.Error() != "monkey.lock is out of date: strs has changed" {
+		t.Errorf("wrong error for a changed dependency. got=%v", err)
+	}
+
+	read.Packages = read.Packages[:1]
+	read.Packages = append(read.Packages, LockedPackage{Name: "gone"})
+	err = newResolver().Verify(read)
+	if err == nil || err.Error() != "monkey.lock is out of date: gone is locked but no longer a dependency, strs is not locked" {
+		t.Errorf("wrong error for changed dependencies. got=%v", err)
+	}
+}
+
+// writePackages writes files below dir, or a new temporary directory, and returns the directory
+func writePackages(t *testing.T, files map[string]string, dir ...string) string {
+	root := t.TempDir()
+	if len(dir) > 0 {
+		root = dir[0]
+	}
+	for name, source := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(strings.ReplaceAll(source, "\t", "")), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
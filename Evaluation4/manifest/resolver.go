@@ -0,0 +1,147 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Package is a manifest with its dependencies resolved
+type Package struct {
+	Manifest     *Manifest
+	Dependencies map[string]*Package
+}
+
+// Resolver maps imports of dependencies to files inside their package.
+// Every package is loaded once by name, so two dependencies on the same
+// name have to point at the same directory.
+type Resolver struct {
+	Root     *Package
+	packages map[string]*Package
+}
+
+func NewResolver(root *Manifest) (*Resolver, error) {
+	r := &Resolver{packages: map[string]*Package{}}
+
+	pkg, err := r.add(root, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Root = pkg
+
+	return r, nil
+}
+
+func (r *Resolver) add(m *Manifest, path []string) (*Package, error) {
+	if existing, ok := r.packages[m.Name]; ok {
+		if existing.Manifest.Dir != m.Dir {
+			return nil, fmt.Errorf("package %s found in both %s and %s", m.Name, existing.Manifest.Dir, m.Dir)
+		}
+		return existing, nil
+	}
+
+	pkg := &Package{Manifest: m, Dependencies: map[string]*Package{}}
+	r.packages[m.Name] = pkg
+	path = append(path, m.Name)
+
+	for _, dep := range m.Dependencies {
+		depManifest, err := loadDependency(dep)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", strings.Join(path, " -> "), err)
+		}
+		depPkg, err := r.add(depManifest, path)
+		if err != nil {
+			return nil, err
+		}
+		pkg.Dependencies[dep.Name] = depPkg
+	}
+
+	return pkg, nil
+}
+
+// a dependency without a manifest is a package with no dependencies of its own
+func loadDependency(dep Dependency) (*Manifest, error) {
+	info, err := os.Stat(dep.Dir)
+	if err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("dependency %s not found in %s", dep.Name, dep.Dir)
+	}
+
+	m, err := Load(dep.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Manifest{Name: dep.Name, Version: dep.Version, Entry: DefaultEntry, Dir: dep.Dir}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Name != dep.Name {
+		return nil, fmt.Errorf("dependency %s in %s is named %s", dep.Name, dep.Dir, m.Name)
+	}
+	if dep.Version != "" && m.Version != dep.Version {
+		return nil, fmt.Errorf("dependency %s wants version %s, %s has %s", dep.Name, dep.Version, dep.Dir, m.Version)
+	}
+	return m, nil
+}
+
+// Packages lists every package, the root included, sorted by name
+func (r *Resolver) Packages() []*Package {
+	pkgs := []*Package{}
+	for _, pkg := range r.packages {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].Manifest.Name < pkgs[j].Manifest.Name
+	})
+	return pkgs
+}
+
+// Resolve maps `import "pkg/sub"` in the file from to pkg's directory joined
+// with sub, and `import "pkg"` to pkg's entry file. pkg is a dependency of the
+// package holding from, or that package itself. found is false for any other path.
+func (r *Resolver) Resolve(from string, path string) (string, bool, error) {
+	owner := r.owner(from)
+	if owner == nil {
+		return "", false, nil
+	}
+
+	name, rest, _ := strings.Cut(path, "/")
+	dep, ok := owner.Dependencies[name]
+	if name == owner.Manifest.Name {
+		dep, ok = owner, true
+	}
+	if !ok {
+		return "", false, nil
+	}
+
+	if rest == "" {
+		return filepath.Join(dep.Manifest.Dir, dep.Manifest.Entry), true, nil
+	}
+
+	resolved := filepath.Join(dep.Manifest.Dir, rest)
+	if !within(dep.Manifest.Dir, resolved) {
+		return "", true, fmt.Errorf("import %q leaves package %s", path, name)
+	}
+	return resolved, true, nil
+}
+
+// owner is the package with the deepest directory containing file
+func (r *Resolver) owner(file string) *Package {
+	var owner *Package
+	for _, pkg := range r.packages {
+		if !within(pkg.Manifest.Dir, file) {
+			continue
+		}
+		if owner == nil || len(pkg.Manifest.Dir) > len(owner.Manifest.Dir) {
+			owner = pkg
+		}
+	}
+	return owner
+}
+
+func within(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,206 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The manifest and lock file use a small subset of TOML: [table] and
+// [[array]] headers, comments, and key = value pairs where the value is a
+// string, a boolean or an inline table of strings.
+
+type value struct {
+	str   string
+	table map[string]string
+}
+
+type table map[string]value
+
+type document struct {
+	tables map[string]table
+	arrays map[string][]table
+}
+
+func parseTOML(source string) (*document, error) {
+	doc := &document{
+		tables: map[string]table{"": {}},
+		arrays: map[string][]table{},
+	}
+	current := doc.tables[""]
+
+	for i, line := range strings.Split(source, "\n") {
+		line = strings.TrimSpace(stripComment(line))
+		lineNo := i + 1
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "[[") && strings.HasSuffix(line, "]]"):
+			name := strings.TrimSpace(line[2 : len(line)-2])
+			current = table{}
+			doc.arrays[name] = append(doc.arrays[name], current)
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if _, ok := doc.tables[name]; ok {
+				return nil, fmt.Errorf("line %d: table [%s] defined twice", lineNo, name)
+			}
+			current = table{}
+			doc.tables[name] = current
+		default:
+			key, val, err := parseKeyValue(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", lineNo, err)
+			}
+			if _, ok := current[key]; ok {
+				return nil, fmt.Errorf("line %d: key %s defined twice", lineNo, key)
+			}
+			current[key] = val
+		}
+	}
+
+	return doc, nil
+}
+
+// indexOutsideStrings is the index of the first sep in s which isn't inside a
+// string, or -1. A " escaped inside a string doesn't end it.
+func indexOutsideStrings(s string, sep rune) int {
+	inString, escaped := false, false
+	for i, ch := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case ch == '\\' && inString:
+			escaped = true
+		case ch == '"':
+			inString = !inString
+		case ch == sep && !inString:
+			return i
+		}
+	}
+	return -1
+}
+
+// a # inside a string is not a comment
+func stripComment(line string) string {
+	if i := indexOutsideStrings(line, '#'); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+func parseKeyValue(line string) (string, value, error) {
+	eq := indexOutsideStrings(line, '=')
+	if eq < 0 {
+		return "", value{}, fmt.Errorf("expected key = value, got %q", line)
+	}
+
+	key, err := parseKey(strings.TrimSpace(line[:eq]))
+	if err != nil {
+		return "", value{}, err
+	}
+
+	raw := strings.TrimSpace(line[eq+1:])
+	if strings.HasPrefix(raw, "{") {
+		t, err := parseInlineTable(raw)
+		return key, value{table: t}, err
+	}
+
+	str, err := parseScalar(raw)
+	return key, value{str: str}, err
+}
+
+func parseKey(key string) (string, error) {
+	if strings.HasPrefix(key, `"`) {
+		return parseString(key)
+	}
+	if key == "" {
+		return "", fmt.Errorf("missing key")
+	}
+	for _, ch := range key {
+		if !(ch == '_' || ch == '-' || '0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z') {
+			return "", fmt.Errorf("invalid key %q", key)
+		}
+	}
+	return key, nil
+}
+
+// booleans are kept as the strings "true" and "false"
+func parseScalar(raw string) (string, error) {
+	if raw == "true" || raw == "false" {
+		return raw, nil
+	}
+	return parseString(raw)
+}
+
+func parseString(raw string) (string, error) {
+	if len(raw) < 2 || raw[0] != '"' || raw[len(raw)-1] != '"' {
+		return "", fmt.Errorf("expected a quoted string, got %q", raw)
+	}
+
+	var out strings.Builder
+	body := raw[1 : len(raw)-1]
+	for i := 0; i < len(body); i++ {
+		ch := body[i]
+		if ch == '"' {
+			return "", fmt.Errorf("unexpected quote in %q", raw)
+		}
+		if ch != '\\' {
+			out.WriteByte(ch)
+			continue
+		}
+		i++
+		if i == len(body) {
+			return "", fmt.Errorf("unfinished escape in %q", raw)
+		}
+		switch body[i] {
+		case '\\', '"':
+			out.WriteByte(body[i])
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		default:
+			return "", fmt.Errorf("unknown escape \\%c in %q", body[i], raw)
+		}
+	}
+	return out.String(), nil
+}
+
+func parseInlineTable(raw string) (map[string]string, error) {
+	if !strings.HasSuffix(raw, "}") {
+		return nil, fmt.Errorf("unterminated inline table %q", raw)
+	}
+
+	t := map[string]string{}
+	body := strings.TrimSpace(raw[1 : len(raw)-1])
+	if body == "" {
+		return t, nil
+	}
+
+	for _, pair := range splitOutsideStrings(body, ',') {
+		key, val, err := parseKeyValue(strings.TrimSpace(pair))
+		if err != nil {
+			return nil, err
+		}
+		if val.table != nil {
+			return nil, fmt.Errorf("nested inline tables are not supported")
+		}
+		t[key] = val.str
+	}
+	return t, nil
+}
+
+func splitOutsideStrings(s string, sep rune) []string {
+	parts := []string{}
+	for i := indexOutsideStrings(s, sep); i >= 0; i = indexOutsideStrings(s, sep) {
+		parts = append(parts, s[:i])
+		s = s[i+1:]
+	}
+	return append(parts, s)
+}
+
+// quote writes s as a TOML string
+func quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -16,6 +16,21 @@ const (
 	RETURN_OBJ   = "RETURN"
 	ERROR_OBJ    = "ERROR"
 	FUNCTION_OBJ = "FUNCTION"
+	STRING_OBJ   = "STRING"
+	ARRAY_OBJ    = "ARRAY"
+	RANGE_OBJ    = "RANGE"
+
+	ERROR_VALUE_OBJ = "ERROR_VALUE"
+	BUILTIN_OBJ     = "BUILTIN"
+	STRUCT_OBJ      = "STRUCT"
+	INSTANCE_OBJ    = "INSTANCE"
+	METHOD_OBJ      = "METHOD"
+	ENUM_OBJ        = "ENUM"
+	CONSTRUCTOR_OBJ = "CONSTRUCTOR"
+	VARIANT_OBJ     = "VARIANT"
+	MODULE_OBJ      = "MODULE"
+	QUOTE_OBJ       = "QUOTE"
+	MACRO_OBJ       = "MACRO"
 )
 
 type Object interface {
@@ -49,13 +64,35 @@ type Return struct {
 func (r *Return) Type() ObjectType { return RETURN_OBJ }
 func (r *Return) Inspect() string  { return r.Value.Inspect() }
 
+// Error unwinds evaluation until it is caught by a try expression or reaches the top.
+// Stack holds the calls it passed through, innermost first.
 type Error struct {
 	Message string
+	Kind    string
+	Stack   []string
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
+// ErrorValue is an Error held as a plain value, either caught by a catch block
+// or created by the error builtin. It only unwinds again once it is thrown.
+type ErrorValue struct {
+	Error *Error
+}
+
+func (ev *ErrorValue) Type() ObjectType { return ERROR_VALUE_OBJ }
+func (ev *ErrorValue) Inspect() string  { return ev.Error.Kind + ": " + ev.Error.Message }
+
+type BuiltinFunction func(args ...Object) Object
+
+type Builtin struct {
+	Fn BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin function" }
+
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.StatementBlock
@@ -81,9 +118,276 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// Range is lazy, only the bounds are stored and elements are computed on demand
+type Range struct {
+	Start     int64
+	End       int64
+	Inclusive bool
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string {
+	if r.Inclusive {
+		return fmt.Sprintf("%d..=%d", r.Start, r.End)
+	}
+	return fmt.Sprintf("%d..%d", r.Start, r.End)
+}
+
+// Len is the number of integers in the range, empty ranges have a length of 0.
+// The evaluator only makes ranges whose length fits in an int64.
+func (r *Range) Len() int64 {
+	n := r.End - r.Start
+	if r.Inclusive {
+		n++
+	}
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// ApplyMethod calls a method with its receiver. The evaluator sets it, it lets
+// Inspect dispatch to a user defined __str__ method.
+var ApplyMethod func(method *Function, receiver Object, args ...Object) Object
+
+// Struct is the type created by a struct or type declaration, Fields are in declaration order
+type Struct struct {
+	Name    string
+	Fields  []string
+	Methods map[string]*Function
+}
+
+func (s *Struct) Type() ObjectType { return STRUCT_OBJ }
+func (s *Struct) Inspect() string {
+	return "struct " + s.Name + " { " + strings.Join(s.Fields, ", ") + " }"
+}
+
+func (s *Struct) HasField(name string) bool {
+	for _, f := range s.Fields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Instance is a value of a user defined struct, every field of the struct is in Fields
+type Instance struct {
+	Struct *Struct
+	Fields map[string]Object
+}
+
+func (i *Instance) Type() ObjectType { return INSTANCE_OBJ }
+func (i *Instance) Inspect() string {
+	switch str := i.Str().(type) {
+	case *String:
+		return str.Value
+	case *Error:
+		return str.Inspect()
+	}
+
+	var out bytes.Buffer
+
+	fields := []string{}
+	for _, f := range i.Struct.Fields {
+		fields = append(fields, f+": "+i.Fields[f].Inspect())
+	}
+
+	out.WriteString(i.Struct.Name)
+	out.WriteString("{")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// Str calls the __str__ method of i. It is nil without one and an error if
+// the method fails or returns something other than a string.
+func (i *Instance) Str() Object {
+	method, ok := i.Struct.Methods["__str__"]
+	if !ok || ApplyMethod == nil {
+		return nil
+	}
+	str := ApplyMethod(method, i)
+	switch str.(type) {
+	case *String, *Error:
+		return str
+	}
+	got := ObjectType(NULL_OBJ)
+	if str != nil {
+		got = str.Type()
+	}
+	return &Error{Message: fmt.Sprintf("__str__ must return STRING, got %s", got), Kind: "RuntimeError"}
+}
+
+// BoundMethod is a method looked up on an instance, calling it passes Receiver as the first argument
+type BoundMethod struct {
+	Receiver Object
+	Method   *Function
+}
+
+func (bm *BoundMethod) Type() ObjectType { return METHOD_OBJ }
+func (bm *BoundMethod) Inspect() string  { return bm.Method.Inspect() }
+
+// Enum is the type created by an enum declaration, Variants are in declaration order
+type Enum struct {
+	Name     string
+	Variants []*EnumVariant
+}
+
+func (e *Enum) Type() ObjectType { return ENUM_OBJ }
+func (e *Enum) Inspect() string {
+	variants := []string{}
+	for _, v := range e.Variants {
+		variants = append(variants, v.Inspect())
+	}
+	return "enum " + e.Name + " { " + strings.Join(variants, ", ") + " }"
+}
+
+func (e *Enum) Variant(name string) (*EnumVariant, bool) {
+	for _, v := range e.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// EnumVariant is one case of an enum. With Constructor set it is called with
+// one argument per field to build a Variant, otherwise Value is its only value.
+type EnumVariant struct {
+	Enum        *Enum
+	Name        string
+	Fields      []string
+	Constructor bool
+	Value       *Variant
+}
+
+func (ev *EnumVariant) Type() ObjectType { return CONSTRUCTOR_OBJ }
+func (ev *EnumVariant) Inspect() string {
+	if !ev.Constructor {
+		return ev.Name
+	}
+	return ev.Name + "(" + strings.Join(ev.Fields, ", ") + ")"
+}
+
+// Variant is a tagged enum value, Values line up with the fields of its EnumVariant
+type Variant struct {
+	Variant *EnumVariant
+	Values  []Object
+}
+
+func (v *Variant) Type() ObjectType { return VARIANT_OBJ }
+func (v *Variant) Inspect() string {
+	name := v.Variant.Enum.Name + "." + v.Variant.Name
+	if !v.Variant.Constructor {
+		return name
+	}
+
+	values := []string{}
+	for _, val := range v.Values {
+		values = append(values, val.Inspect())
+	}
+	return name + "(" + strings.Join(values, ", ") + ")"
+}
+
+// Quote holds an unevaluated AST node
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string  { return "QUOTE(" + q.Node.String() + ")" }
+
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.StatementBlock
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("macro")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// ModuleLoader resolves and evaluates the files named by import statements
+type ModuleLoader interface {
+	Import(from *Module, path string) Object
+}
+
+// Module is a file evaluated into its own environment, importers only see
+// the names it exports
+type Module struct {
+	Name    string
+	Path    string
+	Env     *Environment
+	Exports map[string]bool
+	Loader  ModuleLoader
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "module " + m.Name + " (" + m.Path + ")" }
+
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store  map[string]Object
+	outer  *Environment
+	module *Module
+}
+
+// NewModuleEnvironment is the top level environment of a module
+func NewModuleEnvironment(module *Module) *Environment {
+	env := NewEnvironment()
+	env.module = module
+	return env
+}
+
+// Module is the module the environment was created in, nil when it isn't part of one
+func (e *Environment) Module() *Module {
+	if e.module == nil && e.outer != nil {
+		return e.outer.Module()
+	}
+	return e.module
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
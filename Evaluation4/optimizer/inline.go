@@ -0,0 +1,283 @@
+package optimizer
+
+import (
+	"interpreter/ast"
+	"interpreter/resolver"
+	"interpreter/token"
+)
+
+// A function is inlined when its let is a statement of the program or of a
+// function body, so it has run before any call after it, its name is declared
+// once in that scope, and its body is a single small expression of literals,
+// names, operators, calls, indexes, arrays and members. Every parameter has to
+// be used, and the arguments of an inlined call have to be literals or names,
+// so what the call evaluated is still evaluated by the body.
+type candidate struct {
+	let *ast.LetStatement
+	// body is the expression the function returns
+	body ast.Expression
+	// params are the declarations of the parameters, by position
+	params []*resolver.Declaration
+}
+
+// inlineSize is how many nodes the body of an inlined function can have
+const inlineSize = 12
+
+type inliner struct {
+	table      *resolver.Table
+	candidates map[*resolver.Declaration]*candidate
+	// the body each call found is replaced with
+	calls map[*ast.CallExpression]ast.Expression
+	// scopes around the node being visited
+	scopes []*resolver.Scope
+}
+
+func inline(program ast.Node, table *resolver.Table) ast.Node {
+	in := &inliner{
+		table:      table,
+		candidates: map[*resolver.Declaration]*candidate{},
+		calls:      map[*ast.CallExpression]ast.Expression{},
+	}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Program:
+			in.findCandidates(node.Statements)
+		case *ast.FunctionLiteral:
+			in.findCandidates(node.Body.Statements)
+		}
+		return true
+	})
+	if len(in.candidates) == 0 {
+		return program
+	}
+
+	ast.Walk(in, program)
+	return ast.Modify(program, func(node ast.Node) ast.Node {
+		if call, ok := node.(*ast.CallExpression); ok && in.calls[call] != nil {
+			return in.calls[call]
+		}
+		return node
+	})
+}
+
+func (in *inliner) findCandidates(statements []ast.Statement) {
+	for _, stmt := range statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			stmt = export.Statement
+		}
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok {
+			continue
+		}
+		fn, ok := let.Value.(*ast.FunctionLiteral)
+		decl := in.table.Declarations[let.Name]
+		if !ok || decl == nil || decl.Scope.Names[decl.Name] != decl || in.redeclared(decl) {
+			continue
+		}
+		if c := in.candidate(let, fn, decl); c != nil {
+			in.candidates[decl] = c
+		}
+	}
+}
+
+// redeclared reports whether another let in the scope of decl has its name
+func (in *inliner) redeclared(decl *resolver.Declaration) bool {
+	for _, other := range in.table.Declarations {
+		if other != decl && other.Scope == decl.Scope && other.Name == decl.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (in *inliner) candidate(let *ast.LetStatement, fn *ast.FunctionLiteral, decl *resolver.Declaration) *candidate {
+	if fn.Body == nil || len(fn.Body.Statements) != 1 {
+		return nil
+	}
+	var body ast.Expression
+	switch stmt := fn.Body.Statements[0].(type) {
+	case *ast.ExpressionStatement:
+		body = stmt.Expression
+	case *ast.ReturnStatement:
+		body = stmt.Value
+	}
+	if body == nil || !simple(body) {
+		return nil
+	}
+
+	size, recursive := 0, false
+	ast.Inspect(body, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok && in.table.Uses[ident].Declaration == decl {
+			recursive = true
+		}
+		if node != nil {
+			size++
+		}
+		return true
+	})
+	if recursive || size > inlineSize {
+		return nil
+	}
+
+	c := &candidate{let: let, body: body}
+	for _, param := range fn.Parameters {
+		p := in.table.Declarations[param]
+		if p == nil || len(p.Uses) == 0 {
+			return nil
+		}
+		c.params = append(c.params, p)
+	}
+	return c
+}
+
+// simple reports whether expr only has the nodes an inlined body can have
+func simple(expr ast.Expression) bool {
+	ok := true
+	ast.Inspect(expr, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case nil, *ast.IntegerLiteral, *ast.StringLiteral, *ast.BooleanExpression, *ast.Identifier,
+			*ast.PrefixExpression, *ast.IndexExpression, *ast.ArrayLiteral, *ast.MemberExpression:
+		case *ast.InfixExpression:
+			// declared operators are looked up where they are used
+			ok = ok && node.Token.Type != token.OPERATOR
+		case *ast.CallExpression:
+			lexeme := node.Function.TokenLexeme()
+			ok = ok && lexeme != "quote" && lexeme != "unquote"
+		default:
+			ok = false
+		}
+		return ok
+	})
+	return ok
+}
+
+// Visit finds the calls to inline, keeping track of the scope they are in
+func (in *inliner) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		in.scopes = in.scopes[:len(in.scopes)-1]
+		return nil
+	}
+	call, ok := node.(*ast.CallExpression)
+	if ok && call.Function.TokenLexeme() == "quote" {
+		return nil
+	}
+
+	scope := in.table.Scopes[node]
+	if scope == nil {
+		scope = in.scopes[len(in.scopes)-1]
+	}
+	in.scopes = append(in.scopes, scope)
+	if ok {
+		if body := in.inlined(call, scope); body != nil {
+			in.calls[call] = body
+		}
+	}
+	return in
+}
+
+// inlined is the body call is replaced with, or nil if it can't be
+func (in *inliner) inlined(call *ast.CallExpression, scope *resolver.Scope) ast.Expression {
+	name, ok := call.Function.(*ast.Identifier)
+	if !ok || call.Optional {
+		return nil
+	}
+	c := in.candidates[in.table.Uses[name].Declaration]
+	if c == nil || len(call.Arguments) != len(c.params) || !after(call.Token, c.let.Token) {
+		return nil
+	}
+
+	args := map[*resolver.Declaration]ast.Expression{}
+	for i, arg := range call.Arguments {
+		switch arg := arg.(type) {
+		case *ast.IntegerLiteral, *ast.StringLiteral, *ast.BooleanExpression:
+		case *ast.Identifier:
+			if _, ok := in.table.Uses[arg]; !ok {
+				return nil
+			}
+		default:
+			return nil
+		}
+		args[c.params[i]] = arg
+	}
+
+	// the other names of the body have to mean the same at the call
+	free := true
+	ast.Inspect(c.body, func(node ast.Node) bool {
+		ident, ok := node.(*ast.Identifier)
+		if !ok {
+			return true
+		}
+		binding, used := in.table.Uses[ident]
+		if used && args[binding.Declaration] == nil && lookup(ident.Value, scope) != binding.Declaration {
+			free = false
+		}
+		return true
+	})
+	if !free {
+		return nil
+	}
+	return in.clone(c.body, args)
+}
+
+// after reports whether a comes later in the source than b
+func after(a, b token.Token) bool {
+	return a.Line > b.Line || a.Line == b.Line && a.Column > b.Column
+}
+
+// lookup finds the declaration name refers to in scope, nil for builtins and
+// names declared before the program
+func lookup(name string, scope *resolver.Scope) *resolver.Declaration {
+	for s := scope; s != nil; s = s.Parent {
+		if decl, ok := s.Names[name]; ok {
+			return decl
+		}
+	}
+	return nil
+}
+
+// clone copies a body made of the nodes simple allows, with the parameters
+// replaced by args
+func (in *inliner) clone(expr ast.Expression, args map[*resolver.Declaration]ast.Expression) ast.Expression {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		if binding, ok := in.table.Uses[expr]; ok && args[binding.Declaration] != nil {
+			return in.clone(args[binding.Declaration], nil)
+		}
+		ident := *expr
+		return &ident
+	case *ast.IntegerLiteral:
+		lit := *expr
+		return &lit
+	case *ast.StringLiteral:
+		lit := *expr
+		return &lit
+	case *ast.BooleanExpression:
+		lit := *expr
+		return &lit
+	case *ast.PrefixExpression:
+		return &ast.PrefixExpression{Token: expr.Token, Op: expr.Op, Value: in.clone(expr.Value, args)}
+	case *ast.InfixExpression:
+		return &ast.InfixExpression{Token: expr.Token, Op: expr.Op,
+			Left: in.clone(expr.Left, args), Right: in.clone(expr.Right, args)}
+	case *ast.CallExpression:
+		call := &ast.CallExpression{Token: expr.Token, Function: in.clone(expr.Function, args), Optional: expr.Optional}
+		for _, arg := range expr.Arguments {
+			call.Arguments = append(call.Arguments, in.clone(arg, args))
+		}
+		return call
+	case *ast.IndexExpression:
+		return &ast.IndexExpression{Token: expr.Token, Left: in.clone(expr.Left, args),
+			Index: in.clone(expr.Index, args), Optional: expr.Optional}
+	case *ast.ArrayLiteral:
+		array := &ast.ArrayLiteral{Token: expr.Token, Elements: []ast.Expression{}}
+		for _, element := range expr.Elements {
+			array.Elements = append(array.Elements, in.clone(element, args))
+		}
+		return array
+	case *ast.MemberExpression:
+		return &ast.MemberExpression{Token: expr.Token, Object: in.clone(expr.Object, args),
+			Member: expr.Member, Optional: expr.Optional}
+	}
+	return expr
+}
@@ -0,0 +1,321 @@
+// Package optimizer rewrites a program, whose names are resolved, into a
+// simpler one that evaluates to the same values. It runs these passes in order:
+//
+//   - inline replaces calls of small functions bound by let with their body
+//   - fold computes operators on integer, string and boolean literals
+//   - branches removes the branch an if with a literal condition never takes
+//   - unreachable drops the statements after a return or throw
+//
+// Each pass can be turned off by name. A call that was inlined no longer shows
+// up in the stack of an error raised by its body.
+package optimizer
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/resolver"
+	"interpreter/token"
+	"strconv"
+)
+
+const (
+	Inline      = "inline"
+	Fold        = "fold"
+	Branches    = "branches"
+	Unreachable = "unreachable"
+)
+
+// Passes lists every pass in the order they run, all of them are on unless
+// configured otherwise.
+var Passes = []string{Inline, Fold, Branches, Unreachable}
+
+// Config says which passes run.
+type Config struct {
+	// Passes turns passes on and off by name, passes it doesn't name are on
+	Passes map[string]bool
+	// Extended reports the infix operators given a new meaning by an extension
+	// of the evaluator, which are not folded
+	Extended func(op string) bool
+}
+
+func (c Config) enabled(pass string) bool {
+	on, ok := c.Passes[pass]
+	return !ok || on
+}
+
+// Only is the config running just the passes named.
+func Only(names ...string) (Config, error) {
+	config := Config{Passes: map[string]bool{}}
+	for _, pass := range Passes {
+		config.Passes[pass] = false
+	}
+	for _, name := range names {
+		if _, ok := config.Passes[name]; !ok {
+			return Config{}, fmt.Errorf("unknown optimizer pass %s", name)
+		}
+		config.Passes[name] = true
+	}
+	return config, nil
+}
+
+// Optimize runs the passes config turns on over program, which table resolved,
+// and returns the rewritten program. The table doesn't describe the code the
+// passes made up.
+func Optimize(program ast.Node, table *resolver.Table, config Config) ast.Node {
+	if config.enabled(Inline) {
+		program = inline(program, table)
+	}
+	if config.enabled(Fold) {
+		program = fold(program, config.Extended)
+	}
+	if config.enabled(Branches) {
+		program = ast.Modify(program, removeBranches)
+	}
+	if config.enabled(Unreachable) {
+		program = ast.Modify(program, removeUnreachable)
+	}
+	return program
+}
+
+// quoted finds the code given to quote, which is data and left as it is
+func quoted(program ast.Node) map[ast.Node]bool {
+	nodes := map[ast.Node]bool{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if call, ok := node.(*ast.CallExpression); ok && call.Function.TokenLexeme() == "quote" {
+			ast.Inspect(call, func(child ast.Node) bool {
+				nodes[child] = true
+				return true
+			})
+			return false
+		}
+		return true
+	})
+	return nodes
+}
+
+func fold(program ast.Node, extended func(op string) bool) ast.Node {
+	skip := quoted(program)
+	return ast.Modify(program, func(node ast.Node) ast.Node {
+		if skip[node] {
+			return node
+		}
+		switch node := node.(type) {
+		case *ast.PrefixExpression:
+			if folded := foldPrefix(node); folded != nil {
+				return folded
+			}
+		case *ast.InfixExpression:
+			if node.Token.Type == token.OPERATOR || extended != nil && extended(node.Op) {
+				break
+			}
+			if folded := foldInfix(node); folded != nil {
+				return folded
+			}
+		}
+		return node
+	})
+}
+
+// foldPrefix follows evaluatePrefixExpression, it is nil for what that
+// doesn't compute from literals
+func foldPrefix(expr *ast.PrefixExpression) ast.Expression {
+	switch value := expr.Value.(type) {
+	case *ast.IntegerLiteral:
+		if expr.Op == "-" {
+			return integer(expr.Token, -value.Value)
+		}
+		if expr.Op == "!" {
+			return boolean(expr.Token, false)
+		}
+	case *ast.StringLiteral:
+		if expr.Op == "!" {
+			return boolean(expr.Token, false)
+		}
+	case *ast.BooleanExpression:
+		if expr.Op == "!" {
+			return boolean(expr.Token, !value.Value)
+		}
+	}
+	return nil
+}
+
+// foldInfix follows evaluateInfixExpression, it is nil for errors and for
+// what that doesn't compute from literals
+func foldInfix(expr *ast.InfixExpression) ast.Expression {
+	tok := leftmost(expr)
+	switch left := expr.Left.(type) {
+	case *ast.IntegerLiteral:
+		right, ok := expr.Right.(*ast.IntegerLiteral)
+		if !ok {
+			return nil
+		}
+		l, r := left.Value, right.Value
+		switch expr.Op {
+		case "+":
+			return integer(tok, l+r)
+		case "-":
+			return integer(tok, l-r)
+		case "*":
+			return integer(tok, l*r)
+		case "/":
+			if r != 0 {
+				return integer(tok, l/r)
+			}
+		case "<":
+			return boolean(tok, l < r)
+		case ">":
+			return boolean(tok, l > r)
+		case "==":
+			return boolean(tok, l == r)
+		case "!=":
+			return boolean(tok, l != r)
+		}
+	case *ast.StringLiteral:
+		right, ok := expr.Right.(*ast.StringLiteral)
+		if !ok {
+			return nil
+		}
+		switch expr.Op {
+		case "+":
+			return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Lexeme: left.Value + right.Value,
+				Line: tok.Line, Column: tok.Column}, Value: left.Value + right.Value}
+		case "==":
+			return boolean(tok, left.Value == right.Value)
+		case "!=":
+			return boolean(tok, left.Value != right.Value)
+		}
+	case *ast.BooleanExpression:
+		right, ok := expr.Right.(*ast.BooleanExpression)
+		if !ok {
+			return nil
+		}
+		switch expr.Op {
+		case "==":
+			return boolean(tok, left.Value == right.Value)
+		case "!=":
+			return boolean(tok, left.Value != right.Value)
+		}
+	}
+	return nil
+}
+
+// leftmost is the token a folded infix expression starts at
+func leftmost(expr *ast.InfixExpression) token.Token {
+	switch left := expr.Left.(type) {
+	case *ast.IntegerLiteral:
+		return left.Token
+	case *ast.StringLiteral:
+		return left.Token
+	case *ast.BooleanExpression:
+		return left.Token
+	}
+	return expr.Token
+}
+
+func integer(at token.Token, value int64) *ast.IntegerLiteral {
+	lexeme := strconv.FormatInt(value, 10)
+	return &ast.IntegerLiteral{Token: token.Token{Type: token.DIGIT, Lexeme: lexeme, Line: at.Line, Column: at.Column}, Value: value}
+}
+
+func boolean(at token.Token, value bool) *ast.BooleanExpression {
+	tok := token.Token{Type: token.FALSE, Lexeme: "false", Line: at.Line, Column: at.Column}
+	if value {
+		tok.Type, tok.Lexeme = token.TRUE, "true"
+	}
+	return &ast.BooleanExpression{Token: tok, Value: value}
+}
+
+// literal reports whether expr is a literal and whether it is truthy, like
+// isTruthy in the evaluator where only false and null aren't
+func literal(expr ast.Expression) (truthy bool, ok bool) {
+	switch expr := expr.(type) {
+	case *ast.BooleanExpression:
+		return expr.Value, true
+	case *ast.IntegerLiteral, *ast.StringLiteral:
+		return true, true
+	}
+	return false, false
+}
+
+// taken is the branch an if with a literal condition runs, nil when it runs
+// neither
+func taken(expr *ast.IfExpression) (block *ast.StatementBlock, ok bool) {
+	truthy, ok := literal(expr.Condition)
+	if !ok {
+		return nil, false
+	}
+	if truthy {
+		return expr.Consequence, true
+	}
+	return expr.Alternative, true
+}
+
+// removeBranches puts the statements of the branch taken in place of an if
+// statement, which is possible since an if block has no scope of its own. An
+// if whose value is used is only replaced by a branch holding one expression.
+func removeBranches(node ast.Node) ast.Node {
+	switch node := node.(type) {
+	case *ast.Program:
+		node.Statements = spliceBranches(node.Statements)
+	case *ast.StatementBlock:
+		node.Statements = spliceBranches(node.Statements)
+	case *ast.IfExpression:
+		block, ok := taken(node)
+		if !ok || block == nil || len(block.Statements) != 1 {
+			break
+		}
+		if stmt, ok := block.Statements[0].(*ast.ExpressionStatement); ok {
+			return stmt.Expression
+		}
+	}
+	return node
+}
+
+// spliceBranches keeps the last statement unless the branch taken ends with a
+// statement, since an empty branch has no value and a missing one is null
+func spliceBranches(statements []ast.Statement) []ast.Statement {
+	result := []ast.Statement{}
+	for i, stmt := range statements {
+		expr, ok := stmt.(*ast.ExpressionStatement)
+		var ifExpr *ast.IfExpression
+		if ok {
+			ifExpr, ok = expr.Expression.(*ast.IfExpression)
+		}
+		var block *ast.StatementBlock
+		if ok {
+			block, ok = taken(ifExpr)
+		}
+		last := i == len(statements)-1
+		if ok && last && (block == nil || len(block.Statements) == 0) {
+			ok = false
+		}
+		if !ok {
+			result = append(result, stmt)
+			continue
+		}
+		if block != nil {
+			result = append(result, block.Statements...)
+		}
+	}
+	return result
+}
+
+func removeUnreachable(node ast.Node) ast.Node {
+	switch node := node.(type) {
+	case *ast.Program:
+		node.Statements = reachable(node.Statements)
+	case *ast.StatementBlock:
+		node.Statements = reachable(node.Statements)
+	}
+	return node
+}
+
+func reachable(statements []ast.Statement) []ast.Statement {
+	for i, stmt := range statements {
+		switch stmt.(type) {
+		case *ast.ReturnStatement, *ast.ThrowStatement:
+			return statements[:i+1]
+		}
+	}
+	return statements
+}
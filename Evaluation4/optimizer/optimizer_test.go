@@ -0,0 +1,117 @@
+package optimizer
+
+import (
+	"interpreter/format"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"interpreter/resolver"
+	"testing"
+)
+
+func optimize(t *testing.T, input string, config Config) string {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	table := resolver.Resolve(program, func(name string) bool { return name == "len" || name == "puts" }, nil)
+	if len(table.Errors) != 0 {
+		t.Fatalf("resolver errors for %q: %v", input, table.Errors)
+	}
+	return format.Node(Optimize(program, table, config), format.Config{})
+}
+
+func TestPasses(t *testing.T) {
+	tests := []struct {
+		pass     string
+		input    string
+		expected string
+	}{
+		{Fold, "1 + 2 * 3", "7"},
+		{Fold, "-(4 / 2) < 0", "true"},
+		{Fold, "\"a\" + \"b\" == \"ab\"", "true"},
+		{Fold, "!true != !0", "false"},
+		{Fold, "1 / 0", "1 / 0"},
+		{Fold, "1 + \"a\"; true + true", "1 + \"a\";\ntrue + true"},
+		{Fold, "let x = 1; x + 2 * 3", "let x = 1;\nx + 6"},
+		{Fold, "infixl 6 <+> = func(a, b) { a }; 1 <+> 2", "infixl 6 <+> = func(a, b) { a };\n1 <+> 2"},
+		{Fold, "quote(1 + 2)", "quote(1 + 2)"},
+		{Branches, "if (true) { 1 } else { 2 }", "1"},
+		{Branches, "if (0) { let a = 1; a } else { 2 }", "let a = 1;\na"},
+		{Branches, "if (false) { 1 }; 2", "2"},
+		{Branches, "if (false) { 1 }", "if (false) { 1 }"},
+		{Branches, "let x = if (false) { 1 } else { 2 }", "let x = 2;"},
+		{Branches, "let x = if (true) { let y = 1; y }", "let x = if (true) {\n    let y = 1;\n    y\n};"},
+		{Branches, "let a = 1; if (a) { 1 } else { 2 }", "let a = 1;\nif (a) { 1 } else { 2 }"},
+		{Unreachable, "func() { return 1; puts(2); 3 }", "func() { return 1; }"},
+		{Unreachable, "throw \"e\"; 1", "throw \"e\";"},
+		{Inline, "let sq = func(x) { x * x }; sq(3)", "let sq = func(x) { x * x };\n3 * 3"},
+		{Inline, "let add = func(a, b) { return a + b }; let n = 1; add(n, 2)",
+			"let add = func(a, b) { return a + b; };\nlet n = 1;\nn + 2"},
+		// recursive, a call before the let, an argument that isn't a literal
+		// or a name, and an unused parameter
+		{Inline, "let f = func(n) { f(n) }; f(1)", "let f = func(n) { f(n) };\nf(1)"},
+		{Inline, "let g = func() { f(1) }; let f = func(x) { x };", "let g = func() { f(1) };\nlet f = func(x) { x };"},
+		{Inline, "let f = func(x) { x }; f(puts(1))", "let f = func(x) { x };\nf(puts(1))"},
+		{Inline, "let f = func(x) { 1 }; f(2)", "let f = func(x) { 1 };\nf(2)"},
+		// a name of the body means something else at the call
+		{Inline, "let a = 1; let f = func(x) { x + a }; let g = func(a) { f(a) };",
+			"let a = 1;\nlet f = func(x) { x + a };\nlet g = func(a) { f(a) };"},
+		{Inline, "let a = 1; let f = func(x) { x + a }; let g = func(b) { f(b) };",
+			"let a = 1;\nlet f = func(x) { x + a };\nlet g = func(b) { b + a };"},
+		{Inline, "let f = func(x) { x }; let f = func(x) { 2 * x }; f(1)",
+			"let f = func(x) { x };\nlet f = func(x) { 2 * x };\nf(1)"},
+		{Inline, "if (true) { let f = func(x) { x } }; f(1)", "if (true) { let f = func(x) { x }; }\nf(1)"},
+	}
+
+	for _, tt := range tests {
+		config, err := Only(tt.pass)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := optimize(t, tt.input, config); got != tt.expected {
+			t.Errorf("wrong %s of %q.\nexpected=%q\ngot=%q", tt.pass, tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	input := `let sq = func(x) { x * x }; if (sq(3) > 5) { return "big"; puts("unreachable") } else { "small" }`
+
+	tests := []struct {
+		passes   map[string]bool
+		expected string
+	}{
+		{nil, "let sq = func(x) { x * x };\nreturn \"big\";"},
+		{map[string]bool{Unreachable: false}, "let sq = func(x) { x * x };\nreturn \"big\";\nputs(\"unreachable\")"},
+		{map[string]bool{Inline: false}, "let sq = func(x) { x * x };\nif (sq(3) > 5) { return \"big\"; } else { \"small\" }"},
+	}
+
+	for _, tt := range tests {
+		if got := optimize(t, input, Config{Passes: tt.passes}); got != tt.expected {
+			t.Errorf("wrong result with %v.\nexpected=%q\ngot=%q", tt.passes, tt.expected, got)
+		}
+	}
+}
+
+func TestExtendedOperators(t *testing.T) {
+	config := Config{Extended: func(op string) bool { return op == "+" }}
+	if got := optimize(t, "1 + 2; 2 * 3", config); got != "1 + 2;\n6" {
+		t.Errorf("extended operators should not be folded. got=%q", got)
+	}
+}
+
+func TestOnly(t *testing.T) {
+	config, err := Only(Fold, Inline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pass := range Passes {
+		if expected := pass == Fold || pass == Inline; config.enabled(pass) != expected {
+			t.Errorf("pass %s enabled=%t, expected %t", pass, config.enabled(pass), expected)
+		}
+	}
+	if _, err := Only("fold", "nope"); err == nil || err.Error() != "unknown optimizer pass nope" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
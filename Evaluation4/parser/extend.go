@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/token"
+)
+
+// PrefixParseFn parses an expression that starts with the current token.
+type PrefixParseFn func(p *Parser) ast.Expression
+
+// InfixParseFn parses an expression whose current token follows left.
+type InfixParseFn func(p *Parser, left ast.Expression) ast.Expression
+
+// grammar extensions registered by the embedder, copied into every new Parser
+var (
+	extensionPrefixes    = map[token.TokenType]PrefixParseFn{}
+	extensionInfixes     = map[token.TokenType]InfixParseFn{}
+	extensionPrecedences = map[token.TokenType]int{}
+)
+
+// RegisterPrefix installs fn for expressions starting with tokenType in every
+// parser created afterwards. Registrations take priority over the built in
+// grammar; registering the same token twice panics.
+func RegisterPrefix(tokenType token.TokenType, fn PrefixParseFn) {
+	if _, found := extensionPrefixes[tokenType]; found {
+		panic(fmt.Sprintf("parser: prefix %s already registered", tokenType))
+	}
+	extensionPrefixes[tokenType] = fn
+}
+
+// RegisterInfix installs fn for tokenType used as an infix operator binding at
+// precedence, one of the precedence constants (EQUALS, SUM, ...). Plain binary
+// operators can pass (*Parser).ParseInfixExpression as fn.
+func RegisterInfix(tokenType token.TokenType, precedence int, fn InfixParseFn) {
+	if _, found := extensionInfixes[tokenType]; found {
+		panic(fmt.Sprintf("parser: infix %s already registered", tokenType))
+	}
+	extensionInfixes[tokenType] = fn
+	extensionPrecedences[tokenType] = precedence
+}
+
+// Precedence returns how tightly tokenType binds as an infix operator, or NONE.
+// Operators a script declares with infixl/infixr are covered by
+// DeclaredPrecedence instead.
+func Precedence(tokenType token.TokenType) int {
+	if precedence, ok := extensionPrecedences[tokenType]; ok {
+		return precedence
+	}
+	if precedence, ok := defaultPrecedences[tokenType]; ok {
+		return precedence
+	}
+	return NONE
+}
+
+// DeclaredPrecedence returns the precedence of an operator declared at level,
+// so that `infixl 6` binds like + and `infixl 7` like *.
+func DeclaredPrecedence(level int64) int {
+	return SUM + int(level) - 6
+}
+
+func (parser *Parser) addExtensions() {
+	for tokenType, fn := range extensionPrefixes {
+		fn := fn
+		parser.addPrefixToken(tokenType, func() ast.Expression { return fn(parser) })
+	}
+	for tokenType, fn := range extensionInfixes {
+		fn := fn
+		parser.addInfixToken(tokenType, func(left ast.Expression) ast.Expression { return fn(parser, left) })
+		parser.precedences[tokenType] = extensionPrecedences[tokenType]
+	}
+}
+
+// The methods below are the parser's cursor as seen by registered parse
+// functions. Like the built in ones, a parse function starts on its first
+// token and must leave the parser on the last token it consumed.
+
+// CurrentToken returns the token being parsed.
+func (parser *Parser) CurrentToken() token.Token {
+	return parser.currentToken
+}
+
+// NextToken returns the token after the current one without consuming it.
+func (parser *Parser) NextToken() token.Token {
+	return parser.nextToken
+}
+
+// Advance moves on to the next token.
+func (parser *Parser) Advance() {
+	parser.getToken()
+}
+
+// Expect advances if the next token has type tokenType, and records an error
+// and returns false otherwise.
+func (parser *Parser) Expect(tokenType token.TokenType) bool {
+	return parser.expect(tokenType)
+}
+
+// ParseExpression parses an expression starting at the current token, stopping
+// before any operator that binds no tighter than precedence.
+func (parser *Parser) ParseExpression(precedence int) ast.Expression {
+	return parser.parseExpression(precedence)
+}
+
+// ParseInfixExpression parses the right operand of the current operator token
+// and returns an *ast.InfixExpression whose Op is the operator's lexeme.
+func (parser *Parser) ParseInfixExpression(left ast.Expression) ast.Expression {
+	return parser.parseInfixExpression(left)
+}
+
+// Errorf records a parse error.
+func (parser *Parser) Errorf(format string, args ...interface{}) {
+	parser.errors = append(parser.errors, fmt.Sprintf(format, args...))
+}
@@ -11,24 +11,36 @@ import (
 const (
 	_ int = iota
 	NONE
+	ASSIGN        // p.x = 1
+	COALESCE      // a ?? b
+	RANGE         // 1..10
 	EQUALS        // ==
 	LESSERGREATER // < or >
 	SUM           // +
 	MULT          // *
 	PREFIX        // !<condition>
 	CALL          //function call
+	INDEX         // arr[1]
 )
 
-var precedences = map[token.TokenType]int{
-	token.EQ:     EQUALS,
-	token.NEQ:    EQUALS,
-	token.LT:     LESSERGREATER,
-	token.GT:     LESSERGREATER,
-	token.PLUS:   SUM,
-	token.MINUS:  SUM,
-	token.DIV:    MULT,
-	token.MULT:   MULT,
-	token.LPAREN: CALL,
+var defaultPrecedences = map[token.TokenType]int{
+	token.EQ:        EQUALS,
+	token.NEQ:       EQUALS,
+	token.LT:        LESSERGREATER,
+	token.GT:        LESSERGREATER,
+	token.PLUS:      SUM,
+	token.MINUS:     SUM,
+	token.DIV:       MULT,
+	token.MULT:      MULT,
+	token.LPAREN:    CALL,
+	token.LBRACKET:  INDEX,
+	token.RANGE:     RANGE,
+	token.RANGEINCL: RANGE,
+	token.QDOT:      INDEX,
+	token.COALESCE:  COALESCE,
+	token.DOT:       INDEX,
+	token.LBRACE:    CALL,
+	token.ASSIGN:    ASSIGN,
 }
 
 type (
@@ -53,12 +65,40 @@ type Parser struct {
 	//hashmap of infix and prefix operators
 	prefixParseFuncs map[token.TokenType]prefixParse
 	infixParseFuncs  map[token.TokenType]infixParse
+	precedences      map[token.TokenType]int
+
+	// operators declared by the script with infixl/infixr, by symbol
+	operators map[string]declaredOperator
+
+	// index of currentToken in the token stream, and the tokens each node
+	// spans when WithSpans is given
+	index int
+	spans map[ast.Node]Span
+
+	// steps of parseExpression when WithTrace is given
+	tracing    bool
+	trace      []TraceStep
+	traceDepth int
+	// the level of the declared operator whose right operand the next
+	// parseExpression call parses, for the trace
+	operandLevel int64
 }
 
-func New(lexer *lexer.Lexer) *Parser {
+type declaredOperator struct {
+	level      int64
+	precedence int
+	right      bool
+}
+
+func New(lexer *lexer.Lexer, options ...Option) *Parser {
 	parser := &Parser{
-		lexer:  lexer,
-		errors: []string{},
+		lexer:     lexer,
+		errors:    []string{},
+		operators: map[string]declaredOperator{},
+		index:     -2,
+	}
+	for _, option := range options {
+		option(parser)
 	}
 
 	parser.prefixParseFuncs = make(map[token.TokenType]prefixParse)
@@ -72,6 +112,10 @@ func New(lexer *lexer.Lexer) *Parser {
 	parser.addPrefixToken(token.IF, parser.parseIfExpression)
 	parser.addPrefixToken(token.FUNC, parser.parseFunctionLiteral)
 	parser.addPrefixToken(token.STRING, parser.parseStringLiteral)
+	parser.addPrefixToken(token.LBRACKET, parser.parseArrayLiteral)
+	parser.addPrefixToken(token.TRY, parser.parseTryExpression)
+	parser.addPrefixToken(token.MATCH, parser.parseMatchExpression)
+	parser.addPrefixToken(token.MACRO, parser.parseMacroLiteral)
 
 	parser.infixParseFuncs = make(map[token.TokenType]infixParse)
 	parser.addInfixToken(token.PLUS, parser.parseInfixExpression)
@@ -83,6 +127,21 @@ func New(lexer *lexer.Lexer) *Parser {
 	parser.addInfixToken(token.LT, parser.parseInfixExpression)
 	parser.addInfixToken(token.GT, parser.parseInfixExpression)
 	parser.addInfixToken(token.LPAREN, parser.parseCallExpression)
+	parser.addInfixToken(token.LBRACKET, parser.parseIndexExpression)
+	parser.addInfixToken(token.RANGE, parser.parseRangeExpression)
+	parser.addInfixToken(token.RANGEINCL, parser.parseRangeExpression)
+	parser.addInfixToken(token.QDOT, parser.parseOptionalChain)
+	parser.addInfixToken(token.COALESCE, parser.parseInfixExpression)
+	parser.addInfixToken(token.DOT, parser.parseMemberExpression)
+	parser.addInfixToken(token.LBRACE, parser.parseStructLiteral)
+	parser.addInfixToken(token.ASSIGN, parser.parseAssignExpression)
+	parser.addInfixToken(token.OPERATOR, parser.parseOperatorExpression)
+
+	parser.precedences = make(map[token.TokenType]int, len(defaultPrecedences))
+	for tokenType, precedence := range defaultPrecedences {
+		parser.precedences[tokenType] = precedence
+	}
+	parser.addExtensions()
 
 	//set our current token and peek token
 	parser.getToken()
@@ -95,6 +154,7 @@ func New(lexer *lexer.Lexer) *Parser {
 func (parser *Parser) getToken() {
 	parser.currentToken = parser.nextToken
 	parser.nextToken = parser.lexer.GetToken()
+	parser.index++
 }
 
 // We expect the next token to be of type {tokenType}, if it is, we will 'consume' it, otherwise, return false and handle error
@@ -120,7 +180,7 @@ func (parser *Parser) nextTokenIs(tokenType token.TokenType) bool {
 
 func (parser *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: parser.currentToken, Function: function}
-	exp.Arguments = parser.parseCallArguments()
+	exp.Arguments = parser.parseExpressionList(token.RPAREN)
 	return exp
 }
 
@@ -128,10 +188,163 @@ func (parser *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: parser.currentToken, Value: parser.currentToken.Lexeme}
 }
 
-func (parser *Parser) parseCallArguments() []ast.Expression {
+func (parser *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: parser.currentToken}
+	array.Elements = parser.parseExpressionList(token.RBRACKET)
+	return array
+}
+
+// arr[i] is an index, arr[i:j], arr[:j] and arr[i:] are slices
+func (parser *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	tok := parser.currentToken
+
+	var start ast.Expression
+	if !parser.nextTokenIs(token.COLON) {
+		parser.getToken()
+		start = parser.parseExpression(NONE)
+	}
+
+	if !parser.nextTokenIs(token.COLON) {
+		if !parser.expect(token.RBRACKET) {
+			return nil
+		}
+		return &ast.IndexExpression{Token: tok, Left: left, Index: start}
+	}
+
+	parser.getToken()
+	slice := &ast.SliceExpression{Token: tok, Left: left, Start: start}
+
+	if !parser.nextTokenIs(token.RBRACKET) {
+		parser.getToken()
+		slice.End = parser.parseExpression(NONE)
+	}
+
+	if !parser.expect(token.RBRACKET) {
+		return nil
+	}
+
+	return slice
+}
+
+// a?.[i], f?.(x) and a?.x parse like a normal index or call which is flagged as optional
+func (parser *Parser) parseOptionalChain(left ast.Expression) ast.Expression {
+	switch {
+	case parser.nextTokenIs(token.LBRACKET):
+		parser.getToken()
+		switch exp := parser.parseIndexExpression(left).(type) {
+		case *ast.IndexExpression:
+			exp.Optional = true
+			return exp
+		case *ast.SliceExpression:
+			exp.Optional = true
+			return exp
+		}
+		return nil
+	case parser.nextTokenIs(token.LPAREN):
+		parser.getToken()
+		call := parser.parseCallExpression(left).(*ast.CallExpression)
+		call.Optional = true
+		return call
+	case parser.nextTokenIs(token.ID):
+		member := parser.parseMemberExpression(left).(*ast.MemberExpression)
+		member.Optional = true
+		return member
+	default:
+		msg := fmt.Sprintf("expected [, ( or a name after ?., got %s instead", parser.nextToken.Type)
+		parser.errors = append(parser.errors, msg)
+		return nil
+	}
+}
+
+// the current token is . or ?. and the member name comes next
+func (parser *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: parser.currentToken, Object: object}
+
+	if !parser.expect(token.ID) {
+		return nil
+	}
+
+	exp.Member = &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Lexeme}
+	return exp
+}
+
+// NAME { [ID : EXPR {, ID : EXPR}] }
+func (parser *Parser) parseStructLiteral(left ast.Expression) ast.Expression {
+	switch left.(type) {
+	case *ast.Identifier, *ast.MemberExpression:
+	case nil:
+		// the name itself failed to parse and already reported why
+		return nil
+	default:
+		msg := fmt.Sprintf("expected a struct name before {, got %s instead", left.String())
+		parser.errors = append(parser.errors, msg)
+		return nil
+	}
+
+	lit := &ast.StructLiteral{Token: parser.currentToken, Name: left}
+	lit.Fields = []*ast.Identifier{}
+	lit.Values = []ast.Expression{}
+
+	for !parser.nextTokenIs(token.RBRACE) {
+		if !parser.expect(token.ID) {
+			return nil
+		}
+		field := &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Lexeme}
+
+		if !parser.expect(token.COLON) {
+			return nil
+		}
+
+		parser.getToken()
+		lit.Fields = append(lit.Fields, field)
+		lit.Values = append(lit.Values, parser.parseExpression(NONE))
+
+		if !parser.nextTokenIs(token.RBRACE) && !parser.expect(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !parser.expect(token.RBRACE) {
+		return nil
+	}
+
+	return lit
+}
+
+// assignment is right associative, a.x = b.y = 1 assigns b.y first
+func (parser *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	if _, ok := target.(*ast.MemberExpression); !ok {
+		msg := fmt.Sprintf("cannot assign to %s", target.String())
+		parser.errors = append(parser.errors, msg)
+		return nil
+	}
+
+	exp := &ast.AssignExpression{Token: parser.currentToken, Target: target}
+
+	parser.getToken()
+	exp.Value = parser.parseExpression(ASSIGN - 1)
+
+	return exp
+}
+
+func (parser *Parser) parseRangeExpression(start ast.Expression) ast.Expression {
+	expr := &ast.RangeExpression{
+		Token:     parser.currentToken,
+		Start:     start,
+		Inclusive: parser.currentTokenIs(token.RANGEINCL),
+	}
+
+	precedence := parser.curPrecedence()
+	parser.getToken()
+	expr.End = parser.parseExpression(precedence)
+
+	return expr
+}
+
+func (parser *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	args := []ast.Expression{}
 
-	if parser.nextTokenIs(token.RPAREN) {
+	if parser.nextTokenIs(end) {
 		parser.getToken()
 		return args
 	}
@@ -145,7 +358,7 @@ func (parser *Parser) parseCallArguments() []ast.Expression {
 		args = append(args, parser.parseExpression(NONE))
 	}
 
-	if !parser.expect(token.RPAREN) {
+	if !parser.expect(end) {
 		return nil
 	}
 
@@ -182,7 +395,121 @@ func (parser *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+// TRY { STMTS } [catch [(ID)] { STMTS }] [finally { STMTS }]
+func (parser *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: parser.currentToken}
+
+	if !parser.expect(token.LBRACE) {
+		return nil
+	}
+	expression.Block = parser.parseStatementBlock()
+
+	if parser.nextTokenIs(token.CATCH) {
+		parser.getToken()
+		if parser.nextTokenIs(token.LPAREN) {
+			parser.getToken()
+			if !parser.expect(token.ID) {
+				return nil
+			}
+			expression.CatchParam = &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Lexeme}
+			if !parser.expect(token.RPAREN) {
+				return nil
+			}
+		}
+		if !parser.expect(token.LBRACE) {
+			return nil
+		}
+		expression.Catch = parser.parseStatementBlock()
+	}
+
+	if parser.nextTokenIs(token.FINALLY) {
+		parser.getToken()
+		if !parser.expect(token.LBRACE) {
+			return nil
+		}
+		expression.Finally = parser.parseStatementBlock()
+	}
+
+	if expression.Catch == nil && expression.Finally == nil {
+		parser.errors = append(parser.errors, "try needs a catch or finally block")
+		return nil
+	}
+
+	return expression
+}
+
+// MATCH ( EXPR ) { ARM {, ARM} }
+// ARM = ID [( [ID {, ID}] )] => EXPR | ID [( [ID {, ID}] )] => { STMTS }
+func (parser *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: parser.currentToken}
+
+	if !parser.expect(token.LPAREN) {
+		return nil
+	}
+
+	parser.getToken()
+	expression.Subject = parser.parseExpression(NONE)
+
+	if !parser.expect(token.RPAREN) {
+		return nil
+	}
+
+	if !parser.expect(token.LBRACE) {
+		return nil
+	}
+
+	expression.Arms = []*ast.MatchArm{}
+
+	for !parser.nextTokenIs(token.RBRACE) {
+		if !parser.expect(token.ID) {
+			return nil
+		}
+		arm := &ast.MatchArm{
+			Variant: &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Lexeme},
+		}
+
+		if parser.nextTokenIs(token.LPAREN) {
+			// the wildcard matches variants with any number of values
+			if arm.Variant.Value == "_" {
+				parser.errors = append(parser.errors, "the wildcard arm _ can't bind values")
+				return nil
+			}
+			parser.getToken()
+			arm.Bindings = parser.parseFunctionParameters()
+			if arm.Bindings == nil {
+				return nil
+			}
+		}
+
+		if !parser.expect(token.ARROW) {
+			return nil
+		}
+
+		if parser.nextTokenIs(token.LBRACE) {
+			parser.getToken()
+			arm.Body = parser.parseStatementBlock()
+		} else {
+			parser.getToken()
+			stmt := &ast.ExpressionStatement{Token: parser.currentToken}
+			stmt.Expression = parser.parseExpression(NONE)
+			arm.Body = &ast.StatementBlock{Token: stmt.Token, Statements: []ast.Statement{stmt}}
+		}
+		expression.Arms = append(expression.Arms, arm)
+
+		if parser.nextTokenIs(token.COMMA) || parser.nextTokenIs(token.SEMICOLON) {
+			parser.getToken()
+		}
+	}
+
+	if !parser.expect(token.RBRACE) {
+		return nil
+	}
+
+	return expression
+}
+
 func (parser *Parser) parseStatementBlock() *ast.StatementBlock {
+	start := parser.index
 	block := &ast.StatementBlock{Token: parser.currentToken}
 	block.Statements = []ast.Statement{}
 	parser.getToken()
@@ -194,6 +521,10 @@ func (parser *Parser) parseStatementBlock() *ast.StatementBlock {
 		}
 		parser.getToken()
 	}
+	if parser.currentTokenIs(token.RBRACE) {
+		block.Rbrace = parser.currentToken
+	}
+	parser.record(block, start)
 	return block
 }
 
@@ -240,7 +571,10 @@ func (parser *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	fl.Parameters = parser.parseFunctionParameters()
+	fl.Parameters, fl.ParameterTypes = parser.parseTypedParameters()
+	if fl.Parameters == nil || !parser.parseResultType(fl) {
+		return nil
+	}
 
 	if !parser.expect(token.LBRACE) {
 		return nil
@@ -250,6 +584,23 @@ func (parser *Parser) parseFunctionLiteral() ast.Expression {
 	return fl
 }
 
+func (parser *Parser) parseMacroLiteral() ast.Expression {
+	macro := &ast.MacroLiteral{Token: parser.currentToken}
+
+	if !parser.expect(token.LPAREN) {
+		return nil
+	}
+
+	macro.Parameters = parser.parseFunctionParameters()
+
+	if !parser.expect(token.LBRACE) {
+		return nil
+	}
+
+	macro.Body = parser.parseStatementBlock()
+	return macro
+}
+
 func (parser *Parser) parseFunctionParameters() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
 
@@ -276,6 +627,118 @@ func (parser *Parser) parseFunctionParameters() []*ast.Identifier {
 	return identifiers
 }
 
+// PARAMS = [PARAM {, PARAM}] )
+// PARAM = ID [: TYPE]
+// types is nil when no parameter is annotated, params is nil on errors
+func (parser *Parser) parseTypedParameters() (params []*ast.Identifier, types []ast.Type) {
+	params = []*ast.Identifier{}
+	annotated := false
+
+	if parser.nextTokenIs(token.RPAREN) {
+		parser.getToken()
+		return params, nil
+	}
+
+	for {
+		if !parser.expect(token.ID) {
+			return nil, nil
+		}
+		params = append(params, &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Lexeme})
+
+		var t ast.Type
+		if parser.nextTokenIs(token.COLON) {
+			parser.getToken()
+			parser.getToken()
+			if t = parser.parseType(); t == nil {
+				return nil, nil
+			}
+			annotated = true
+		}
+		types = append(types, t)
+
+		if !parser.nextTokenIs(token.COMMA) {
+			break
+		}
+		parser.getToken()
+	}
+
+	if !parser.expect(token.RPAREN) {
+		return nil, nil
+	}
+	if !annotated {
+		types = nil
+	}
+	return params, types
+}
+
+// [: TYPE] after the parameters of fl, false on errors
+func (parser *Parser) parseResultType(fl *ast.FunctionLiteral) bool {
+	if !parser.nextTokenIs(token.COLON) {
+		return true
+	}
+	parser.getToken()
+	parser.getToken()
+	fl.Result = parser.parseType()
+	return fl.Result != nil
+}
+
+// TYPE = ID | [ TYPE ] | FUNC ( [TYPE {, TYPE}] ) [: TYPE]
+// the current token starts the type and the last one ends it
+func (parser *Parser) parseType() ast.Type {
+	switch parser.currentToken.Type {
+	case token.ID:
+		return &ast.TypeName{Token: parser.currentToken, Name: parser.currentToken.Lexeme}
+
+	case token.LBRACKET:
+		at := &ast.ArrayType{Token: parser.currentToken}
+		parser.getToken()
+		if at.Element = parser.parseType(); at.Element == nil {
+			return nil
+		}
+		if !parser.expect(token.RBRACKET) {
+			return nil
+		}
+		return at
+
+	case token.FUNC:
+		ft := &ast.FunctionType{Token: parser.currentToken, Parameters: []ast.Type{}}
+		if !parser.expect(token.LPAREN) {
+			return nil
+		}
+		if parser.nextTokenIs(token.RPAREN) {
+			parser.getToken()
+		} else {
+			for {
+				parser.getToken()
+				param := parser.parseType()
+				if param == nil {
+					return nil
+				}
+				ft.Parameters = append(ft.Parameters, param)
+				if !parser.nextTokenIs(token.COMMA) {
+					break
+				}
+				parser.getToken()
+			}
+			if !parser.expect(token.RPAREN) {
+				return nil
+			}
+		}
+		if parser.nextTokenIs(token.COLON) {
+			parser.getToken()
+			parser.getToken()
+			if ft.Result = parser.parseType(); ft.Result == nil {
+				return nil
+			}
+		}
+		return ft
+	}
+
+	msg := fmt.Sprintf("expected a type, got %s", parser.currentToken.Type)
+	parser.errors = append(parser.errors, msg)
+	return nil
+}
+
 func (parser *Parser) Errors() []string {
 	return parser.errors
 }
@@ -316,14 +779,52 @@ func (parser *Parser) ParseProgram() *ast.Program {
 }
 
 func (parser *Parser) parseStatement() ast.Statement {
+	start := parser.index
+
+	// a statement that failed to parse is left out as an untyped nil, a nil
+	// *ast.LetStatement in stmt would not compare equal to nil
+	var stmt ast.Statement
 	switch parser.currentToken.Type {
 	case token.LET:
-		return parser.parseLetStatement()
+		if let := parser.parseLetStatement(); let != nil {
+			stmt = let
+		}
 	case token.RETURN:
-		return parser.parseReturnStatement()
+		if ret := parser.parseReturnStatement(); ret != nil {
+			stmt = ret
+		}
+	case token.THROW:
+		if throw := parser.parseThrowStatement(); throw != nil {
+			stmt = throw
+		}
+	case token.STRUCT, token.TYPE:
+		if decl := parser.parseStructStatement(); decl != nil {
+			stmt = decl
+		}
+	case token.ENUM:
+		if decl := parser.parseEnumStatement(); decl != nil {
+			stmt = decl
+		}
+	case token.IMPORT:
+		if imp := parser.parseImportStatement(); imp != nil {
+			stmt = imp
+		}
+	case token.EXPORT:
+		if export := parser.parseExportStatement(); export != nil {
+			stmt = export
+		}
+	case token.INFIXL, token.INFIXR:
+		if decl := parser.parseOperatorStatement(); decl != nil {
+			stmt = decl
+		}
 	default:
-		return parser.parseExpressionStatement()
+		if expr := parser.parseExpressionStatement(); expr != nil {
+			stmt = expr
+		}
 	}
+
+	parser.record(stmt, start)
+	return stmt
 }
 
 func (parser *Parser) parseLetStatement() *ast.LetStatement {
@@ -335,6 +836,14 @@ func (parser *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Name = &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Lexeme}
 
+	if parser.nextTokenIs(token.COLON) {
+		parser.getToken()
+		parser.getToken()
+		if stmt.Type = parser.parseType(); stmt.Type == nil {
+			return nil
+		}
+	}
+
 	if !parser.expect(token.ASSIGN) {
 		return nil
 	}
@@ -366,6 +875,239 @@ func (parser *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+// STRUCT ID { MEMBERS }
+// MEMBERS = ID | METHOD | ID , MEMBERS | ID ; MEMBERS | METHOD [,|;] MEMBERS
+// METHOD = FUNC ID ( ID {, ID} ) { STMTS }
+func (parser *Parser) parseStructStatement() *ast.StructStatement {
+	stmt := &ast.StructStatement{Token: parser.currentToken}
+
+	if !parser.expect(token.ID) {
+		return nil
+	}
+
+	stmt.Name = &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Lexeme}
+
+	if !parser.expect(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Fields = []*ast.Identifier{}
+	stmt.Methods = []*ast.FunctionLiteral{}
+	seen := map[string]bool{}
+
+	for !parser.nextTokenIs(token.RBRACE) {
+		if parser.nextTokenIs(token.FUNC) {
+			parser.getToken()
+			method := parser.parseMethod()
+			if method == nil {
+				return nil
+			}
+			if seen[method.Name] {
+				msg := fmt.Sprintf("duplicate member %s in struct %s", method.Name, stmt.Name.Value)
+				parser.errors = append(parser.errors, msg)
+			}
+			seen[method.Name] = true
+			stmt.Methods = append(stmt.Methods, method)
+
+			if parser.nextTokenIs(token.COMMA) || parser.nextTokenIs(token.SEMICOLON) {
+				parser.getToken()
+			}
+			continue
+		}
+
+		if !parser.expect(token.ID) {
+			return nil
+		}
+		field := &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Lexeme}
+		if seen[field.Value] {
+			msg := fmt.Sprintf("duplicate field %s in struct %s", field.Value, stmt.Name.Value)
+			parser.errors = append(parser.errors, msg)
+		}
+		seen[field.Value] = true
+		stmt.Fields = append(stmt.Fields, field)
+
+		if parser.nextTokenIs(token.RBRACE) {
+			break
+		}
+		if parser.nextTokenIs(token.SEMICOLON) {
+			parser.getToken()
+		} else if !parser.expect(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !parser.expect(token.RBRACE) {
+		return nil
+	}
+
+	if parser.nextTokenIs(token.SEMICOLON) {
+		parser.getToken()
+	}
+
+	return stmt
+}
+
+// the current token is FUNC, methods need the receiver as their first parameter
+func (parser *Parser) parseMethod() *ast.FunctionLiteral {
+	start := parser.index
+	fl := &ast.FunctionLiteral{Token: parser.currentToken}
+
+	if !parser.expect(token.ID) {
+		return nil
+	}
+	fl.Name = parser.currentToken.Lexeme
+
+	if !parser.expect(token.LPAREN) {
+		return nil
+	}
+	fl.Parameters, fl.ParameterTypes = parser.parseTypedParameters()
+	if fl.Parameters == nil || !parser.parseResultType(fl) {
+		return nil
+	}
+
+	if len(fl.Parameters) == 0 {
+		msg := fmt.Sprintf("method %s needs a receiver parameter", fl.Name)
+		parser.errors = append(parser.errors, msg)
+	}
+
+	if !parser.expect(token.LBRACE) {
+		return nil
+	}
+	fl.Body = parser.parseStatementBlock()
+
+	parser.record(fl, start)
+	return fl
+}
+
+// ENUM ID { VARIANT {, VARIANT} [,] }
+// VARIANT = ID | ID ( [ID {, ID}] )
+func (parser *Parser) parseEnumStatement() *ast.EnumStatement {
+	stmt := &ast.EnumStatement{Token: parser.currentToken}
+
+	if !parser.expect(token.ID) {
+		return nil
+	}
+
+	stmt.Name = &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Lexeme}
+
+	if !parser.expect(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Variants = []*ast.EnumVariant{}
+	seen := map[string]bool{}
+
+	for !parser.nextTokenIs(token.RBRACE) {
+		if !parser.expect(token.ID) {
+			return nil
+		}
+		variant := &ast.EnumVariant{
+			Name: &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Lexeme},
+		}
+		if seen[variant.Name.Value] {
+			msg := fmt.Sprintf("duplicate variant %s in enum %s", variant.Name.Value, stmt.Name.Value)
+			parser.errors = append(parser.errors, msg)
+		}
+		seen[variant.Name.Value] = true
+
+		if parser.nextTokenIs(token.LPAREN) {
+			parser.getToken()
+			variant.Fields = parser.parseFunctionParameters()
+			if variant.Fields == nil {
+				return nil
+			}
+		}
+		stmt.Variants = append(stmt.Variants, variant)
+
+		if !parser.nextTokenIs(token.RBRACE) && !parser.expect(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !parser.expect(token.RBRACE) {
+		return nil
+	}
+
+	if parser.nextTokenIs(token.SEMICOLON) {
+		parser.getToken()
+	}
+
+	return stmt
+}
+
+// IMPORT STRING [AS ID]
+func (parser *Parser) parseImportStatement() *ast.ImportStatement {
+	stmt := &ast.ImportStatement{Token: parser.currentToken}
+
+	if !parser.expect(token.STRING) {
+		return nil
+	}
+
+	stmt.Path = &ast.StringLiteral{Token: parser.currentToken, Value: parser.currentToken.Lexeme}
+
+	if parser.nextTokenIs(token.AS) {
+		parser.getToken()
+		if !parser.expect(token.ID) {
+			return nil
+		}
+		stmt.Alias = &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Lexeme}
+	}
+
+	if parser.nextTokenIs(token.SEMICOLON) {
+		parser.getToken()
+	}
+
+	return stmt
+}
+
+// EXPORT LET_STMT | EXPORT STRUCT_STMT | EXPORT ENUM_STMT
+func (parser *Parser) parseExportStatement() *ast.ExportStatement {
+	stmt := &ast.ExportStatement{Token: parser.currentToken}
+
+	parser.getToken()
+	start := parser.index
+
+	switch parser.currentToken.Type {
+	case token.LET:
+		if let := parser.parseLetStatement(); let != nil {
+			stmt.Statement = let
+		}
+	case token.STRUCT, token.TYPE:
+		if decl := parser.parseStructStatement(); decl != nil {
+			stmt.Statement = decl
+		}
+	case token.ENUM:
+		if decl := parser.parseEnumStatement(); decl != nil {
+			stmt.Statement = decl
+		}
+	default:
+		msg := fmt.Sprintf("expected let, struct, type or enum after export, got %s instead", parser.currentToken.Type)
+		parser.errors = append(parser.errors, msg)
+	}
+
+	if stmt.Statement == nil {
+		return nil
+	}
+
+	parser.record(stmt.Statement, start)
+	return stmt
+}
+
+// THROW EXPR
+func (parser *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: parser.currentToken}
+
+	parser.getToken()
+
+	stmt.Value = parser.parseExpression(NONE)
+
+	if parser.nextTokenIs(token.SEMICOLON) {
+		parser.getToken()
+	}
+
+	return stmt
+}
+
 func (parser *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: parser.currentToken}
 
@@ -379,23 +1121,47 @@ func (parser *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 func (parser *Parser) parseExpression(precedence int) ast.Expression {
+	start := parser.index
+	level := parser.operandLevel
+	parser.operandLevel = 0
+	parser.traceStep(TraceStep{Action: "expression", Current: parser.currentToken, Next: parser.nextToken, Precedence: precedence, Level: level})
+	parser.traceDepth++
+	defer func() { parser.traceDepth-- }()
+
 	prefix := parser.prefixParseFuncs[parser.currentToken.Type]
 	if prefix == nil {
+		parser.traceStep(TraceStep{Action: "error", Current: parser.currentToken, Next: parser.nextToken, Precedence: precedence, Level: level})
 		parser.noPrefixParseFnError(parser.currentToken.Type)
 		return nil
 	}
+	if parser.tracing {
+		parser.traceStep(TraceStep{Action: "prefix", Current: parser.currentToken, Next: parser.nextToken, Precedence: precedence, Level: level,
+			Function: parseFunctionName(prefix, extensionPrefixes[parser.currentToken.Type])})
+	}
+	parser.traceDepth++
 	leftExpr := prefix()
+	parser.traceDepth--
+	parser.record(leftExpr, start)
 
 	for !parser.nextTokenIs(token.SEMICOLON) && precedence < parser.peekPrecedence() {
 		infix := parser.infixParseFuncs[parser.nextToken.Type]
 		if infix == nil {
-			return leftExpr
+			break
+		}
+		if parser.tracing {
+			parser.traceStep(TraceStep{Action: "infix", Current: parser.currentToken, Next: parser.nextToken, Precedence: precedence, Level: level,
+				NextPrecedence: parser.peekPrecedence(), NextLevel: parser.level(parser.nextToken), Function: parseFunctionName(infix, extensionInfixes[parser.nextToken.Type])})
 		}
 
 		parser.getToken()
 
+		parser.traceDepth++
 		leftExpr = infix(leftExpr)
+		parser.traceDepth--
+		parser.record(leftExpr, start)
 	}
+	parser.traceStep(TraceStep{Action: "stop", Current: parser.currentToken, Next: parser.nextToken, Precedence: precedence, Level: level,
+		NextPrecedence: parser.peekPrecedence(), NextLevel: parser.level(parser.nextToken)})
 	return leftExpr
 }
 
@@ -427,14 +1193,29 @@ func (parser *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 }
 
 func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.nextToken.Type]; ok {
-		return p
-	}
-	return NONE
+	return p.precedence(p.nextToken)
 }
 
 func (p *Parser) curPrecedence() int {
-	if p, ok := precedences[p.currentToken.Type]; ok {
+	return p.precedence(p.currentToken)
+}
+
+// level is the level tok was declared at, 0 if it isn't a declared operator
+func (p *Parser) level(tok token.Token) int64 {
+	if tok.Type == token.OPERATOR {
+		return p.operators[tok.Lexeme].level
+	}
+	return 0
+}
+
+func (p *Parser) precedence(tok token.Token) int {
+	if tok.Type == token.OPERATOR {
+		if op, ok := p.operators[tok.Lexeme]; ok {
+			return op.precedence
+		}
+		return NONE
+	}
+	if p, ok := p.precedences[tok.Type]; ok {
 		return p
 	}
 	return NONE
@@ -447,3 +1228,86 @@ func (parser *Parser) addPrefixToken(tokenType token.TokenType, fnc prefixParse)
 func (parser *Parser) addInfixToken(tokenType token.TokenType, fnc infixParse) {
 	parser.infixParseFuncs[tokenType] = fnc
 }
+
+// declared operator levels run from 2, binding like ??, to 8, binding like a
+// prefix operator; + is 6 and * is 7
+const (
+	minOperatorLevel = 2
+	maxOperatorLevel = 8
+)
+
+// INFIXL|INFIXR LEVEL OPERATOR = EXPR
+func (parser *Parser) parseOperatorStatement() *ast.OperatorStatement {
+	stmt := &ast.OperatorStatement{Token: parser.currentToken}
+
+	if !parser.expect(token.DIGIT) {
+		return nil
+	}
+	level, err := strconv.ParseInt(parser.currentToken.Lexeme, 0, 64)
+	if err != nil || level < minOperatorLevel || level > maxOperatorLevel {
+		msg := fmt.Sprintf("operator precedence must be between %d and %d, got %s",
+			minOperatorLevel, maxOperatorLevel, parser.currentToken.Lexeme)
+		parser.errors = append(parser.errors, msg)
+		return nil
+	}
+	stmt.Precedence = level
+
+	if !parser.expect(token.OPERATOR) {
+		return nil
+	}
+	stmt.Operator = parser.currentToken.Lexeme
+	if token.IsBuiltinOperator(stmt.Operator) {
+		msg := fmt.Sprintf("cannot redeclare built in operator %s", stmt.Operator)
+		parser.errors = append(parser.errors, msg)
+		return nil
+	}
+	if _, ok := parser.operators[stmt.Operator]; ok {
+		msg := fmt.Sprintf("operator %s declared twice", stmt.Operator)
+		parser.errors = append(parser.errors, msg)
+		return nil
+	}
+	// declared before the function is parsed so its body can use it
+	parser.operators[stmt.Operator] = declaredOperator{
+		level:      level,
+		precedence: DeclaredPrecedence(level),
+		right:      stmt.RightAssociative(),
+	}
+
+	if !parser.expect(token.ASSIGN) {
+		return nil
+	}
+	parser.getToken()
+
+	stmt.Function = parser.parseExpression(NONE)
+
+	if parser.nextTokenIs(token.SEMICOLON) {
+		parser.getToken()
+	}
+
+	return stmt
+}
+
+func (parser *Parser) parseOperatorExpression(left ast.Expression) ast.Expression {
+	op, ok := parser.operators[parser.currentToken.Lexeme]
+	if !ok {
+		msg := fmt.Sprintf("unknown operator %s", parser.currentToken.Lexeme)
+		parser.errors = append(parser.errors, msg)
+		return nil
+	}
+
+	expr := &ast.InfixExpression{
+		Token: parser.currentToken,
+		Op:    parser.currentToken.Lexeme,
+		Left:  left,
+	}
+
+	precedence := op.precedence
+	if op.right {
+		precedence--
+	}
+	parser.getToken()
+	parser.operandLevel = op.level
+	expr.Right = parser.parseExpression(precedence)
+
+	return expr
+}
@@ -4,13 +4,17 @@ import (
 	"fmt"
 	"interpreter/ast"
 	"interpreter/lexer"
+	"interpreter/token"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 )
 
 /** TESTING **/
 
 func TestFunctionLiteralParsing(t *testing.T) {
-	input := `fn(x, y) { x + y; }`
+	input := `func(x, y) { x + y; }`
 
 	l := lexer.New(input)
 	p := New(l)
@@ -61,9 +65,9 @@ func TestFunctionParameterParsing(t *testing.T) {
 		input          string
 		expectedParams []string
 	}{
-		{input: "fn() {};", expectedParams: []string{}},
-		{input: "fn(x) {};", expectedParams: []string{"x"}},
-		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+		{input: "func() {};", expectedParams: []string{}},
+		{input: "func(x) {};", expectedParams: []string{"x"}},
+		{input: "func(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
 	}
 
 	for _, tt := range tests {
@@ -514,6 +518,50 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
+		{
+			"1..n + 1",
+			"(1..(n + 1))",
+		},
+		{
+			"a[1:-1][0]",
+			"((a[1:(-1)])[0])",
+		},
+		{
+			"a ?? b + c",
+			"(a ?? (b + c))",
+		},
+		{
+			"a?.[0]?.[1] ?? 1..2",
+			"(((a?.[0])?.[1]) ?? (1..2))",
+		},
+		{
+			"f?.(x)(y)",
+			"f?.(x)(y)",
+		},
+		{
+			"a.b.c + d.e * 2",
+			"(((a.b).c) + ((d.e) * 2))",
+		},
+		{
+			"a.b = c.d = 1 + 2",
+			"((a.b) = ((c.d) = (1 + 2)))",
+		},
+		{
+			"Point{x: 1, y: a + b}.x",
+			"(Point{x: 1, y: (a + b)}.x)",
+		},
+		{
+			"a?.b.c",
+			"((a?.b).c)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -529,6 +577,544 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 	}
 }
 
+func TestParsingArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, _ := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	input := "myArray[1 + 1]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, _ := program.Statements[0].(*ast.ExpressionStatement)
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+
+	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
+		return
+	}
+}
+
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedStart interface{}
+		expectedEnd   interface{}
+	}{
+		{"arr[1:3]", 1, 3},
+		{"arr[:3]", nil, 3},
+		{"arr[1:]", 1, nil},
+		{"arr[:]", nil, nil},
+		{"arr[start:end]", "start", "end"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, _ := program.Statements[0].(*ast.ExpressionStatement)
+		slice, ok := stmt.Expression.(*ast.SliceExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.SliceExpression. got=%T", stmt.Expression)
+		}
+
+		if !testIdentifier(t, slice.Left, "arr") {
+			return
+		}
+
+		if tt.expectedStart == nil {
+			if slice.Start != nil {
+				t.Errorf("slice.Start not nil. got=%s", slice.Start)
+			}
+		} else {
+			testLiteralExpression(t, slice.Start, tt.expectedStart)
+		}
+
+		if tt.expectedEnd == nil {
+			if slice.End != nil {
+				t.Errorf("slice.End not nil. got=%s", slice.End)
+			}
+		} else {
+			testLiteralExpression(t, slice.End, tt.expectedEnd)
+		}
+	}
+}
+
+func TestParsingRangeExpressions(t *testing.T) {
+	tests := []struct {
+		input     string
+		inclusive bool
+	}{
+		{"1..10", false},
+		{"1..=10", true},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, _ := program.Statements[0].(*ast.ExpressionStatement)
+		rng, ok := stmt.Expression.(*ast.RangeExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.RangeExpression. got=%T", stmt.Expression)
+		}
+
+		testIntegerLiteral(t, rng.Start, 1)
+		testIntegerLiteral(t, rng.End, 10)
+
+		if rng.Inclusive != tt.inclusive {
+			t.Errorf("rng.Inclusive not %t. got=%t", tt.inclusive, rng.Inclusive)
+		}
+	}
+}
+
+func TestParsingOptionalChains(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a?.[1]", "(a?.[1])"},
+		{"a?.[1:]", "(a?.[1:])"},
+		{"f?.(1, 2)", "f?.(1, 2)"},
+		{"a?.b", "(a?.b)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, _ := program.Statements[0].(*ast.ExpressionStatement)
+		switch exp := stmt.Expression.(type) {
+		case *ast.IndexExpression:
+			if !exp.Optional {
+				t.Errorf("index expression is not optional")
+			}
+		case *ast.SliceExpression:
+			if !exp.Optional {
+				t.Errorf("slice expression is not optional")
+			}
+		case *ast.CallExpression:
+			if !exp.Optional {
+				t.Errorf("call expression is not optional")
+			}
+		case *ast.MemberExpression:
+			if !exp.Optional {
+				t.Errorf("member expression is not optional")
+			}
+		default:
+			t.Fatalf("exp is not an optional chain. got=%T", stmt.Expression)
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("a?.1"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected an error for a?.1")
+	}
+}
+
+func TestParsingTryExpressions(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedParam string
+		hasCatch      bool
+		hasFinally    bool
+	}{
+		{"try { x } catch (e) { e }", "e", true, false},
+		{"try { x } catch { 1 }", "", true, false},
+		{"try { x } finally { y }", "", false, true},
+		{"try { x } catch (err) { 1 } finally { y }", "err", true, true},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, _ := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.TryExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.TryExpression. got=%T", stmt.Expression)
+		}
+
+		if len(exp.Block.Statements) != 1 {
+			t.Errorf("try block has wrong number of statements. got=%d", len(exp.Block.Statements))
+		}
+		if (exp.Catch != nil) != tt.hasCatch {
+			t.Errorf("exp.Catch wrong. want present=%t, got=%v", tt.hasCatch, exp.Catch)
+		}
+		if (exp.Finally != nil) != tt.hasFinally {
+			t.Errorf("exp.Finally wrong. want present=%t, got=%v", tt.hasFinally, exp.Finally)
+		}
+		if tt.expectedParam == "" {
+			if exp.CatchParam != nil {
+				t.Errorf("exp.CatchParam not nil. got=%s", exp.CatchParam)
+			}
+		} else {
+			testIdentifier(t, exp.CatchParam, tt.expectedParam)
+		}
+	}
+
+	p := New(lexer.New("try { x }"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected an error for try without catch or finally")
+	}
+}
+
+func TestThrowStatements(t *testing.T) {
+	l := lexer.New(`throw error("bad", "ValueError");`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ThrowStatement. got=%T", program.Statements[0])
+	}
+	if stmt.TokenLexeme() != "throw" {
+		t.Errorf("stmt.TokenLexeme not 'throw', got %q", stmt.TokenLexeme())
+	}
+	if _, ok := stmt.Value.(*ast.CallExpression); !ok {
+		t.Errorf("stmt.Value not *ast.CallExpression. got=%T", stmt.Value)
+	}
+}
+
+func TestStructStatements(t *testing.T) {
+	l := lexer.New("struct Point { x, y }")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.StructStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.StructStatement. got=%T", program.Statements[0])
+	}
+	testIdentifier(t, stmt.Name, "Point")
+	if len(stmt.Fields) != 2 {
+		t.Fatalf("wrong number of fields. got=%d", len(stmt.Fields))
+	}
+	testIdentifier(t, stmt.Fields[0], "x")
+	testIdentifier(t, stmt.Fields[1], "y")
+
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"struct P { x, x }", "duplicate field x in struct P"},
+		{"a + 1 = 2", "cannot assign to (a + 1)"},
+		{"[1]{x: 1}", "expected a struct name before {, got [1] instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expectedError {
+			t.Errorf("wrong parser errors. want=%q, got=%q", tt.expectedError, p.Errors())
+		}
+	}
+}
+
+func TestTypeStatements(t *testing.T) {
+	input := `type Point {
+		x, y;
+		func add(self, other) { Point{x: self.x + other.x, y: self.y + other.y} }
+		func __str__(self) { "point" }
+	}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.StructStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.StructStatement. got=%T", program.Statements[0])
+	}
+	if len(stmt.Fields) != 2 {
+		t.Fatalf("wrong number of fields. got=%d", len(stmt.Fields))
+	}
+	if len(stmt.Methods) != 2 {
+		t.Fatalf("wrong number of methods. got=%d", len(stmt.Methods))
+	}
+	if stmt.Methods[0].Name != "add" || stmt.Methods[1].Name != "__str__" {
+		t.Errorf("wrong method names. got=%q, %q", stmt.Methods[0].Name, stmt.Methods[1].Name)
+	}
+	testLiteralExpression(t, stmt.Methods[0].Parameters[0], "self")
+	testLiteralExpression(t, stmt.Methods[0].Parameters[1], "other")
+
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"type T { func m() { 1 } }", "method m needs a receiver parameter"},
+		{"type T { m, func m(self) { 1 } }", "duplicate member m in struct T"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expectedError {
+			t.Errorf("wrong parser errors. want=%q, got=%q", tt.expectedError, p.Errors())
+		}
+	}
+}
+
+func TestEnumStatements(t *testing.T) {
+	l := lexer.New("enum Shape { Circle(r), Rect(w, h), Empty }")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.EnumStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.EnumStatement. got=%T", program.Statements[0])
+	}
+	testIdentifier(t, stmt.Name, "Shape")
+
+	expected := []struct {
+		name   string
+		fields []string
+	}{
+		{"Circle", []string{"r"}},
+		{"Rect", []string{"w", "h"}},
+		{"Empty", nil},
+	}
+	if len(stmt.Variants) != len(expected) {
+		t.Fatalf("wrong number of variants. got=%d", len(stmt.Variants))
+	}
+	for i, v := range expected {
+		variant := stmt.Variants[i]
+		testIdentifier(t, variant.Name, v.name)
+		if (variant.Fields == nil) != (v.fields == nil) || len(variant.Fields) != len(v.fields) {
+			t.Errorf("variant %s has wrong fields. got=%v", v.name, variant.Fields)
+			continue
+		}
+		for j, f := range v.fields {
+			testIdentifier(t, variant.Fields[j], f)
+		}
+	}
+
+	p = New(lexer.New("enum E { A, A }"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 || p.Errors()[0] != "duplicate variant A in enum E" {
+		t.Errorf("wrong parser errors. got=%q", p.Errors())
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	input := `match (s) { Circle(r) => r * r, Rect(w, _) => { w }, _ => 0 }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, _ := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.MatchExpression. got=%T", stmt.Expression)
+	}
+	testIdentifier(t, exp.Subject, "s")
+
+	if len(exp.Arms) != 3 {
+		t.Fatalf("wrong number of arms. got=%d", len(exp.Arms))
+	}
+
+	testIdentifier(t, exp.Arms[0].Variant, "Circle")
+	testIdentifier(t, exp.Arms[0].Bindings[0], "r")
+	bodyStmt, _ := exp.Arms[0].Body.Statements[0].(*ast.ExpressionStatement)
+	testInfixExpression(t, bodyStmt.Expression, "r", "*", "r")
+
+	testIdentifier(t, exp.Arms[1].Variant, "Rect")
+	if len(exp.Arms[1].Bindings) != 2 {
+		t.Errorf("wrong number of bindings. got=%d", len(exp.Arms[1].Bindings))
+	}
+
+	testIdentifier(t, exp.Arms[2].Variant, "_")
+	if exp.Arms[2].Bindings != nil {
+		t.Errorf("wildcard arm has bindings. got=%v", exp.Arms[2].Bindings)
+	}
+
+	for _, input := range []string{
+		"enum S { A(x), B }; match (S.B) { _(x) => x }",
+		"enum S { A(x), B }; match (S.A(1)) { _(x, y) => y }",
+	} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != "the wildcard arm _ can't bind values" {
+			t.Errorf("wrong parser errors for %q. got=%q", input, p.Errors())
+		}
+	}
+}
+
+func TestImportExportStatements(t *testing.T) {
+	input := `
+	import "lib/math" as m
+	import "strings";
+	export let x = 5;
+	export struct Point { x, y }
+	export enum Color { Red, Green }
+	`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 5 {
+		t.Fatalf("program.Statements does not contain 5 statements. got=%d",
+			len(program.Statements))
+	}
+
+	imports := []struct {
+		path  string
+		alias string
+	}{
+		{"lib/math", "m"},
+		{"strings", ""},
+	}
+	for i, tt := range imports {
+		stmt, ok := program.Statements[i].(*ast.ImportStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ImportStatement. got=%T", program.Statements[i])
+		}
+		if stmt.Path.Value != tt.path {
+			t.Errorf("wrong import path. want=%q, got=%q", tt.path, stmt.Path.Value)
+		}
+		if tt.alias == "" {
+			if stmt.Alias != nil {
+				t.Errorf("stmt.Alias not nil. got=%s", stmt.Alias)
+			}
+		} else {
+			testIdentifier(t, stmt.Alias, tt.alias)
+		}
+	}
+
+	for i, name := range []string{"x", "Point", "Color"} {
+		stmt, ok := program.Statements[i+2].(*ast.ExportStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ExportStatement. got=%T", program.Statements[i+2])
+		}
+		if stmt.Name() != name {
+			t.Errorf("wrong exported name. want=%q, got=%q", name, stmt.Name())
+		}
+	}
+
+	p = New(lexer.New("export 5"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected an error for export of an expression")
+	}
+}
+
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n",
+			len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d\n",
+			len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T",
+			macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestStructLiteralParsing(t *testing.T) {
+	l := lexer.New("Point{x: 1, y: 2 * 3}")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, _ := program.Statements[0].(*ast.ExpressionStatement)
+	lit, ok := stmt.Expression.(*ast.StructLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StructLiteral. got=%T", stmt.Expression)
+	}
+	testIdentifier(t, lit.Name, "Point")
+	if len(lit.Fields) != 2 || len(lit.Values) != 2 {
+		t.Fatalf("wrong number of fields. got=%d", len(lit.Fields))
+	}
+	testIdentifier(t, lit.Fields[0], "x")
+	testIntegerLiteral(t, lit.Values[0], 1)
+	testIdentifier(t, lit.Fields[1], "y")
+	testInfixExpression(t, lit.Values[1], 2, "*", 3)
+}
+
 func testLiteralExpression(
 	t *testing.T,
 	exp ast.Expression,
@@ -613,6 +1199,23 @@ func testInfixExpression(t *testing.T, exp ast.Expression, left interface{},
 	return true
 }
 
+func TestFailedStatementsAreLeftOut(t *testing.T) {
+	for _, input := range []string{"import", "type", "let = 5", "return", "export 5", "infixl", "{ let }"} {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected a parser error for %q", input)
+		}
+		ast.Inspect(program, func(node ast.Node) bool {
+			if stmt, ok := node.(ast.Statement); ok && reflect.ValueOf(stmt).IsNil() {
+				t.Errorf("nil %T in the program of %q", stmt, input)
+				return false
+			}
+			return true
+		})
+	}
+}
+
 func checkParserErrors(t *testing.T, p *Parser) {
 	errors := p.Errors()
 	if len(errors) == 0 {
@@ -625,3 +1228,300 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+// betweenExpression is an embedder defined node for `x between lo and hi`
+type betweenExpression struct {
+	ast.CustomExpression
+	Token     token.Token
+	Value     ast.Expression
+	Low, High ast.Expression
+}
+
+func (b *betweenExpression) TokenLexeme() string { return b.Token.Lexeme }
+func (b *betweenExpression) String() string {
+	return "(" + b.Value.String() + " between " + b.Low.String() + " and " + b.High.String() + ")"
+}
+
+var registerExtensions sync.Once
+
+func registerTestGrammar() {
+	registerExtensions.Do(func() {
+		token.RegisterKeyword("in", "IN")
+		token.RegisterKeyword("not", "NOT")
+		token.RegisterKeyword("between", "BETWEEN")
+		token.RegisterKeyword("and", "AND")
+
+		RegisterInfix("IN", EQUALS, (*Parser).ParseInfixExpression)
+		RegisterPrefix("NOT", func(p *Parser) ast.Expression {
+			// `not` is spelled out `!`
+			expr := &ast.PrefixExpression{Token: p.CurrentToken(), Op: "!"}
+			p.Advance()
+			expr.Value = p.ParseExpression(PREFIX)
+			return expr
+		})
+		RegisterInfix("BETWEEN", EQUALS, func(p *Parser, left ast.Expression) ast.Expression {
+			expr := &betweenExpression{Token: p.CurrentToken(), Value: left}
+			p.Advance()
+			expr.Low = p.ParseExpression(EQUALS)
+			if !p.Expect("AND") {
+				return nil
+			}
+			p.Advance()
+			expr.High = p.ParseExpression(EQUALS)
+			return expr
+		})
+	})
+}
+
+func TestRegisteredGrammar(t *testing.T) {
+	registerTestGrammar()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x in list(1, 2)", "(x in list(1, 2))"},
+		{"a + 1 in b", "((a + 1) in b)"},
+		{"not a in b", "((!a) in b)"},
+		{"x between 1 + 1 and y * 2", "(x between (1 + 1) and (y * 2))"},
+		{"f(x between 1 and 2, 3)", "f((x between 1 and 2), 3)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+
+	p := New(lexer.New("x between 1 or 2"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected an error for a missing `and`")
+	}
+
+	// traces name the registered function, not the closure wrapping it
+	p = New(lexer.New("a in b"), WithTrace())
+	p.ParseProgram()
+	if trace := FormatTrace(p.Trace()); !strings.Contains(trace, "infix 'in' ParseInfixExpression: EQUALS is above NONE") {
+		t.Errorf("wrong trace for a registered infix:\n%s", trace)
+	}
+}
+
+func TestOperatorDeclarations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"infixl 6 <+> = f; a <+> b * c", "infixl 6 <+> = f;(a <+> (b * c))"},
+		{"infixl 6 <+> = f; a <+> b + c <+> d", "infixl 6 <+> = f;(((a <+> b) + c) <+> d)"},
+		{"infixr 8 ^^ = f; a ^^ b ^^ -c", "infixr 8 ^^ = f;(a ^^ (b ^^ (-c)))"},
+		{"infixl 4 <=> = f; a + 1 <=> b < c", "infixl 4 <=> = f;((a + 1) <=> (b < c))"},
+		{"infixl 7 |> = f; infixl 7 |>> = g; a |>> b |> c", "infixl 7 |> = f;infixl 7 |>> = g;((a |>> b) |> c)"},
+		{"infixl 6 <+> = func(a, b) { a <+> b }", "infixl 6 <+> = func(a, b) (a <+> b);"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestOperatorDeclarationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"infixl 9 <+> = f", "operator precedence must be between 2 and 8, got 9"},
+		{"infixl 6 == = f", "cannot redeclare built in operator =="},
+		{"infixl 6 <+> = f; infixr 7 <+> = g", "operator <+> declared twice"},
+		{"infixl 6 x = f", "expected next token to be OPERATOR, got DIGIT instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("expected error %q, got=%v", tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: int = 1", "let x: int = 1;"},
+		{"let xs: [[string]] = []", "let xs: [[string]] = [];"},
+		{"let f = func(a: string, b: [int]): bool { true }", "let f = func(a: string, b: [int]): bool true;"},
+		{"func(a, b: Point) { a }", "func(a, b: Point) a"},
+		{"let g: func(int, func(): int): [int] = f", "let g: func(int, func(): int): [int] = f;"},
+		{"struct P { x; func get(self, d: int): int { d } }", "struct P { x; func get(self, d: int): int d }"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+
+	p := New(lexer.New("func(a, b: int) { a }"))
+	fl := p.ParseProgram().Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(fl.ParameterTypes) != 2 || fl.ParameterTypes[0] != nil || fl.ParameterTypes[1].String() != "int" || fl.Result != nil {
+		t.Errorf("wrong annotations. got=%v, result=%v", fl.ParameterTypes, fl.Result)
+	}
+}
+
+func TestTypeAnnotationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: = 1", "expected a type, got ="},
+		{"let x: [int = 1", "expected next token to be ], got ID instead"},
+		{"func(a: 1) { a }", "expected a type, got DIGIT"},
+		{"macro(a: int) { a }", "expected next token to be ), got ID instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("expected error %q for %q, got=%v", tt.expected, tt.input, p.Errors())
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	// let x = ( a + b ) * c ;  f  (  x  )
+	//  0  1 2 3 4 5 6 7 8 9 10 11 12 13 14
+	p := New(lexer.New("let x = (a + b) * c; f(x)"), WithSpans())
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	let := program.Statements[0].(*ast.LetStatement)
+	product := let.Value.(*ast.InfixExpression)
+	call := program.Statements[1].(*ast.ExpressionStatement)
+
+	tests := []struct {
+		node     ast.Node
+		expected Span
+	}{
+		{let, Span{0, 10}},
+		{product, Span{3, 9}},
+		{product.Left, Span{3, 7}},
+		{product.Left.(*ast.InfixExpression).Right, Span{6, 6}},
+		{call, Span{11, 14}},
+		{call.Expression.(*ast.CallExpression).Arguments[0], Span{13, 13}},
+	}
+	for _, tt := range tests {
+		if span, ok := p.Spans()[tt.node]; !ok || span != tt.expected {
+			t.Errorf("wrong span for %s. expected=%v, got=%v", tt.node, tt.expected, span)
+		}
+	}
+	if _, ok := p.Spans()[let.Name]; ok {
+		t.Errorf("let name has a span")
+	}
+
+	if New(lexer.New("a")).Spans() != nil {
+		t.Errorf("spans recorded without WithSpans")
+	}
+}
+
+func TestTrace(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"-a * b", `expression '-' NONE, next 'a'
+  prefix '-' parsePrefixExpression
+    expression 'a' PREFIX, next '*'
+      prefix 'a' parseIdentifier
+      stop at '*': MULT is not above PREFIX
+  infix '*' parseInfixExpression: MULT is above NONE
+    expression 'b' MULT, next EOF
+      prefix 'b' parseIdentifier
+      stop at EOF: end of input
+  stop at EOF: end of input
+`},
+		{"a + b(c);", `expression 'a' NONE, next '+'
+  prefix 'a' parseIdentifier
+  infix '+' parseInfixExpression: SUM is above NONE
+    expression 'b' SUM, next '('
+      prefix 'b' parseIdentifier
+      infix '(' parseCallExpression: CALL is above SUM
+        expression 'c' NONE, next ')'
+          prefix 'c' parseIdentifier
+          stop at ')': NONE is not above NONE
+      stop at ';': end of statement
+  stop at ';': end of statement
+`},
+		{"a +", `expression 'a' NONE, next '+'
+  prefix 'a' parseIdentifier
+  infix '+' parseInfixExpression: SUM is above NONE
+    expression EOF SUM, next EOF
+      no prefix parse function for EOF
+  stop at EOF: end of input
+`},
+		// declared operators show their level, even one binding like *
+		{"infixl 7 <*> = f; a <*> b * c", `expression 'f' NONE, next ';'
+  prefix 'f' parseIdentifier
+  stop at ';': end of statement
+expression 'a' NONE, next '<*>'
+  prefix 'a' parseIdentifier
+  infix '<*>' parseOperatorExpression: level 7 is above NONE
+    expression 'b' level 7, next '*'
+      prefix 'b' parseIdentifier
+      stop at '*': MULT is not above level 7
+  infix '*' parseInfixExpression: MULT is above NONE
+    expression 'c' MULT, next EOF
+      prefix 'c' parseIdentifier
+      stop at EOF: end of input
+  stop at EOF: end of input
+`},
+		{"infixr 5 <:> = f; a <:> b <:> c", `expression 'f' NONE, next ';'
+  prefix 'f' parseIdentifier
+  stop at ';': end of statement
+expression 'a' NONE, next '<:>'
+  prefix 'a' parseIdentifier
+  infix '<:>' parseOperatorExpression: level 5 is above NONE
+    expression 'b' level 5 (right), next '<:>'
+      prefix 'b' parseIdentifier
+      infix '<:>' parseOperatorExpression: level 5 is above level 5 (right)
+        expression 'c' level 5 (right), next EOF
+          prefix 'c' parseIdentifier
+          stop at EOF: end of input
+      stop at EOF: end of input
+  stop at EOF: end of input
+`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input), WithTrace())
+		p.ParseProgram()
+		if got := FormatTrace(p.Trace()); got != tt.expected {
+			t.Errorf("wrong trace for %q.\nexpected=\n%s\ngot=\n%s", tt.input, tt.expected, got)
+		}
+	}
+
+	p := New(lexer.New("a + b"))
+	p.ParseProgram()
+	if p.Trace() != nil {
+		t.Errorf("trace recorded without WithTrace")
+	}
+}
@@ -0,0 +1,36 @@
+package parser
+
+import "interpreter/ast"
+
+// Option configures a parser made by New.
+type Option func(*Parser)
+
+// Span is the run of tokens a node was parsed from, as indices of its first
+// and last token in the order the lexer produced them.
+type Span struct {
+	Start, End int
+}
+
+// WithSpans makes the parser remember the span of every statement, block and
+// expression it parses, see Spans.
+func WithSpans() Option {
+	return func(parser *Parser) {
+		parser.spans = map[ast.Node]Span{}
+	}
+}
+
+// Spans returns the spans recorded by a parser made with WithSpans. Nodes
+// parsed some other way, like the identifiers naming a let or a parameter,
+// have none.
+func (parser *Parser) Spans() map[ast.Node]Span {
+	return parser.spans
+}
+
+// record remembers that node ends at the current token; a node parsed again
+// inside parentheses gets the wider span
+func (parser *Parser) record(node ast.Node, start int) {
+	if parser.spans == nil || node == nil {
+		return
+	}
+	parser.spans[node] = Span{Start: start, End: parser.index}
+}
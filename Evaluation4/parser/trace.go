@@ -0,0 +1,165 @@
+package parser
+
+import (
+	"fmt"
+	"interpreter/token"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// TraceStep is one decision parseExpression made while parsing with
+// WithTrace.
+type TraceStep struct {
+	// how deep the step is in the tree of parseExpression calls
+	Depth int
+
+	// Action is "expression" when parseExpression starts, "prefix" and
+	// "infix" when it runs a parse function, "stop" when it returns and
+	// "error" when there is no prefix parse function for Current
+	Action string
+
+	Current, Next token.Token
+
+	// Precedence is the one parseExpression was called with, NextPrecedence
+	// the one of Next it was compared against
+	Precedence, NextPrecedence int
+
+	// Level and NextLevel are the levels of the declared operators the
+	// precedences come from, 0 for the others
+	Level, NextLevel int64
+
+	// Function is the parse function that ran
+	Function string
+}
+
+// WithTrace makes the parser record the steps of every parseExpression call,
+// see Trace.
+func WithTrace() Option {
+	return func(parser *Parser) {
+		parser.tracing = true
+	}
+}
+
+// Trace returns the steps recorded by a parser made with WithTrace.
+func (parser *Parser) Trace() []TraceStep {
+	return parser.trace
+}
+
+// FormatTrace prints steps as a tree, each parse function indented under the
+// parseExpression call that ran it and each nested call under the parse
+// function that made it.
+//
+//	expression '-' NONE, next 'a'
+//	  prefix '-' parsePrefixExpression
+//	    expression 'a' PREFIX, next '*'
+//	      prefix 'a' parseIdentifier
+//	      stop at '*': MULT is not above PREFIX
+//	  infix '*' parseInfixExpression: MULT is above NONE
+//	    expression 'b' MULT, next EOF
+//	...
+func FormatTrace(steps []TraceStep) string {
+	var out strings.Builder
+	for _, step := range steps {
+		out.WriteString(strings.Repeat("  ", step.Depth))
+		switch step.Action {
+		case "expression":
+			fmt.Fprintf(&out, "expression %s %s, next %s", quote(step.Current),
+				precedenceText(step.Precedence, step.Level), quote(step.Next))
+		case "prefix":
+			fmt.Fprintf(&out, "prefix %s %s", quote(step.Current), step.Function)
+		case "error":
+			fmt.Fprintf(&out, "no prefix parse function for %s", step.Current.Type)
+		case "infix":
+			fmt.Fprintf(&out, "infix %s %s: %s is above %s", quote(step.Next), step.Function,
+				precedenceText(step.NextPrecedence, step.NextLevel), precedenceText(step.Precedence, step.Level))
+		case "stop":
+			fmt.Fprintf(&out, "stop at %s: %s", quote(step.Next), stopReason(step))
+		}
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// quote shows a token as written, or EOF
+func quote(tok token.Token) string {
+	if tok.Type == token.EOF {
+		return "EOF"
+	}
+	return "'" + tok.Lexeme + "'"
+}
+
+func stopReason(step TraceStep) string {
+	switch {
+	case step.Next.Type == token.SEMICOLON:
+		return "end of statement"
+	case step.Next.Type == token.EOF:
+		return "end of input"
+	case step.Precedence < step.NextPrecedence:
+		return "no infix parse function"
+	}
+	return fmt.Sprintf("%s is not above %s", precedenceText(step.NextPrecedence, step.NextLevel), precedenceText(step.Precedence, step.Level))
+}
+
+// PrecedenceName returns the name of a precedence constant, or the number of
+// any other precedence.
+func PrecedenceName(precedence int) string {
+	switch precedence {
+	case NONE:
+		return "NONE"
+	case ASSIGN:
+		return "ASSIGN"
+	case COALESCE:
+		return "COALESCE"
+	case RANGE:
+		return "RANGE"
+	case EQUALS:
+		return "EQUALS"
+	case LESSERGREATER:
+		return "LESSERGREATER"
+	case SUM:
+		return "SUM"
+	case MULT:
+		return "MULT"
+	case PREFIX:
+		return "PREFIX"
+	case CALL:
+		return "CALL"
+	case INDEX:
+		return "INDEX"
+	}
+	return fmt.Sprint(precedence)
+}
+
+// precedenceText names a precedence, by its level when it comes from a
+// declared operator. The right operand of an infixr operator is parsed just
+// below its level, which shows as (right).
+func precedenceText(precedence int, level int64) string {
+	switch {
+	case level == 0:
+		return PrecedenceName(precedence)
+	case precedence < DeclaredPrecedence(level):
+		return fmt.Sprintf("level %d (right)", level)
+	}
+	return fmt.Sprintf("level %d", level)
+}
+
+// traceStep records step at the current depth
+func (parser *Parser) traceStep(step TraceStep) {
+	if !parser.tracing {
+		return
+	}
+	step.Depth = parser.traceDepth
+	parser.trace = append(parser.trace, step)
+}
+
+// parseFunctionName names the parse function fn, or the registered function
+// extension when fn is the closure wrapping it
+func parseFunctionName(fn interface{}, extension interface{}) string {
+	if extension != nil && !reflect.ValueOf(extension).IsNil() {
+		fn = extension
+	}
+	name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	return name[strings.LastIndex(name, ".")+1:]
+}
@@ -0,0 +1,379 @@
+// Package resolver binds every identifier of a program to the declaration it
+// refers to before the program runs, so undefined names are reported up front
+// instead of by evalIdentifier when the line is reached.
+//
+// Scopes follow the evaluator: the program and every function and macro body
+// have one, as do match arms and catch blocks, while if and try blocks share
+// the scope around them. A function body looks names up when it is called,
+// so it sees everything its enclosing scopes declare, even after it.
+package resolver
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Kind is where a name was found, seen from the place it is used.
+type Kind int
+
+const (
+	// Local names are declared in the function, or match arm or catch block,
+	// the use is in
+	Local Kind = iota
+	// Enclosing names are declared in a function around that one
+	Enclosing
+	// Global names are declared at the top level of the program
+	Global
+	// Builtin names are provided by the interpreter
+	Builtin
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Local:
+		return "local"
+	case Enclosing:
+		return "enclosing"
+	case Global:
+		return "global"
+	case Builtin:
+		return "builtin"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Scope holds the names declared directly in it.
+type Scope struct {
+	Parent *Scope
+	// Node opened the scope: the program, a function or macro literal, the
+	// body of a match arm or a catch block
+	Node ast.Node
+	// Function is true for the scopes of the program, functions and macros
+	Function bool
+	Names    map[string]*Declaration
+
+	// function bodies to resolve once this function's scope is complete, and
+	// uses not found when they were reached
+	deferred   []func()
+	unresolved []use
+}
+
+// Declaration is a name bound by a let, a parameter, a struct, enum or import
+// statement, a match binding or a catch parameter.
+type Declaration struct {
+	Name string
+	// Node is the identifier naming the declaration, or the import statement
+	// for an import without an alias
+	Node  ast.Node
+	Scope *Scope
+	// Uses are the identifiers bound to it, in source order
+	Uses []*ast.Identifier
+}
+
+// Binding is what an identifier refers to. Declaration is nil for builtins
+// and for global names declared before the program, like the ones earlier
+// console lines defined.
+type Binding struct {
+	Kind        Kind
+	Declaration *Declaration
+}
+
+// Table is the outcome of resolving a program.
+type Table struct {
+	Global *Scope
+	// Uses has every identifier that refers to a name and was found
+	Uses map[*ast.Identifier]Binding
+	// Declarations has every identifier that declares a name
+	Declarations map[*ast.Identifier]*Declaration
+	// Scopes has every scope by the node that opened it
+	Scopes map[ast.Node]*Scope
+	Errors []string
+}
+
+type use struct {
+	ident *ast.Identifier
+	scope *Scope
+}
+
+type resolver struct {
+	table           *Table
+	scope           *Scope
+	builtin, global func(name string) bool
+
+	// errors by the identifier they are about, reported in source order
+	errors []resolveError
+}
+
+type resolveError struct {
+	ident *ast.Identifier
+	msg   string
+}
+
+// Resolve binds the identifiers of program, usually an *ast.Program, which is
+// the global scope. builtin reports the names every program can use without
+// declaring them and global the names its global scope holds before it runs;
+// either may be nil.
+func Resolve(program ast.Node, builtin, global func(name string) bool) *Table {
+	r := &resolver{
+		table: &Table{
+			Uses:         map[*ast.Identifier]Binding{},
+			Declarations: map[*ast.Identifier]*Declaration{},
+			Scopes:       map[ast.Node]*Scope{},
+			Errors:       []string{},
+		},
+		builtin: builtin,
+		global:  global,
+	}
+	r.scope = r.open(program, true)
+	r.table.Global = r.scope
+
+	r.resolve(program)
+	r.finish(r.scope)
+
+	sort.SliceStable(r.errors, func(i, j int) bool {
+		a, b := r.errors[i].ident.Token, r.errors[j].ident.Token
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	for _, err := range r.errors {
+		r.table.Errors = append(r.table.Errors, fmt.Sprintf("%d:%d: %s", err.ident.Token.Line, err.ident.Token.Column, err.msg))
+	}
+	return r.table
+}
+
+func (r *resolver) open(node ast.Node, function bool) *Scope {
+	scope := &Scope{Parent: r.scope, Node: node, Function: function, Names: map[string]*Declaration{}}
+	r.table.Scopes[node] = scope
+	return scope
+}
+
+func (r *resolver) errorf(ident *ast.Identifier, format string, args ...interface{}) {
+	r.errors = append(r.errors, resolveError{ident, fmt.Sprintf(format, args...)})
+}
+
+func (r *resolver) resolve(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		r.use(node)
+
+	case *ast.LetStatement:
+		r.resolve(node.Value)
+		r.declare(node.Name.Value, node.Name)
+
+	case *ast.StructStatement:
+		r.declare(node.Name.Value, node.Name)
+		for _, method := range node.Methods {
+			r.function(method, method.Parameters, method.Body)
+		}
+
+	case *ast.EnumStatement:
+		r.declare(node.Name.Value, node.Name)
+
+	case *ast.ImportStatement:
+		if node.Alias != nil {
+			r.declare(node.Alias.Value, node.Alias)
+		} else {
+			name := path.Base(node.Path.Value)
+			r.declare(strings.TrimSuffix(name, path.Ext(name)), node)
+		}
+
+	case *ast.FunctionLiteral:
+		r.function(node, node.Parameters, node.Body)
+
+	case *ast.MacroLiteral:
+		r.function(node, node.Parameters, node.Body)
+
+	case *ast.CallExpression:
+		if node.Function.TokenLexeme() == "quote" {
+			r.quoted(node)
+			return
+		}
+		r.children(node)
+
+	case *ast.MemberExpression:
+		r.resolve(node.Object)
+
+	case *ast.StructLiteral:
+		r.resolve(node.Name)
+		for _, value := range node.Values {
+			r.resolve(value)
+		}
+
+	case *ast.MatchExpression:
+		r.resolve(node.Subject)
+		for _, arm := range node.Arms {
+			outer := r.scope
+			r.scope = r.open(arm.Body, false)
+			r.parameters(arm.Bindings, "binding")
+			r.resolve(arm.Body)
+			r.scope = outer
+		}
+
+	case *ast.TryExpression:
+		r.resolve(node.Block)
+		if node.Catch != nil {
+			outer := r.scope
+			r.scope = r.open(node.Catch, false)
+			if node.CatchParam != nil {
+				r.declare(node.CatchParam.Value, node.CatchParam)
+			}
+			r.resolve(node.Catch)
+			r.scope = outer
+		}
+		if node.Finally != nil {
+			r.resolve(node.Finally)
+		}
+
+	default:
+		r.children(node)
+	}
+}
+
+// children resolves everything directly below node
+func (r *resolver) children(node ast.Node) {
+	ast.Inspect(node, func(child ast.Node) bool {
+		if child == node {
+			return true
+		}
+		if child != nil {
+			r.resolve(child)
+		}
+		return false
+	})
+}
+
+// quoted resolves only the unquoted parts of quote(...), the rest is code
+// handed to a macro
+func (r *resolver) quoted(node ast.Node) {
+	ast.Inspect(node, func(child ast.Node) bool {
+		call, ok := child.(*ast.CallExpression)
+		if ok && call.Function.TokenLexeme() == "unquote" {
+			for _, arg := range call.Arguments {
+				r.resolve(arg)
+			}
+			return false
+		}
+		return true
+	})
+}
+
+// function resolves a body once the function around it is complete
+func (r *resolver) function(node ast.Node, params []*ast.Identifier, body *ast.StatementBlock) {
+	outer := r.scope
+	enclosing := outer
+	for !enclosing.Function {
+		enclosing = enclosing.Parent
+	}
+
+	enclosing.deferred = append(enclosing.deferred, func() {
+		saved := r.scope
+		r.scope = outer
+		r.scope = r.open(node, true)
+		r.parameters(params, "parameter")
+		if body != nil {
+			r.resolve(body)
+		}
+		r.finish(r.scope)
+		r.scope = saved
+	})
+}
+
+// parameters declares names which have to differ, _ is never declared
+func (r *resolver) parameters(params []*ast.Identifier, what string) {
+	for _, param := range params {
+		if param.Value == "_" {
+			continue
+		}
+		if _, ok := r.scope.Names[param.Value]; ok {
+			r.errorf(param, "duplicate %s %s", what, param.Value)
+			continue
+		}
+		r.declare(param.Value, param)
+	}
+}
+
+// finish resolves the functions declared in scope and reports the uses in it
+// that were never found
+func (r *resolver) finish(scope *Scope) {
+	for len(scope.deferred) > 0 {
+		next := scope.deferred[0]
+		scope.deferred = scope.deferred[1:]
+		next()
+	}
+
+	for _, u := range scope.unresolved {
+		if decl, _, ok := lookup(u.ident.Value, u.scope); ok && inFunction(decl.Scope, scope) {
+			r.errorf(u.ident, "%s used before let", u.ident.Value)
+		} else {
+			r.errorf(u.ident, "undefined name %s", u.ident.Value)
+		}
+	}
+	scope.unresolved = nil
+}
+
+func (r *resolver) declare(name string, node ast.Node) {
+	decl := &Declaration{Name: name, Node: node, Scope: r.scope}
+	r.scope.Names[name] = decl
+	if ident, ok := node.(*ast.Identifier); ok {
+		r.table.Declarations[ident] = decl
+	}
+}
+
+func (r *resolver) use(ident *ast.Identifier) {
+	if decl, kind, ok := lookup(ident.Value, r.scope); ok {
+		decl.Uses = append(decl.Uses, ident)
+		r.table.Uses[ident] = Binding{Kind: kind, Declaration: decl}
+		return
+	}
+	if r.global != nil && r.global(ident.Value) {
+		r.table.Uses[ident] = Binding{Kind: Global}
+		return
+	}
+	if r.builtin != nil && r.builtin(ident.Value) {
+		r.table.Uses[ident] = Binding{Kind: Builtin}
+		return
+	}
+
+	function := r.scope
+	for !function.Function {
+		function = function.Parent
+	}
+	function.unresolved = append(function.unresolved, use{ident, r.scope})
+}
+
+// lookup finds name from scope outwards
+func lookup(name string, scope *Scope) (*Declaration, Kind, bool) {
+	crossed := false
+	for s := scope; s != nil; s = s.Parent {
+		if decl, ok := s.Names[name]; ok {
+			switch {
+			case s.Parent == nil:
+				return decl, Global, true
+			case crossed:
+				return decl, Enclosing, true
+			default:
+				return decl, Local, true
+			}
+		}
+		if s.Function {
+			crossed = true
+		}
+	}
+	return nil, 0, false
+}
+
+// inFunction reports whether scope is function or inside it without another
+// function in between
+func inFunction(scope, function *Scope) bool {
+	for s := scope; s != nil; s = s.Parent {
+		if s == function {
+			return true
+		}
+		if s.Function {
+			return false
+		}
+	}
+	return false
+}
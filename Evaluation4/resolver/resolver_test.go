@@ -0,0 +1,130 @@
+package resolver
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func isBuiltin(name string) bool {
+	return name == "len" || name == "puts"
+}
+
+// uses lists the identifiers resolved in program in source order as
+// name:kind, and declared identifiers as name=
+func uses(program *ast.Program, table *Table) string {
+	var out []string
+	ast.Inspect(program, func(node ast.Node) bool {
+		ident, ok := node.(*ast.Identifier)
+		if !ok {
+			return true
+		}
+		if binding, ok := table.Uses[ident]; ok {
+			out = append(out, fmt.Sprintf("%s:%s", ident.Value, binding.Kind))
+		} else if _, ok := table.Declarations[ident]; ok {
+			out = append(out, ident.Value+"=")
+		}
+		return true
+	})
+	return strings.Join(out, " ")
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 1; a + len(a)", "a= a:global len:builtin a:global"},
+		{"let f = func(x) { let y = x; func() { x + y + f } }",
+			"f= x= y= x:local x:enclosing y:enclosing f:global"},
+		// a body runs when called, so it sees names declared after it
+		{"let even = func(n) { odd(n) }; let odd = func(n) { even(n) }",
+			"even= n= odd:global n:local odd= n= even:global n:local"},
+		// if and try blocks don't open a scope
+		{"if (true) { let a = 1 }; try { let b = a } finally { b }", "a= b= a:global b:global"},
+		{"let len = 1; len", "len= len:global"},
+		{"func(x) { match (x) { Some(v) => v, _ => x } }", "x= x:local v= v:local x:local"},
+		{"try { 1 } catch (e) { e }", "e= e:local"},
+		{`import "lib/math"; import "x" as y; math.pi + y.z`, "y= math:global y:global"},
+		{"struct P { x; func len(self) { P{x: self.x} } }", "P= self= P:global self:local"},
+		{"enum E { A(v) }; E.A(1)", "E= E:global"},
+		{"let m = macro(a) { quote(unquote(a) + b) }", "m= a= a:local"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		table := Resolve(program, isBuiltin, nil)
+		if len(table.Errors) != 0 {
+			t.Errorf("errors for %q: %v", tt.input, table.Errors)
+		}
+		if got := uses(program, table); got != tt.expected {
+			t.Errorf("wrong bindings for %q.\nexpected=%s\ngot=     %s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"missing", []string{"1:1: undefined name missing"}},
+		{"let x = x + 1", []string{"1:9: x used before let"}},
+		{"a; let a = 1", []string{"1:1: a used before let"}},
+		{"func() { a; let a = 1 }", []string{"1:10: a used before let"}},
+		{"let a = 1; func() { a; let a = 2 }", nil},
+		{"func(a, b, a) { b }", []string{"1:12: duplicate parameter a"}},
+		{"struct P { func f(self, self) { 1 } }", []string{"1:25: duplicate parameter self"}},
+		{"match (x) { A(v, v, _, _) => v }", []string{"1:8: undefined name x", "1:18: duplicate binding v"}},
+		{"match (x) { A(v) => v, B => v }", []string{"1:8: undefined name x", "1:29: undefined name v"}},
+		{"try { 1 } catch (e) { 2 }; e", []string{"1:28: undefined name e"}},
+		{"let f = func() { g() }", []string{"1:18: undefined name g"}},
+	}
+
+	for _, tt := range tests {
+		table := Resolve(parse(t, tt.input), isBuiltin, nil)
+		if strings.Join(table.Errors, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong errors for %q.\nexpected=%q\ngot=%q", tt.input, tt.expected, table.Errors)
+		}
+	}
+}
+
+func TestResolveTable(t *testing.T) {
+	program := parse(t, "let a = 1; let f = func(b) { a + b }; f(a)")
+	table := Resolve(program, nil, func(name string) bool { return name == "f" })
+
+	decl := table.Global.Names["a"]
+	if decl == nil || len(decl.Uses) != 2 {
+		t.Fatalf("expected a declared globally with 2 uses, got %+v", decl)
+	}
+	fn := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	scope := table.Scopes[fn]
+	if scope == nil || scope.Parent != table.Global || scope.Names["b"] == nil || !scope.Function {
+		t.Errorf("wrong function scope %+v", scope)
+	}
+	for _, use := range decl.Uses {
+		if table.Uses[use].Declaration != decl {
+			t.Errorf("use of a at %d:%d not bound to its declaration", use.Token.Line, use.Token.Column)
+		}
+	}
+
+	// names the global scope already has resolve without a declaration
+	program = parse(t, "x + 1")
+	table = Resolve(program, nil, func(name string) bool { return name == "x" })
+	x := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression).Left.(*ast.Identifier)
+	if binding := table.Uses[x]; binding.Kind != Global || binding.Declaration != nil || len(table.Errors) != 0 {
+		t.Errorf("expected a predeclared global, got %+v %v", binding, table.Errors)
+	}
+}
@@ -1,10 +1,16 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type   TokenType
 	Lexeme string
+
+	// where the token starts in the input, both counting from 1
+	Line   int
+	Column int
 }
 
 const (
@@ -22,12 +28,20 @@ const (
 	LT        = "<"
 	GT        = ">"
 	COMMA     = ","
+	COLON     = ":"
+	DOT       = "."
 	EXCLAM    = "!"
 	SEMICOLON = ";"
 	LPAREN    = "("
 	RPAREN    = ")"
 	LBRACE    = "{"
 	RBRACE    = "}"
+	LBRACKET  = "["
+	RBRACKET  = "]"
+	RANGE     = ".."
+	RANGEINCL = "..="
+	QDOT      = "?."
+	COALESCE  = "??"
 	FUNC      = "FUNC"
 	LET       = "LET"
 	IF        = "IF"
@@ -36,16 +50,61 @@ const (
 	TRUE      = "TRUE"
 	FALSE     = "FALSE"
 	STRING    = "STRING"
+	TRY       = "TRY"
+	CATCH     = "CATCH"
+	FINALLY   = "FINALLY"
+	THROW     = "THROW"
+	STRUCT    = "STRUCT"
+	TYPE      = "TYPE"
+	ENUM      = "ENUM"
+	MATCH     = "MATCH"
+	ARROW     = "=>"
+	IMPORT    = "IMPORT"
+	EXPORT    = "EXPORT"
+	AS        = "AS"
+	MACRO     = "MACRO"
+	INFIXL    = "INFIXL"
+	INFIXR    = "INFIXR"
+	OPERATOR  = "OPERATOR"
+	COMMENT   = "COMMENT"
 )
 
 var keywords = map[string]TokenType{
-	"func":   FUNC,
-	"let":    LET,
-	"false":  FALSE,
-	"true":   TRUE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"func":    FUNC,
+	"let":     LET,
+	"false":   FALSE,
+	"true":    TRUE,
+	"if":      IF,
+	"else":    ELSE,
+	"return":  RETURN,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"throw":   THROW,
+	"struct":  STRUCT,
+	"type":    TYPE,
+	"enum":    ENUM,
+	"match":   MATCH,
+	"import":  IMPORT,
+	"export":  EXPORT,
+	"as":      AS,
+	"macro":   MACRO,
+	"infixl":  INFIXL,
+	"infixr":  INFIXR,
+}
+
+// symbols the lexer already turns into their own tokens, which scripts cannot
+// declare as operators
+var builtinOperators = map[string]bool{
+	ASSIGN: true, EQ: true, NEQ: true, PLUS: true, MINUS: true, MULT: true,
+	DIV: true, LT: true, GT: true, COLON: true, DOT: true, EXCLAM: true,
+	RANGE: true, RANGEINCL: true, QDOT: true, COALESCE: true, ARROW: true,
+}
+
+// IsBuiltinOperator reports whether symbol is one of the language's own
+// operators.
+func IsBuiltinOperator(symbol string) bool {
+	return builtinOperators[symbol]
 }
 
 func DetermineTokenType(id string) TokenType {
@@ -54,3 +113,13 @@ func DetermineTokenType(id string) TokenType {
 	}
 	return ID
 }
+
+// RegisterKeyword makes the lexer produce tokenType whenever it reads word,
+// letting embedders add keyword operators such as "in" or "between". It should
+// be called before any input is lexed and panics if word is already a keyword.
+func RegisterKeyword(word string, tokenType TokenType) {
+	if _, found := keywords[word]; found {
+		panic(fmt.Sprintf("token: keyword %q already registered", word))
+	}
+	keywords[word] = tokenType
+}
@@ -0,0 +1,495 @@
+package types
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/resolver"
+	"interpreter/token"
+	"sort"
+)
+
+// Info is the outcome of checking a program.
+type Info struct {
+	// Types has the type of every expression checked
+	Types map[ast.Expression]Type
+	// Errors are "line:column: message", in source order
+	Errors []string
+	// Warnings are the mismatches Check finds in code without annotations,
+	// which may still run, like Errors
+	Warnings []string
+}
+
+type checker struct {
+	table *resolver.Table
+	info  *Info
+
+	// types of declared names
+	names map[*resolver.Declaration]Type
+	// struct and enum names, which annotations may use
+	named map[string]bool
+
+	functions []*function
+	errors    []checkError
+	warnings  []checkError
+}
+
+// function is the function literal being checked
+type function struct {
+	// result is the annotated result, nil when it is inferred from returns
+	result  Type
+	returns []Type
+}
+
+type checkError struct {
+	tok token.Token
+	msg string
+}
+
+// Check checks program, whose names table resolved. Names table has no
+// declaration for, like builtins and globals defined before the program, are
+// Any. Only values breaking an annotation are errors, so unannotated code keeps
+// running, other mismatches are warnings.
+func Check(program ast.Node, table *resolver.Table) *Info {
+	c := &checker{
+		table: table,
+		info:  &Info{Types: map[ast.Expression]Type{}, Errors: []string{}, Warnings: []string{}},
+		names: map[*resolver.Declaration]Type{},
+		named: map[string]bool{},
+	}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.StructStatement:
+			c.named[node.Name.Value] = true
+		case *ast.EnumStatement:
+			c.named[node.Name.Value] = true
+		}
+		return true
+	})
+
+	c.statement(program)
+
+	c.info.Errors = append(c.info.Errors, messages(c.errors)...)
+	c.info.Warnings = append(c.info.Warnings, messages(c.warnings)...)
+	return c.info
+}
+
+// messages formats errs in source order
+func messages(errs []checkError) []string {
+	sort.SliceStable(errs, func(i, j int) bool {
+		a, b := errs[i].tok, errs[j].tok
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	msgs := []string{}
+	for _, err := range errs {
+		msgs = append(msgs, fmt.Sprintf("%d:%d: %s", err.tok.Line, err.tok.Column, err.msg))
+	}
+	return msgs
+}
+
+// errorf reports a value breaking an annotation
+func (c *checker) errorf(tok token.Token, format string, args ...interface{}) {
+	c.errors = append(c.errors, checkError{tok, fmt.Sprintf(format, args...)})
+}
+
+// warnf reports a mismatch between inferred types, which the evaluator may
+// still get through, like an operator error caught by try
+func (c *checker) warnf(tok token.Token, format string, args ...interface{}) {
+	c.warnings = append(c.warnings, checkError{tok, fmt.Sprintf(format, args...)})
+}
+
+// declare gives the name ident declares its type
+func (c *checker) declare(ident *ast.Identifier, t Type) {
+	if decl, ok := c.table.Declarations[ident]; ok {
+		c.names[decl] = t
+	}
+}
+
+// annotation is the type an annotation names
+func (c *checker) annotation(t ast.Type) Type {
+	switch t := t.(type) {
+	case *ast.TypeName:
+		switch Basic(t.Name) {
+		case Any, Int, String, Bool:
+			return Basic(t.Name)
+		}
+		if c.named[t.Name] {
+			return &Named{Name: t.Name}
+		}
+		c.errorf(t.Token, "unknown type %s", t.Name)
+	case *ast.ArrayType:
+		return &Array{Element: c.annotation(t.Element)}
+	case *ast.FunctionType:
+		f := &Function{Result: Any}
+		for _, param := range t.Parameters {
+			f.Parameters = append(f.Parameters, c.annotation(param))
+		}
+		if t.Result != nil {
+			f.Result = c.annotation(t.Result)
+		}
+		return f
+	}
+	return Any
+}
+
+// statement checks stmt and returns the type of the value it leaves, which is
+// Any for statements other than expressions
+func (c *checker) statement(stmt ast.Node) Type {
+	switch stmt := stmt.(type) {
+	case *ast.Program:
+		return c.statements(stmt.Statements)
+	case *ast.StatementBlock:
+		if stmt == nil {
+			return Any
+		}
+		return c.statements(stmt.Statements)
+
+	case *ast.ExpressionStatement:
+		return c.expression(stmt.Expression)
+
+	case *ast.LetStatement:
+		value := c.expression(stmt.Value)
+		if stmt.Type == nil {
+			c.declare(stmt.Name, value)
+			break
+		}
+		declared := c.annotation(stmt.Type)
+		if !Assignable(value, declared) {
+			c.errorf(stmt.Name.Token, "cannot use %s as %s in let %s", value, declared, stmt.Name.Value)
+		}
+		c.declare(stmt.Name, declared)
+
+	case *ast.ReturnStatement:
+		value := c.expression(stmt.Value)
+		if len(c.functions) > 0 {
+			c.returned(stmt.Token, value)
+		}
+
+	case *ast.ThrowStatement:
+		c.expression(stmt.Value)
+
+	case *ast.ExportStatement:
+		c.statement(stmt.Statement)
+
+	case *ast.StructStatement:
+		for _, method := range stmt.Methods {
+			c.expression(method)
+		}
+
+	case *ast.OperatorStatement:
+		c.expression(stmt.Function)
+	}
+	return Any
+}
+
+func (c *checker) statements(statements []ast.Statement) Type {
+	result := Type(Any)
+	for _, stmt := range statements {
+		result = c.statement(stmt)
+	}
+	return result
+}
+
+// returned checks a value leaving the current function
+func (c *checker) returned(tok token.Token, value Type) {
+	fn := c.functions[len(c.functions)-1]
+	if fn.result != nil && !Assignable(value, fn.result) {
+		c.errorf(tok, "cannot return %s from a function returning %s", value, fn.result)
+	}
+	fn.returns = append(fn.returns, value)
+}
+
+func (c *checker) expression(expr ast.Expression) Type {
+	if expr == nil {
+		return Any
+	}
+	t := c.infer(expr)
+	c.info.Types[expr] = t
+	return t
+}
+
+func (c *checker) infer(expr ast.Expression) Type {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.StringLiteral:
+		return String
+	case *ast.BooleanExpression:
+		return Bool
+
+	case *ast.Identifier:
+		if decl := c.table.Uses[expr].Declaration; decl != nil {
+			if t, ok := c.names[decl]; ok {
+				return t
+			}
+		}
+		return Any
+
+	case *ast.ArrayLiteral:
+		var element Type
+		for _, el := range expr.Elements {
+			t := c.expression(el)
+			if element == nil {
+				element = t
+			} else if !Identical(element, t) {
+				element = Any
+			}
+		}
+		if element == nil {
+			element = Any
+		}
+		return &Array{Element: element}
+
+	case *ast.PrefixExpression:
+		value := c.expression(expr.Value)
+		switch expr.Op {
+		case "!":
+			return Bool
+		case "-":
+			if value != Any && value != Int {
+				c.warnf(expr.Token, "unknown operator: -%s", value)
+				return Any
+			}
+			return value
+		}
+		return Any
+
+	case *ast.InfixExpression:
+		return c.infix(expr)
+
+	case *ast.IfExpression:
+		c.expression(expr.Condition)
+		consequence := c.statement(expr.Consequence)
+		if expr.Alternative == nil {
+			return Any
+		}
+		if alternative := c.statement(expr.Alternative); Identical(consequence, alternative) {
+			return consequence
+		}
+		return Any
+
+	case *ast.FunctionLiteral:
+		return c.function(expr)
+
+	case *ast.CallExpression:
+		return c.call(expr)
+
+	case *ast.IndexExpression:
+		left, index := c.expression(expr.Left), c.expression(expr.Index)
+		if index != Any && index != Int {
+			c.warnf(expr.Token, "index must be int, got %s", index)
+		}
+		switch left := left.(type) {
+		case *Array:
+			if !expr.Optional {
+				return left.Element
+			}
+		case Basic:
+			switch left {
+			case String:
+				if !expr.Optional {
+					return String
+				}
+			case Int, Bool:
+				c.warnf(expr.Token, "index operator not supported: %s", left)
+			}
+		case *Function:
+			c.warnf(expr.Token, "index operator not supported: %s", left)
+		}
+		return Any
+
+	case *ast.SliceExpression:
+		left := c.expression(expr.Left)
+		for _, bound := range []ast.Expression{expr.Start, expr.End} {
+			if t := c.expression(bound); t != Any && t != Int {
+				c.warnf(expr.Token, "slice bounds must be int, got %s", t)
+			}
+		}
+		if _, ok := left.(*Array); (ok || left == String) && !expr.Optional {
+			return left
+		}
+		return Any
+
+	case *ast.RangeExpression:
+		start, end := c.expression(expr.Start), c.expression(expr.End)
+		if start != Any && start != Int || end != Any && end != Int {
+			c.warnf(expr.Token, "range bounds must be int, got %s%s%s", start, expr.Token.Lexeme, end)
+		}
+		return Any
+
+	case *ast.AssignExpression:
+		c.expression(expr.Target)
+		return c.expression(expr.Value)
+
+	case *ast.StructLiteral:
+		for _, value := range expr.Values {
+			c.expression(value)
+		}
+		if name, ok := expr.Name.(*ast.Identifier); ok && c.named[name.Value] {
+			return &Named{Name: name.Value}
+		}
+		return Any
+
+	case *ast.MemberExpression:
+		c.expression(expr.Object)
+		return Any
+
+	case *ast.TryExpression:
+		c.statement(expr.Block)
+		c.statement(expr.Catch)
+		c.statement(expr.Finally)
+		return Any
+
+	case *ast.MatchExpression:
+		c.expression(expr.Subject)
+		for _, arm := range expr.Arms {
+			c.statement(arm.Body)
+		}
+		return Any
+	}
+
+	// macros, whose bodies are code to expand, and nodes this package doesn't
+	// know
+	return Any
+}
+
+// infix follows the evaluator: both sides have to be the same type unless
+// the left one is an instance, which may define the operator
+func (c *checker) infix(expr *ast.InfixExpression) Type {
+	left, right := c.expression(expr.Left), c.expression(expr.Right)
+
+	switch {
+	case expr.Token.Type == token.OPERATOR:
+		return Any
+	case expr.Op == "??":
+		if Identical(left, right) {
+			return left
+		}
+		return Any
+	}
+	if _, ok := left.(*Named); ok || left == Any {
+		return Any
+	}
+
+	comparison := false
+	switch expr.Op {
+	case "<", ">", "<=", ">=", "==", "!=":
+		comparison = true
+	case "+", "-", "*", "/":
+	default:
+		return Any
+	}
+	if right == Any {
+		if comparison {
+			return Bool
+		}
+		if left == Int || left == String {
+			return left
+		}
+		return Any
+	}
+
+	switch {
+	case !Identical(left, right):
+		c.warnf(expr.Token, "type mismatch: %s %s %s", left, expr.Op, right)
+	case left == Int && comparison:
+		return Bool
+	case left == Int:
+		return Int
+	case left == String && expr.Op == "+":
+		return String
+	case expr.Op == "==" || expr.Op == "!=":
+		return Bool
+	default:
+		c.warnf(expr.Token, "unknown operator: %s %s %s", left, expr.Op, right)
+	}
+	return Any
+}
+
+// function checks the body of fn and returns its type. Parameters without
+// annotations are Any, the result without one is the type every return and
+// the last statement agree on.
+func (c *checker) function(fn *ast.FunctionLiteral) Type {
+	t := &Function{Parameters: []Type{}}
+	for i, param := range fn.Parameters {
+		paramType := Type(Any)
+		if i < len(fn.ParameterTypes) && fn.ParameterTypes[i] != nil {
+			paramType = c.annotation(fn.ParameterTypes[i])
+		}
+		c.declare(param, paramType)
+		t.Parameters = append(t.Parameters, paramType)
+	}
+
+	f := &function{}
+	if fn.Result != nil {
+		f.result = c.annotation(fn.Result)
+	}
+	c.functions = append(c.functions, f)
+	last := c.statement(fn.Body)
+	switch stmt := lastStatement(fn.Body).(type) {
+	case *ast.ExpressionStatement:
+		c.returned(stmt.Token, last)
+	case *ast.ReturnStatement:
+	default:
+		// the body may end without a value
+		f.returns = append(f.returns, Any)
+	}
+	c.functions = c.functions[:len(c.functions)-1]
+
+	t.Result = f.result
+	if t.Result == nil {
+		t.Result = Any
+		for i, r := range f.returns {
+			if i == 0 {
+				t.Result = r
+			} else if !Identical(t.Result, r) {
+				t.Result = Any
+			}
+		}
+	}
+	return t
+}
+
+func lastStatement(block *ast.StatementBlock) ast.Statement {
+	if block == nil || len(block.Statements) == 0 {
+		return nil
+	}
+	return block.Statements[len(block.Statements)-1]
+}
+
+func (c *checker) call(call *ast.CallExpression) Type {
+	if call.Function.TokenLexeme() == "quote" {
+		// quoted code is data
+		return Any
+	}
+
+	callee := c.expression(call.Function)
+	args := []Type{}
+	for _, arg := range call.Arguments {
+		args = append(args, c.expression(arg))
+	}
+
+	switch callee := callee.(type) {
+	case *Function:
+		if len(args) != len(callee.Parameters) {
+			c.warnf(call.Token, "wrong number of arguments: want=%d, got=%d", len(callee.Parameters), len(args))
+			return Any
+		}
+		for i, arg := range args {
+			if !Assignable(arg, callee.Parameters[i]) {
+				c.errorf(call.Token, "cannot use %s as %s in argument %d", arg, callee.Parameters[i], i+1)
+			}
+		}
+		if call.Optional {
+			return Any
+		}
+		return callee.Result
+	case *Array:
+		c.warnf(call.Token, "not a function: %s", callee)
+	case Basic:
+		if callee != Any {
+			c.warnf(call.Token, "not a function: %s", callee)
+		}
+	}
+	return Any
+}
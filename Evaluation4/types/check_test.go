@@ -0,0 +1,139 @@
+package types
+
+import (
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"interpreter/resolver"
+	"strings"
+	"testing"
+)
+
+func check(t *testing.T, input string) (*ast.Program, *Info) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	table := resolver.Resolve(program, func(name string) bool { return name == "len" || name == "puts" }, nil)
+	if len(table.Errors) != 0 {
+		t.Fatalf("resolver errors for %q: %v", input, table.Errors)
+	}
+	return program, Check(program, table)
+}
+
+func TestInference(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1", "int"},
+		{"\"a\" + \"b\"", "string"},
+		{"1 < 2", "bool"},
+		{"!1", "bool"},
+		{"[1, 2]", "[int]"},
+		{"[1, \"a\"]", "[any]"},
+		{"[]", "[any]"},
+		{"[[1]][0]", "[int]"},
+		{"\"abc\"[1]", "string"},
+		{"let x = 1; x", "int"},
+		{"let x: any = 1; x", "any"},
+		{"if (true) { 1 } else { 2 }", "int"},
+		{"if (true) { 1 } else { \"a\" }", "any"},
+		{"if (true) { 1 }", "any"},
+		{"func(a: int, b) { a }", "func(int, any): int"},
+		{"func(a) { if (a) { return 1 }; 2 }", "func(any): int"},
+		{"func(a) { if (a) { return 1 }; \"a\" }", "func(any): any"},
+		{"func(a) { if (a) { return 1 }; let b = 2; }", "func(any): any"},
+		{"func(): [string] { [] }", "func(): [string]"},
+		{"let f = func(a: int): string { \"\" }; f(1)", "string"},
+		{"let f = func(g: func(int): bool) { g(1) }; f", "func(func(int): bool): bool"},
+		{"struct P { x } P{x: 1}", "P"},
+		{"len(\"a\")", "any"},
+		{"let p = 1; p.x", "any"},
+	}
+
+	for _, tt := range tests {
+		program, info := check(t, tt.input)
+		if len(info.Errors) != 0 {
+			t.Errorf("unexpected errors for %q: %v", tt.input, info.Errors)
+			continue
+		}
+		last := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement)
+		if got := info.Types[last.Expression]; got.String() != tt.expected {
+			t.Errorf("wrong type of %q. expected=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+		warnings []string
+	}{
+		{"\"a\" + 1", nil, []string{"1:5: type mismatch: string + int"}},
+		{"let s = \"a\"; let n = 1; s == n", nil, []string{"1:27: type mismatch: string == int"}},
+		{"true + false; -\"a\"", nil, []string{"1:6: unknown operator: bool + bool", "1:15: unknown operator: -string"}},
+		{"1(2); let xs = [1]; xs()", nil, []string{"1:2: not a function: int", "1:23: not a function: [int]"}},
+		{"1[0]; [1][\"a\"]", nil, []string{"1:2: index operator not supported: int", "1:10: index must be int, got string"}},
+		{"let x: int = \"a\";", []string{"1:5: cannot use string as int in let x"}, nil},
+		{"let x: [int] = [1, \"a\"]; let y: [int] = [\"a\"]", []string{"1:30: cannot use [string] as [int] in let y"}, nil},
+		{"let f = func(a: string, b: [int]): bool { a == \"\" }; f(1, [2]); f(\"a\")",
+			[]string{"1:55: cannot use int as string in argument 1"},
+			[]string{"1:66: wrong number of arguments: want=2, got=1"}},
+		{"let f = func(a): int { if (a) { return \"a\" }; 1 }", []string{"1:33: cannot return string from a function returning int"}, nil},
+		{"let f = func(): int { \"a\" }", []string{"1:23: cannot return string from a function returning int"}, nil},
+		{"let g: func(int): int = func(a: string): int { 1 }", []string{"1:5: cannot use func(string): int as func(int): int in let g"}, nil},
+		{"let p: Point = 1", []string{"1:8: unknown type Point"}, nil},
+		{"struct P { x; func f(self, d: int): int { d } } let p: P = P{x: 1}; p + 1", nil, nil},
+		{"1..\"a\"", nil, []string{"1:2: range bounds must be int, got int..string"}},
+		{"let a = 1; let f = func(x) { x + a }; f(\"s\") + a", nil, nil},
+		{"let m = macro(a) { quote(1 + \"a\") }", nil, nil},
+		{"infixl 6 <+> = func(a, b) { a }; 1 <+> \"a\"", nil, nil},
+		{"null ?? 1", nil, nil},
+		// unannotated code which only fails at runtime, here in a try, still runs
+		{"puts(try { \"a\" + 1 } catch (e) { 0 });", nil, []string{"1:16: type mismatch: string + int"}},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, p.Errors())
+		}
+		info := Check(program, resolver.Resolve(program, nil, func(string) bool { return true }))
+		if strings.Join(info.Errors, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong errors for %q.\nexpected=%q\ngot=%q", tt.input, tt.expected, info.Errors)
+		}
+		if strings.Join(info.Warnings, "\n") != strings.Join(tt.warnings, "\n") {
+			t.Errorf("wrong warnings for %q.\nexpected=%q\ngot=%q", tt.input, tt.warnings, info.Warnings)
+		}
+	}
+}
+
+func TestAssignable(t *testing.T) {
+	ints := &Array{Element: Int}
+	tests := []struct {
+		from, to Type
+		expected bool
+	}{
+		{Int, Int, true},
+		{Int, String, false},
+		{Any, Int, true},
+		{Int, Any, true},
+		{ints, &Array{Element: Any}, true},
+		{&Array{Element: Any}, ints, true},
+		{ints, &Array{Element: String}, false},
+		{&Function{Parameters: []Type{Any}, Result: Int}, &Function{Parameters: []Type{String}, Result: Int}, true},
+		{&Function{Parameters: []Type{Int}, Result: Int}, &Function{Parameters: []Type{Int, Int}, Result: Int}, false},
+		{&Named{Name: "P"}, &Named{Name: "P"}, true},
+		{&Named{Name: "P"}, &Named{Name: "Q"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := Assignable(tt.from, tt.to); got != tt.expected {
+			t.Errorf("Assignable(%s, %s) = %t, expected %t", tt.from, tt.to, got, tt.expected)
+		}
+	}
+}
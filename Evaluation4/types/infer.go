@@ -0,0 +1,960 @@
+package types
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/format"
+	"interpreter/resolver"
+	"interpreter/token"
+	"strings"
+)
+
+// Strict mode infers a type for every expression with Hindley-Milner
+// inference instead of checking gradually: there is no Any, a name declared
+// by a let is polymorphic over the type variables its value leaves free, and
+// every use of a value has to agree with every other. A file opts in with a
+// comment holding only the Pragma.
+//
+// Builtins, imported modules and globals without a known type get a new type
+// variable at every use, so they are not checked.
+
+// Pragma is the comment that turns on strict mode for a file.
+const Pragma = "monkey:strict"
+
+// HasPragma reports whether one of comments is the Pragma.
+func HasPragma(comments []token.Token) bool {
+	for _, comment := range comments {
+		if strings.TrimSpace(strings.TrimPrefix(comment.Lexeme, "//")) == Pragma {
+			return true
+		}
+	}
+	return false
+}
+
+// Null is the type of an if without else and of a block without a value at
+// its end, which strict mode doesn't let mix with other types.
+const Null Basic = "null"
+
+// Var is a type variable, Instance is set once it is unified with a type.
+type Var struct {
+	ID       int
+	Instance Type
+
+	// level is how many lets the variable was made inside of, variables from
+	// deeper than a let are generalized by it
+	level int
+}
+
+func (v *Var) String() string {
+	if v.Instance != nil {
+		return v.Instance.String()
+	}
+	return fmt.Sprintf("'t%d", v.ID)
+}
+
+// Scheme is a type generalized over Vars, like func('a): 'a for the identity
+// function, which every use instantiates with new variables.
+type Scheme struct {
+	Vars []*Var
+	Type Type
+}
+
+// Env carries what strict mode knows about global names from one program to
+// the next, like from one console line to the next.
+type Env struct {
+	globals map[string]*Scheme
+	structs map[string]*structInfo
+	enums   map[string]*enumInfo
+	vars    int
+}
+
+func NewEnv() *Env {
+	return &Env{
+		globals: map[string]*Scheme{},
+		structs: map[string]*structInfo{},
+		enums:   map[string]*enumInfo{},
+	}
+}
+
+// Clone returns a copy of e that programs can be inferred in without changing
+// e, like an expression whose type is asked for. The variables not unified yet
+// are copied too.
+func (e *Env) Clone() *Env {
+	clone := &Env{
+		globals: map[string]*Scheme{},
+		structs: map[string]*structInfo{},
+		enums:   map[string]*enumInfo{},
+		vars:    e.vars,
+	}
+	copies := map[*Var]Type{}
+	copyOf := func(t Type) Type {
+		copyVars(t, copies)
+		return substitute(t, copies)
+	}
+
+	for name, scheme := range e.globals {
+		s := &Scheme{Type: copyOf(scheme.Type)}
+		for _, v := range scheme.Vars {
+			s.Vars = append(s.Vars, copyOf(v).(*Var))
+		}
+		clone.globals[name] = s
+	}
+	for name, info := range e.structs {
+		s := &structInfo{name: info.name, fields: map[string]Type{}, methods: map[string]*Function{}}
+		for field, t := range info.fields {
+			s.fields[field] = copyOf(t)
+		}
+		for method, f := range info.methods {
+			s.methods[method] = copyOf(f).(*Function)
+		}
+		clone.structs[name] = s
+	}
+	for name, info := range e.enums {
+		en := &enumInfo{name: info.name, variants: map[string]*variantInfo{}}
+		for variant, v := range info.variants {
+			c := &variantInfo{names: v.names, constructor: v.constructor}
+			for _, field := range v.fields {
+				c.fields = append(c.fields, copyOf(field))
+			}
+			en.variants[variant] = c
+		}
+		clone.enums[name] = en
+	}
+	return clone
+}
+
+// copyVars adds a copy of each variable of t that is not unified yet to copies
+func copyVars(t Type, copies map[*Var]Type) {
+	switch t := prune(t).(type) {
+	case *Var:
+		if _, ok := copies[t]; !ok {
+			copies[t] = &Var{ID: t.ID, level: t.level}
+		}
+	case *Array:
+		copyVars(t.Element, copies)
+	case *Function:
+		for _, p := range t.Parameters {
+			copyVars(p, copies)
+		}
+		copyVars(t.Result, copies)
+	}
+}
+
+// fields and methods of a struct have one type for all instances
+type structInfo struct {
+	name    string
+	fields  map[string]Type
+	methods map[string]*Function
+}
+
+type enumInfo struct {
+	name     string
+	variants map[string]*variantInfo
+}
+
+type variantInfo struct {
+	fields []Type
+	names  []string
+	// constructor is false for variants that are values
+	constructor bool
+}
+
+type inference struct {
+	env   *Env
+	table *resolver.Table
+	info  *Info
+
+	names map[*resolver.Declaration]*Scheme
+	// the struct or enum a declaration names
+	declared map[*resolver.Declaration]string
+	// declared operators
+	operators map[string]Type
+	level     int
+	results   []Type
+	errors    []checkError
+}
+
+var operatorMethods = map[string]string{
+	"+": "__add__", "-": "__sub__", "*": "__mul__", "/": "__div__",
+	"<": "__lt__", ">": "__gt__", "==": "__eq__", "!=": "__eq__",
+}
+
+// Infer infers the types of program, whose names table resolved, in strict
+// mode. The global names it declares are kept in e for the next program if
+// there are no errors, and forgotten otherwise.
+func (e *Env) Infer(program ast.Node, table *resolver.Table) *Info {
+	in := &inference{
+		env:       e,
+		table:     table,
+		info:      &Info{Types: map[ast.Expression]Type{}, Errors: []string{}},
+		names:     map[*resolver.Declaration]*Scheme{},
+		declared:  map[*resolver.Declaration]string{},
+		operators: map[string]Type{},
+	}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.StructStatement:
+			in.declareStruct(node)
+		case *ast.EnumStatement:
+			in.declareEnum(node)
+		}
+		return true
+	})
+
+	in.statement(program)
+
+	for expr, t := range in.info.Types {
+		in.info.Types[expr] = Resolve(t)
+	}
+	in.info.Errors = append(in.info.Errors, messages(in.errors)...)
+
+	for name, decl := range table.Global.Names {
+		if scheme, ok := in.names[decl]; ok && len(in.errors) == 0 {
+			e.globals[name] = scheme
+		} else {
+			delete(e.globals, name)
+		}
+	}
+	return in.info
+}
+
+func (in *inference) errorf(tok token.Token, format string, args ...interface{}) {
+	in.errors = append(in.errors, checkError{tok, fmt.Sprintf(format, args...)})
+}
+
+func (in *inference) fresh() *Var {
+	in.env.vars++
+	return &Var{ID: in.env.vars, level: in.level}
+}
+
+func (in *inference) declareStruct(stmt *ast.StructStatement) {
+	info := &structInfo{name: stmt.Name.Value, fields: map[string]Type{}, methods: map[string]*Function{}}
+	saved := in.level
+	in.level = 0
+	for _, field := range stmt.Fields {
+		info.fields[field.Value] = in.fresh()
+	}
+	for _, method := range stmt.Methods {
+		f := &Function{Result: in.fresh()}
+		for range method.Parameters {
+			f.Parameters = append(f.Parameters, in.fresh())
+		}
+		info.methods[method.Name] = f
+	}
+	in.level = saved
+	in.env.structs[info.name] = info
+	in.declared[in.table.Declarations[stmt.Name]] = info.name
+}
+
+func (in *inference) declareEnum(stmt *ast.EnumStatement) {
+	info := &enumInfo{name: stmt.Name.Value, variants: map[string]*variantInfo{}}
+	saved := in.level
+	in.level = 0
+	for _, v := range stmt.Variants {
+		variant := &variantInfo{constructor: v.Fields != nil}
+		for _, field := range v.Fields {
+			variant.fields = append(variant.fields, in.fresh())
+			variant.names = append(variant.names, field.Value)
+		}
+		info.variants[v.Name.Value] = variant
+	}
+	in.level = saved
+	in.env.enums[info.name] = info
+	in.declared[in.table.Declarations[stmt.Name]] = info.name
+}
+
+// unify makes a and b the same type or reports that they can't be at tok
+func (in *inference) unify(tok token.Token, a, b Type, context ast.Node) {
+	if err := unify(a, b); err != "" {
+		names := namer{}
+		msg := fmt.Sprintf("cannot unify %s with %s", names.describe(a), names.describe(b))
+		if err != "mismatch" {
+			msg += ": " + err
+		}
+		in.errorf(tok, "%s in %s", msg, excerpt(context))
+	}
+}
+
+// excerpt is the source of node in error messages, cut after 40 bytes or the
+// first line
+func excerpt(node ast.Node) string {
+	s, _, cut := strings.Cut(format.Node(node, format.Config{}), "\n")
+	if len(s) > 40 {
+		s, cut = s[:37], true
+	}
+	if cut {
+		s += "..."
+	}
+	return s
+}
+
+func prune(t Type) Type {
+	for {
+		v, ok := t.(*Var)
+		if !ok || v.Instance == nil {
+			return t
+		}
+		t = v.Instance
+	}
+}
+
+// unify returns "" when it made a and b the same type
+func unify(a, b Type) string {
+	a, b = prune(a), prune(b)
+	if _, ok := b.(*Var); ok {
+		a, b = b, a
+	}
+
+	switch a := a.(type) {
+	case *Var:
+		if a == b {
+			return ""
+		}
+		if occurs(a, b) {
+			return "the type would contain itself"
+		}
+		lower(b, a.level)
+		a.Instance = b
+		return ""
+	case Basic:
+		if a == b {
+			return ""
+		}
+	case *Array:
+		if b, ok := b.(*Array); ok {
+			return unify(a.Element, b.Element)
+		}
+	case *Function:
+		b, ok := b.(*Function)
+		if !ok {
+			break
+		}
+		if len(a.Parameters) != len(b.Parameters) {
+			return fmt.Sprintf("%d parameters and %d", len(a.Parameters), len(b.Parameters))
+		}
+		for i := range a.Parameters {
+			if err := unify(a.Parameters[i], b.Parameters[i]); err != "" {
+				return err
+			}
+		}
+		return unify(a.Result, b.Result)
+	case *Named:
+		if b, ok := b.(*Named); ok && a.Name == b.Name {
+			return ""
+		}
+	}
+	return "mismatch"
+}
+
+func occurs(v *Var, t Type) bool {
+	switch t := prune(t).(type) {
+	case *Var:
+		return t == v
+	case *Array:
+		return occurs(v, t.Element)
+	case *Function:
+		for _, p := range t.Parameters {
+			if occurs(v, p) {
+				return true
+			}
+		}
+		return occurs(v, t.Result)
+	}
+	return false
+}
+
+// lower keeps the variables of t from being generalized deeper than level
+func lower(t Type, level int) {
+	switch t := prune(t).(type) {
+	case *Var:
+		if t.level > level {
+			t.level = level
+		}
+	case *Array:
+		lower(t.Element, level)
+	case *Function:
+		for _, p := range t.Parameters {
+			lower(p, level)
+		}
+		lower(t.Result, level)
+	}
+}
+
+// generalize makes a scheme of t over the variables made inside the let
+// being left
+func (in *inference) generalize(t Type) *Scheme {
+	scheme := &Scheme{Type: t}
+	seen := map[*Var]bool{}
+	var collect func(t Type)
+	collect = func(t Type) {
+		switch t := prune(t).(type) {
+		case *Var:
+			if t.level > in.level && !seen[t] {
+				seen[t] = true
+				scheme.Vars = append(scheme.Vars, t)
+			}
+		case *Array:
+			collect(t.Element)
+		case *Function:
+			for _, p := range t.Parameters {
+				collect(p)
+			}
+			collect(t.Result)
+		}
+	}
+	collect(t)
+	return scheme
+}
+
+func (in *inference) instantiate(scheme *Scheme) Type {
+	if len(scheme.Vars) == 0 {
+		return scheme.Type
+	}
+	fresh := map[*Var]Type{}
+	for _, v := range scheme.Vars {
+		fresh[v] = in.fresh()
+	}
+	return substitute(scheme.Type, fresh)
+}
+
+func substitute(t Type, vars map[*Var]Type) Type {
+	switch t := prune(t).(type) {
+	case *Var:
+		if s, ok := vars[t]; ok {
+			return s
+		}
+		return t
+	case *Array:
+		return &Array{Element: substitute(t.Element, vars)}
+	case *Function:
+		f := &Function{Result: substitute(t.Result, vars)}
+		for _, p := range t.Parameters {
+			f.Parameters = append(f.Parameters, substitute(p, vars))
+		}
+		return f
+	default:
+		return t
+	}
+}
+
+// Resolve replaces the variables in t that were unified by their types.
+func Resolve(t Type) Type {
+	return substitute(t, nil)
+}
+
+// Describe writes t with its variables named 'a, 'b and so on in the order
+// they appear.
+func Describe(t Type) string {
+	return namer{}.describe(t)
+}
+
+// namer names variables across the types of one message
+type namer map[*Var]string
+
+func (n namer) describe(t Type) string {
+	switch t := prune(t).(type) {
+	case *Var:
+		if _, ok := n[t]; !ok {
+			name := string(rune('a' + len(n)%26))
+			if len(n) >= 26 {
+				name += fmt.Sprint(len(n) / 26)
+			}
+			n[t] = "'" + name
+		}
+		return n[t]
+	case *Array:
+		return "[" + n.describe(t.Element) + "]"
+	case *Function:
+		params := []string{}
+		for _, p := range t.Parameters {
+			params = append(params, n.describe(p))
+		}
+		return fmt.Sprintf("func(%s): %s", strings.Join(params, ", "), n.describe(t.Result))
+	default:
+		return t.String()
+	}
+}
+
+// annotation is the type an annotation names, any is a new variable
+func (in *inference) annotation(t ast.Type) Type {
+	switch t := t.(type) {
+	case *ast.TypeName:
+		switch Basic(t.Name) {
+		case Int, String, Bool:
+			return Basic(t.Name)
+		case Any:
+			return in.fresh()
+		}
+		if in.env.structs[t.Name] != nil || in.env.enums[t.Name] != nil {
+			return &Named{Name: t.Name}
+		}
+		in.errorf(t.Token, "unknown type %s", t.Name)
+	case *ast.ArrayType:
+		return &Array{Element: in.annotation(t.Element)}
+	case *ast.FunctionType:
+		f := &Function{Parameters: []Type{}}
+		for _, param := range t.Parameters {
+			f.Parameters = append(f.Parameters, in.annotation(param))
+		}
+		if t.Result != nil {
+			f.Result = in.annotation(t.Result)
+		} else {
+			f.Result = in.fresh()
+		}
+		return f
+	}
+	return in.fresh()
+}
+
+func (in *inference) declare(ident *ast.Identifier, t Type) {
+	if decl, ok := in.table.Declarations[ident]; ok {
+		in.names[decl] = &Scheme{Type: t}
+	}
+}
+
+// statement infers stmt and returns the type of the value it leaves
+func (in *inference) statement(stmt ast.Node) Type {
+	switch stmt := stmt.(type) {
+	case *ast.Program:
+		return in.statements(stmt.Statements)
+	case *ast.StatementBlock:
+		return in.statements(stmt.Statements)
+
+	case *ast.ExpressionStatement:
+		return in.expression(stmt.Expression)
+
+	case *ast.LetStatement:
+		in.let(stmt)
+
+	case *ast.ReturnStatement:
+		value := in.expression(stmt.Value)
+		if len(in.results) > 0 {
+			in.unify(stmt.Token, in.results[len(in.results)-1], value, stmt)
+		}
+
+	case *ast.ThrowStatement:
+		in.expression(stmt.Value)
+
+	case *ast.ExportStatement:
+		in.statement(stmt.Statement)
+
+	case *ast.ImportStatement:
+		// modules are not inferred, their members are new variables
+		if stmt.Alias != nil {
+			in.declare(stmt.Alias, in.fresh())
+		}
+
+	case *ast.StructStatement:
+		info := in.env.structs[stmt.Name.Value]
+		for _, method := range stmt.Methods {
+			t := in.function(method)
+			in.unify(method.Token, info.methods[method.Name], t, method)
+			if len(method.Parameters) > 0 {
+				in.unify(method.Parameters[0].Token, &Named{Name: info.name}, t.Parameters[0], method)
+			}
+		}
+
+	case *ast.OperatorStatement:
+		in.operators[stmt.Operator] = in.expression(stmt.Function)
+	}
+	return Null
+}
+
+func (in *inference) statements(statements []ast.Statement) Type {
+	result := Type(Null)
+	for _, stmt := range statements {
+		result = in.statement(stmt)
+	}
+	return result
+}
+
+// let generalizes the type of its value, a function value may call itself
+func (in *inference) let(stmt *ast.LetStatement) {
+	decl := in.table.Declarations[stmt.Name]
+
+	in.level++
+	self := in.fresh()
+	if _, forward := in.names[decl]; forward {
+		// used before the let by a function, which fixed its type
+		self = in.names[decl].Type.(*Var)
+	} else {
+		in.names[decl] = &Scheme{Type: self}
+	}
+	value := in.expression(stmt.Value)
+	in.unify(stmt.Name.Token, self, value, stmt)
+	if stmt.Type != nil {
+		in.unify(stmt.Name.Token, in.annotation(stmt.Type), value, stmt)
+	}
+	in.level--
+
+	in.names[decl] = in.generalize(value)
+}
+
+func (in *inference) expression(expr ast.Expression) Type {
+	if expr == nil {
+		return in.fresh()
+	}
+	t := in.infer(expr)
+	in.info.Types[expr] = t
+	return t
+}
+
+func (in *inference) infer(expr ast.Expression) Type {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.StringLiteral:
+		return String
+	case *ast.BooleanExpression:
+		return Bool
+
+	case *ast.Identifier:
+		return in.identifier(expr)
+
+	case *ast.ArrayLiteral:
+		element := Type(in.fresh())
+		for _, el := range expr.Elements {
+			in.unify(expr.Token, element, in.expression(el), expr)
+		}
+		return &Array{Element: element}
+
+	case *ast.PrefixExpression:
+		value := in.expression(expr.Value)
+		switch expr.Op {
+		case "!":
+			return Bool
+		case "-":
+			in.unify(expr.Token, Int, value, expr)
+			return Int
+		}
+		return in.fresh()
+
+	case *ast.InfixExpression:
+		return in.infix(expr)
+
+	case *ast.IfExpression:
+		in.unify(expr.Token, Bool, in.expression(expr.Condition), expr.Condition)
+		consequence := in.statement(expr.Consequence)
+		if expr.Alternative == nil {
+			in.unify(expr.Token, Null, consequence, expr)
+			return Null
+		}
+		in.unify(expr.Token, consequence, in.statement(expr.Alternative), expr)
+		return consequence
+
+	case *ast.FunctionLiteral:
+		return in.function(expr)
+
+	case *ast.CallExpression:
+		if expr.Function.TokenLexeme() == "quote" {
+			return in.fresh()
+		}
+		callee := in.expression(expr.Function)
+		args := []Type{}
+		for _, arg := range expr.Arguments {
+			args = append(args, in.expression(arg))
+		}
+		result := in.fresh()
+		in.unify(expr.Token, callee, &Function{Parameters: args, Result: result}, expr)
+		return result
+
+	case *ast.IndexExpression:
+		left := in.expression(expr.Left)
+		in.unify(expr.Token, Int, in.expression(expr.Index), expr)
+		if prune(left) == String {
+			return String
+		}
+		element := in.fresh()
+		in.unify(expr.Token, &Array{Element: element}, left, expr)
+		return element
+
+	case *ast.SliceExpression:
+		left := in.expression(expr.Left)
+		for _, bound := range []ast.Expression{expr.Start, expr.End} {
+			if bound != nil {
+				in.unify(expr.Token, Int, in.expression(bound), expr)
+			}
+		}
+		if prune(left) != String {
+			in.unify(expr.Token, &Array{Element: in.fresh()}, left, expr)
+		}
+		return left
+
+	case *ast.RangeExpression:
+		in.unify(expr.Token, Int, in.expression(expr.Start), expr)
+		in.unify(expr.Token, Int, in.expression(expr.End), expr)
+		return &Array{Element: Int}
+
+	case *ast.AssignExpression:
+		target := in.expression(expr.Target)
+		value := in.expression(expr.Value)
+		in.unify(expr.Token, target, value, expr)
+		return value
+
+	case *ast.StructLiteral:
+		return in.structLiteral(expr)
+
+	case *ast.MemberExpression:
+		return in.member(expr)
+
+	case *ast.TryExpression:
+		block := in.statement(expr.Block)
+		if expr.Catch != nil {
+			if expr.CatchParam != nil {
+				in.declare(expr.CatchParam, in.fresh())
+			}
+			in.unify(expr.Token, block, in.statement(expr.Catch), expr)
+		}
+		if expr.Finally != nil {
+			in.statement(expr.Finally)
+		}
+		return block
+
+	case *ast.MatchExpression:
+		return in.match(expr)
+	}
+
+	// macros, whose bodies are code to expand, and nodes this package doesn't
+	// know
+	return in.fresh()
+}
+
+func (in *inference) identifier(ident *ast.Identifier) Type {
+	binding, ok := in.table.Uses[ident]
+	if !ok {
+		return in.fresh()
+	}
+	if binding.Declaration == nil {
+		if scheme, ok := in.env.globals[ident.Value]; ok {
+			return in.instantiate(scheme)
+		}
+		return in.fresh()
+	}
+	if scheme, ok := in.names[binding.Declaration]; ok {
+		return in.instantiate(scheme)
+	}
+	if _, ok := in.declared[binding.Declaration]; ok {
+		// a struct or enum, which is only used through its members
+		return in.fresh()
+	}
+
+	// a function using a let declared after it
+	saved := in.level
+	in.level = 0
+	v := in.fresh()
+	in.level = saved
+	in.names[binding.Declaration] = &Scheme{Type: v}
+	return v
+}
+
+// infix follows the evaluator: + adds integers or joins strings, the other
+// arithmetic and ordering take integers, an instance with an operator method
+// takes what the method does
+func (in *inference) infix(expr *ast.InfixExpression) Type {
+	left, right := in.expression(expr.Left), in.expression(expr.Right)
+
+	if expr.Token.Type == token.OPERATOR {
+		result := in.fresh()
+		if fn, ok := in.operators[expr.Op]; ok {
+			in.unify(expr.Token, fn, &Function{Parameters: []Type{left, right}, Result: result}, expr)
+		}
+		return result
+	}
+	if named, ok := prune(left).(*Named); ok {
+		if info := in.env.structs[named.Name]; info != nil {
+			if method, ok := info.methods[operatorMethods[expr.Op]]; ok {
+				result := in.fresh()
+				in.unify(expr.Token, method, &Function{Parameters: []Type{left, right}, Result: result}, expr)
+				if expr.Op == "!=" {
+					return Bool
+				}
+				return result
+			}
+		}
+	}
+
+	switch expr.Op {
+	case "+":
+		in.unify(expr.Token, left, right, expr)
+		if prune(left) == String {
+			return String
+		}
+		in.unify(expr.Token, Int, left, expr)
+		return Int
+	case "-", "*", "/":
+		in.unify(expr.Token, Int, left, expr)
+		in.unify(expr.Token, Int, right, expr)
+		return Int
+	case "<", ">", "<=", ">=":
+		in.unify(expr.Token, Int, left, expr)
+		in.unify(expr.Token, Int, right, expr)
+		return Bool
+	case "==", "!=":
+		in.unify(expr.Token, left, right, expr)
+		return Bool
+	case "??":
+		in.unify(expr.Token, left, right, expr)
+		return left
+	}
+	return in.fresh()
+}
+
+// function infers a function literal, parameters without annotations get new
+// variables
+func (in *inference) function(fn *ast.FunctionLiteral) *Function {
+	t := &Function{Parameters: []Type{}, Result: in.fresh()}
+	for i, param := range fn.Parameters {
+		paramType := Type(in.fresh())
+		if i < len(fn.ParameterTypes) && fn.ParameterTypes[i] != nil {
+			paramType = in.annotation(fn.ParameterTypes[i])
+		}
+		in.declare(param, paramType)
+		t.Parameters = append(t.Parameters, paramType)
+	}
+	if fn.Result != nil {
+		t.Result = in.annotation(fn.Result)
+	}
+
+	in.results = append(in.results, t.Result)
+	last := in.statement(fn.Body)
+	in.results = in.results[:len(in.results)-1]
+	if _, ok := lastStatement(fn.Body).(*ast.ReturnStatement); !ok {
+		in.unify(fn.Token, t.Result, last, fn)
+	}
+	return t
+}
+
+func (in *inference) structLiteral(expr *ast.StructLiteral) Type {
+	name, ok := expr.Name.(*ast.Identifier)
+	var info *structInfo
+	if ok {
+		info = in.env.structs[name.Value]
+	}
+	if info == nil {
+		for _, value := range expr.Values {
+			in.expression(value)
+		}
+		in.errorf(expr.Token, "unknown struct %s", expr.Name)
+		return in.fresh()
+	}
+
+	for i, field := range expr.Fields {
+		value := in.expression(expr.Values[i])
+		if t, ok := info.fields[field.Value]; ok {
+			in.unify(field.Token, t, value, expr)
+		} else {
+			in.errorf(field.Token, "unknown field %s in struct %s", field.Value, info.name)
+		}
+	}
+	return &Named{Name: info.name}
+}
+
+// member looks fields and methods up in the struct or enum of the object, or
+// a variant in the enum named by it. An object of unknown type is taken to be
+// the only struct with that member.
+func (in *inference) member(expr *ast.MemberExpression) Type {
+	name := expr.Member.Value
+
+	if ident, ok := expr.Object.(*ast.Identifier); ok {
+		if decl := in.table.Uses[ident].Declaration; decl != nil {
+			if enum := in.env.enums[in.declared[decl]]; enum != nil {
+				variant, ok := enum.variants[name]
+				if !ok {
+					in.errorf(expr.Member.Token, "unknown variant %s in enum %s", name, enum.name)
+					return in.fresh()
+				}
+				if !variant.constructor {
+					return &Named{Name: enum.name}
+				}
+				return &Function{Parameters: variant.fields, Result: &Named{Name: enum.name}}
+			}
+		}
+	}
+
+	object := prune(in.expression(expr.Object))
+	if _, ok := object.(*Var); ok {
+		var found []*structInfo
+		for _, info := range in.env.structs {
+			if _, ok := info.fields[name]; ok {
+				found = append(found, info)
+			} else if _, ok := info.methods[name]; ok {
+				found = append(found, info)
+			}
+		}
+		if len(found) != 1 {
+			return in.fresh()
+		}
+		in.unify(expr.Token, &Named{Name: found[0].name}, object, expr)
+		object = prune(object)
+	}
+
+	named, ok := object.(*Named)
+	if !ok {
+		in.errorf(expr.Token, "%s has no members: %s", Describe(object), excerpt(expr))
+		return in.fresh()
+	}
+	if info := in.env.structs[named.Name]; info != nil {
+		if t, ok := info.fields[name]; ok {
+			return t
+		}
+		if method, ok := info.methods[name]; ok && len(method.Parameters) > 0 {
+			return &Function{Parameters: method.Parameters[1:], Result: method.Result}
+		}
+		in.errorf(expr.Member.Token, "unknown field %s in struct %s", name, info.name)
+		return in.fresh()
+	}
+	if info := in.env.enums[named.Name]; info != nil {
+		for _, variant := range info.variants {
+			for i, field := range variant.names {
+				if field == name {
+					return variant.fields[i]
+				}
+			}
+		}
+		in.errorf(expr.Member.Token, "unknown field %s in enum %s", name, info.name)
+	}
+	return in.fresh()
+}
+
+// match takes the enum from the subject or the first variant named, every
+// arm gives the same type
+func (in *inference) match(expr *ast.MatchExpression) Type {
+	subject := in.expression(expr.Subject)
+
+	var enum *enumInfo
+	if named, ok := prune(subject).(*Named); ok {
+		enum = in.env.enums[named.Name]
+	}
+	for _, arm := range expr.Arms {
+		if enum != nil {
+			break
+		}
+		for _, info := range in.env.enums {
+			if _, ok := info.variants[arm.Variant.Value]; ok {
+				enum = info
+				break
+			}
+		}
+	}
+	if enum == nil {
+		in.errorf(expr.Token, "cannot tell the enum of %s", excerpt(expr))
+		return in.fresh()
+	}
+	in.unify(expr.Token, &Named{Name: enum.name}, subject, expr.Subject)
+
+	result := Type(in.fresh())
+	for _, arm := range expr.Arms {
+		if variant, ok := enum.variants[arm.Variant.Value]; ok {
+			for i, binding := range arm.Bindings {
+				if i < len(variant.fields) {
+					in.declare(binding, variant.fields[i])
+				}
+			}
+		} else if arm.Variant.Value != "_" {
+			in.errorf(arm.Variant.Token, "unknown variant %s in enum %s", arm.Variant.Value, enum.name)
+		}
+		in.unify(arm.Variant.Token, result, in.statement(arm.Body), arm.Body)
+	}
+	return result
+}
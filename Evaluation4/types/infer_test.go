@@ -0,0 +1,177 @@
+package types
+
+import (
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"interpreter/resolver"
+	"strings"
+	"testing"
+)
+
+func infer(t *testing.T, env *Env, input string) (*ast.Program, *Info) {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	table := resolver.Resolve(program, func(name string) bool { return name == "len" || name == "puts" }, nil)
+	if len(table.Errors) != 0 {
+		t.Fatalf("resolver errors for %q: %v", input, table.Errors)
+	}
+	return program, env.Infer(program, table)
+}
+
+func lastType(program *ast.Program, info *Info) string {
+	last := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement)
+	return Describe(info.Types[last.Expression])
+}
+
+func TestInferTypes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2", "int"},
+		{"\"a\" + \"b\"", "string"},
+		{"func(a, b) { a + b }", "func(int, int): int"},
+		{"func(a, b) { a == b }", "func('a, 'a): bool"},
+		{"func(x) { x }", "func('a): 'a"},
+		{"func(f, x) { f(f(x)) }", "func(func('a): 'a, 'a): 'a"},
+		{"let id = func(x) { x }; [id(1), id(2)]", "[int]"},
+		{"let id = func(x) { x }; id(\"a\") + id(\"b\")", "string"},
+		{"let id = func(x) { x }; id", "func('a): 'a"},
+		{"let map = func(xs, f) { if (len(xs) == 0) { [] } else { [f(xs[0])] } }; map",
+			"func(['a], func('a): 'b): ['b]"},
+		{"let fact = func(n) { if (n < 2) { return 1 }; n * fact(n - 1) }; fact", "func(int): int"},
+		{"let f = func() { g(1) }; let g = func(x) { x }; f", "func(): int"},
+		{"[]", "['a]"},
+		{"[[1], []]", "[[int]]"},
+		{"\"abc\"[0]", "string"},
+		{"1..3", "[int]"},
+		{"let f = func(a: any, b: [string]) { b }; f", "func('a, [string]): [string]"},
+		{"if (true) { 1 } else { 2 }", "int"},
+		{"if (true) { puts(1) }", "null"},
+		{"struct P { x; func get(self) { self.x } } let p = P{x: 1}; p.get", "func(): int"},
+		{"struct P { x, y } func(p) { p.y }", "func(P): 'a"},
+		{"enum S { C(r), E } let s = S.C(1); match (s) { C(r) => r + 1, E => 0 }", "int"},
+		{"struct V { n; func __add__(self, o) { V{n: self.n + o.n} } } V{n: 1} + V{n: 2}", "V"},
+		{"infixl 6 <+> = func(a, b) { [a, b] }; 1 <+> 2", "[int]"},
+		{"try { 1 } catch (e) { 2 }", "int"},
+	}
+
+	for _, tt := range tests {
+		program, info := infer(t, NewEnv(), tt.input)
+		if len(info.Errors) != 0 {
+			t.Errorf("unexpected errors for %q: %v", tt.input, info.Errors)
+			continue
+		}
+		if got := lastType(program, info); got != tt.expected {
+			t.Errorf("wrong type of %q. expected=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestInferErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + \"a\"", "1:3: cannot unify int with string in 1 + \"a\""},
+		{"[1, \"a\"]", "1:1: cannot unify int with string in [1, \"a\"]"},
+		{"let f = func(x) { x + 1 }; f(true)", "1:29: cannot unify func(int): int with func(bool): 'a in f(true)"},
+		{"let f = func(x) { x(x) }", "1:20: cannot unify 'a with func('a): 'b: the type would contain itself in x(x)"},
+		{"let f = func(a, b) { a }; f(1)", "1:28: cannot unify func('a, 'b): 'a with func(int): 'c: 2 parameters and 1 in f(1)"},
+		{"if (1) { 2 } else { 3 }", "1:1: cannot unify bool with int in 1"},
+		{"if (true) { 1 }", "1:1: cannot unify null with int in if (true) { 1 }"},
+		{"let x: string = 1", "1:5: cannot unify string with int in let x: string = 1;"},
+		{"let f = func(): int { return \"a\" }", "1:23: cannot unify int with string in return \"a\";"},
+		{"let f = func(x) { let y = x + 1; x + \"\" }", "1:36: cannot unify int with string in x + \"\""},
+		{"struct P { x } P{y: 1}", "1:18: unknown field y in struct P"},
+		{"struct P { x } let p = P{x: 1}; p.z", "1:35: unknown field z in struct P"},
+		{"enum S { A } S.B", "1:16: unknown variant B in enum S"},
+		{"1.x", "1:2: int has no members: 1.x"},
+	}
+
+	for _, tt := range tests {
+		_, info := infer(t, NewEnv(), tt.input)
+		if len(info.Errors) == 0 || info.Errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q.\nexpected=%q\ngot=%q", tt.input, tt.expected, info.Errors)
+		}
+	}
+}
+
+// names declared by one program keep their types in the next, unless the
+// program had errors
+func TestInferEnv(t *testing.T) {
+	env := NewEnv()
+	infer(t, env, "let id = func(x) { x }; let n = 1; struct P { x }")
+
+	run := func(input string) (*ast.Program, *Info) {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		return program, env.Infer(program, resolver.Resolve(program, nil, func(string) bool { return true }))
+	}
+
+	program, info := run("id(n)")
+	if got := lastType(program, info); got != "int" || len(info.Errors) != 0 {
+		t.Errorf("wrong type of id(n). got=%s, errors=%v", got, info.Errors)
+	}
+
+	// a clone doesn't change env
+	clone := env
+	env = clone.Clone()
+	run("P{x: 1}")
+	env = clone
+	program, info = run("P{x: \"a\"}.x")
+	if got := lastType(program, info); got != "string" || len(info.Errors) != 0 {
+		t.Errorf("wrong type after a clone. got=%s, errors=%v", got, info.Errors)
+	}
+
+	run("let n = \"a\"; n + 1")
+	program, info = run("n")
+	if got := lastType(program, info); got != "'a" {
+		t.Errorf("n should be forgotten after an error. got=%s", got)
+	}
+}
+
+func TestHasPragma(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"// monkey:strict\nlet x = 1", true},
+		{"let x = 1 //monkey:strict", true},
+		{"// monkey:strict please\n1", false},
+		{"1", false},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		parser.New(l).ParseProgram()
+		if got := HasPragma(l.Comments()); got != tt.expected {
+			t.Errorf("HasPragma(%q) = %t, expected %t", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	a, b := &Var{ID: 7}, &Var{ID: 3}
+	bound := &Var{ID: 1, Instance: Int}
+	tests := []struct {
+		t        Type
+		expected string
+	}{
+		{&Function{Parameters: []Type{a, b, a}, Result: bound}, "func('a, 'b, 'a): int"},
+		{&Array{Element: &Array{Element: b}}, "[['a]]"},
+	}
+	for _, tt := range tests {
+		if got := Describe(tt.t); got != tt.expected {
+			t.Errorf("Describe(%s) = %s, expected %s", tt.t, got, tt.expected)
+		}
+		if !strings.Contains(Resolve(tt.t).String(), "'t") {
+			t.Errorf("Resolve(%s) lost its variables", tt.t)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Package types checks the optional type annotations of a program, and the
+// types it can infer for expressions without them, before the program runs.
+//
+// Checking is gradual: a name or parameter without an annotation takes the
+// type of its value when that is certain and is Any otherwise, and Any fits
+// everywhere. Code without annotations is only rejected for what would always
+// fail at run time, like "a" + 1 or calling an integer.
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type is what the checker knows about the values of an expression.
+type Type interface {
+	String() string
+}
+
+// Basic types are the built in values and Any, which stands for every value
+type Basic string
+
+const (
+	Any    Basic = "any"
+	Int    Basic = "int"
+	String Basic = "string"
+	Bool   Basic = "bool"
+)
+
+func (b Basic) String() string { return string(b) }
+
+// Array is [Element]
+type Array struct {
+	Element Type
+}
+
+func (a *Array) String() string { return "[" + a.Element.String() + "]" }
+
+// Function is func(Parameters): Result
+type Function struct {
+	Parameters []Type
+	Result     Type
+}
+
+func (f *Function) String() string {
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+	return fmt.Sprintf("func(%s): %s", strings.Join(params, ", "), f.Result)
+}
+
+// Named is an instance of a struct or a value of an enum declared in the
+// program
+type Named struct {
+	Name string
+}
+
+func (n *Named) String() string { return n.Name }
+
+// Identical reports whether a and b are the same type.
+func Identical(a, b Type) bool {
+	switch a := a.(type) {
+	case Basic:
+		return a == b
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && Identical(a.Element, b.Element)
+	case *Function:
+		b, ok := b.(*Function)
+		if !ok || len(a.Parameters) != len(b.Parameters) || !Identical(a.Result, b.Result) {
+			return false
+		}
+		for i := range a.Parameters {
+			if !Identical(a.Parameters[i], b.Parameters[i]) {
+				return false
+			}
+		}
+		return true
+	case *Named:
+		b, ok := b.(*Named)
+		return ok && a.Name == b.Name
+	}
+	return false
+}
+
+// Assignable reports whether a value of type from can be used where to is
+// expected. Any is assignable both ways, also inside arrays and functions.
+func Assignable(from, to Type) bool {
+	if from == Any || to == Any {
+		return true
+	}
+	switch to := to.(type) {
+	case *Array:
+		from, ok := from.(*Array)
+		return ok && Assignable(from.Element, to.Element)
+	case *Function:
+		from, ok := from.(*Function)
+		if !ok || len(from.Parameters) != len(to.Parameters) || !Assignable(from.Result, to.Result) {
+			return false
+		}
+		for i := range to.Parameters {
+			if !Assignable(to.Parameters[i], from.Parameters[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return Identical(from, to)
+}